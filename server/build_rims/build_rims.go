@@ -0,0 +1,459 @@
+// Package main builds an ImageDatabase from a manifest of Confidential Space
+// releases and writes it as a signed PlatformRims GoldenMeasurement.
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/image"
+	"github.com/GoogleCloudPlatform/confidential-space/server/rims"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	commonpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/common"
+	rimpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/image_database"
+	platformpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/platform_rims"
+)
+
+/*
+Usage:
+$ go run ./build_rims -manifest manifest.json -key key.pem -cert cert.pem -ca_bundle ca_bundle.pem -out golden_measurement.binpb
+
+The manifest lists the releases and image base versions of the database. File
+paths are relative to the manifest:
+{
+  "releases": [{
+    "image_release_name": "confidential-space-250100",
+    "cmdline": "BOOT_IMAGE=/syslinux/vmlinuz.A ...",
+    "hardened": true,
+    "image_base_version": 3,
+    "swversion": 250100,
+    "labels": ["STABLE", "LATEST"],
+    "deprecated": false
+  }],
+  "base_versions": {
+    "3": {
+      "db": {"certs": ["COS_DB_V20251004"]},
+      "dbx": {"certs": ["COS_DB_V10"], "digests": ["<hex>"]},
+      "authority": {"certs": ["COS_DB_V20251004"]}
+    }
+  },
+  "known_certs": {"COS_DB_NEW": "cos_db_new.pem"},
+  "earliest_cert_issue_time": "2025-01-01T00:00:00Z"
+}
+
+A cert is a CCKnownCertificates name, or the name of a known_certs entry,
+which is written to the database and referenced by its SHA-256 fingerprint.
+*/
+
+var (
+	manifestPath = flag.String("manifest", "", "JSON manifest of the releases to build the image database from")
+	keyPath      = flag.String("key", "", "PEM private key to sign the PlatformRims with")
+	certPath     = flag.String("cert", "", "PEM or DER certificate of the signing key")
+	caBundlePath = flag.String("ca_bundle", "", "PEM certificates chaining the signing certificate to its root, in least intermediate…root order")
+	algorithm    = flag.String("alg", "", "signature algorithm, ECDSA_P256_SHA256 or RSASSA_PSS_SHA256; defaults to the one of the key")
+	validity     = flag.Duration("validity", 30*24*time.Hour, "time after the timestamp at which the PlatformRims expires")
+	outPath      = flag.String("out", "", "file to write the serialized GoldenMeasurement to")
+)
+
+type manifest struct {
+	Releases     []release                  `json:"releases"`
+	BaseVersions map[string]ccDatabaseEntry `json:"base_versions"`
+	// KnownCerts are PEM or DER certificate files keyed by name.
+	KnownCerts            map[string]string `json:"known_certs"`
+	EarliestCertIssueTime *time.Time        `json:"earliest_cert_issue_time"`
+}
+
+type release struct {
+	ImageReleaseName string   `json:"image_release_name"`
+	CmdLine          string   `json:"cmdline"`
+	Hardened         bool     `json:"hardened"`
+	ImageBaseVersion uint32   `json:"image_base_version"`
+	Swversion        uint32   `json:"swversion"`
+	Labels           []string `json:"labels"`
+	Deprecated       bool     `json:"deprecated"`
+}
+
+type ccDatabaseEntry struct {
+	DB        ccDatabase `json:"db"`
+	DBX       ccDatabase `json:"dbx"`
+	Authority ccDatabase `json:"authority"`
+}
+
+type ccDatabase struct {
+	Certs        []string `json:"certs"`
+	Fingerprints []string `json:"fingerprints"`
+	Digests      []string `json:"digests"`
+}
+
+// signer signs PlatformRims with a local key.
+type signer struct {
+	algorithm commonpb.SignatureAlgorithm
+	key       crypto.Signer
+	// cert is the DER signing certificate.
+	cert []byte
+	// caBundle is the PEM CA bundle of the signing certificate.
+	caBundle []byte
+}
+
+func main() {
+	flag.Parse()
+	for name, value := range map[string]string{"manifest": *manifestPath, "key": *keyPath, "cert": *certPath, "ca_bundle": *caBundlePath, "out": *outPath} {
+		if value == "" {
+			fmt.Fprintf(os.Stderr, "Missing required flag -%v\n", name)
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	imageDb, err := loadImageDatabase(*manifestPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to build image database: %v\n", err)
+		os.Exit(1)
+	}
+
+	s, err := loadSigner(*keyPath, *certPath, *caBundlePath, *algorithm)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load signer: %v\n", err)
+		os.Exit(1)
+	}
+
+	gm, err := signPlatformRims(imageDb, s, time.Now(), *validity)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to sign PlatformRims: %v\n", err)
+		os.Exit(1)
+	}
+
+	raw, err := proto.Marshal(gm)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to marshal GoldenMeasurement: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*outPath, raw, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write GoldenMeasurement: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// loadImageDatabase reads the manifest and builds its image database.
+func loadImageDatabase(path string) (*rimpb.ImageDatabase, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %v", err)
+	}
+	m := manifest{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+	return buildImageDatabase(m, filepath.Dir(path))
+}
+
+// buildImageDatabase builds the image database of the manifest. Known cert
+// files are read relative to dir.
+func buildImageDatabase(m manifest, dir string) (*rimpb.ImageDatabase, error) {
+	imageDb := &rimpb.ImageDatabase{
+		GoldenValues:    make(map[string]*rimpb.ImageDatabase_ImageGoldenEntry),
+		ImageBaseValues: make(map[uint32]*rimpb.ImageDatabase_ImageBaseEntry),
+	}
+
+	if len(m.KnownCerts) != 0 {
+		imageDb.KnownCerts = make(map[string][]byte)
+	}
+	for name, certFile := range m.KnownCerts {
+		if _, ok := rimpb.ImageDatabase_CCKnownCertificates_value[name]; ok {
+			return nil, fmt.Errorf("known cert %q shadows the CCKnownCertificates value", name)
+		}
+		der, err := readCertificate(filepath.Join(dir, certFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read known cert %q: %v", name, err)
+		}
+		imageDb.KnownCerts[name] = der
+	}
+
+	for version, entry := range m.BaseVersions {
+		baseVersion, err := strconv.ParseUint(version, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image base version %q: %v", version, err)
+		}
+		baseEntry := &rimpb.ImageDatabase_ImageBaseEntry{}
+		if baseEntry.Db, err = buildCCDatabase(entry.DB, imageDb.GetKnownCerts()); err != nil {
+			return nil, fmt.Errorf("invalid db of image base version %v: %v", baseVersion, err)
+		}
+		if baseEntry.Dbx, err = buildCCDatabase(entry.DBX, imageDb.GetKnownCerts()); err != nil {
+			return nil, fmt.Errorf("invalid dbx of image base version %v: %v", baseVersion, err)
+		}
+		if baseEntry.Authority, err = buildCCDatabase(entry.Authority, imageDb.GetKnownCerts()); err != nil {
+			return nil, fmt.Errorf("invalid authority of image base version %v: %v", baseVersion, err)
+		}
+		imageDb.ImageBaseValues[uint32(baseVersion)] = baseEntry
+	}
+
+	for _, r := range m.Releases {
+		if r.ImageReleaseName == "" {
+			return nil, errors.New("release has no image_release_name")
+		}
+		cmdLine := image.NormalizeCmdLine(r.CmdLine)
+		if cmdLine == "" {
+			return nil, fmt.Errorf("release %q has no cmdline", r.ImageReleaseName)
+		}
+		if _, err := image.ParseCmdLine(cmdLine); err != nil {
+			return nil, fmt.Errorf("release %q has a malformed cmdline: %v", r.ImageReleaseName, err)
+		}
+		if existing, ok := imageDb.GoldenValues[cmdLine]; ok {
+			return nil, fmt.Errorf("releases %q and %q have the same cmdline", existing.GetImageReleaseName(), r.ImageReleaseName)
+		}
+		if _, ok := imageDb.ImageBaseValues[r.ImageBaseVersion]; !ok {
+			return nil, fmt.Errorf("release %q has image base version %v, which is not in base_versions", r.ImageReleaseName, r.ImageBaseVersion)
+		}
+
+		golden := &rimpb.ImageDatabase_ImageGoldenEntry{
+			ImageReleaseName: r.ImageReleaseName,
+			IsHardened:       r.Hardened,
+			ImageBaseVersion: r.ImageBaseVersion,
+			Swversion:        r.Swversion,
+			Deprecated:       r.Deprecated,
+		}
+		for _, label := range r.Labels {
+			value, ok := rimpb.ImageDatabase_AttributeLabel_value[label]
+			if !ok || value == int32(rimpb.ImageDatabase_NIL) {
+				return nil, fmt.Errorf("release %q has unknown label %q", r.ImageReleaseName, label)
+			}
+			golden.AttributeLabels = append(golden.AttributeLabels, rimpb.ImageDatabase_AttributeLabel(value))
+		}
+		imageDb.GoldenValues[cmdLine] = golden
+	}
+
+	if m.EarliestCertIssueTime != nil {
+		imageDb.ServiceBasePolicy = &rimpb.ImageDatabase_ServiceBasePolicy{
+			EarliestCertIssueTime: timestamppb.New(*m.EarliestCertIssueTime),
+		}
+	}
+	return imageDb, nil
+}
+
+// buildCCDatabase resolves the certs of a manifest CCDatabase. CCKnownCertificates
+// names become known_certificates and known cert names their fingerprint.
+func buildCCDatabase(db ccDatabase, knownCerts map[string][]byte) (*rimpb.ImageDatabase_CCDatabase, error) {
+	ccDb := &rimpb.ImageDatabase_CCDatabase{}
+	for _, name := range db.Certs {
+		if value, ok := rimpb.ImageDatabase_CCKnownCertificates_value[name]; ok && value != int32(rimpb.ImageDatabase_UNSPECIFIED_CERT) {
+			ccDb.KnownCertificates = append(ccDb.KnownCertificates, rimpb.ImageDatabase_CCKnownCertificates(value))
+			continue
+		}
+		der, ok := knownCerts[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cert %q", name)
+		}
+		digest := sha256.Sum256(der)
+		ccDb.KnownCertFingerprints = append(ccDb.KnownCertFingerprints, hex.EncodeToString(digest[:]))
+	}
+	for _, fingerprint := range db.Fingerprints {
+		if _, err := hex.DecodeString(fingerprint); err != nil || len(fingerprint) != 2*sha256.Size {
+			return nil, fmt.Errorf("malformed SHA-256 fingerprint %q", fingerprint)
+		}
+		ccDb.KnownCertFingerprints = append(ccDb.KnownCertFingerprints, strings.ToLower(fingerprint))
+	}
+	for _, digest := range db.Digests {
+		if _, err := hex.DecodeString(digest); err != nil {
+			return nil, fmt.Errorf("malformed digest %q: %v", digest, err)
+		}
+		ccDb.Digests = append(ccDb.Digests, strings.ToLower(digest))
+	}
+	return ccDb, nil
+}
+
+// readCertificate reads a PEM or DER certificate file and returns its DER.
+func readCertificate(path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	der := raw
+	if block, _ := pem.Decode(raw); block != nil {
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM type %q", block.Type)
+		}
+		der = block.Bytes
+	}
+	if _, err := x509.ParseCertificate(der); err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
+	}
+	return der, nil
+}
+
+// loadSigner reads the signing key, its certificate and CA bundle, and checks
+// the key matches the certificate and the signature algorithm. If alg is
+// empty, the algorithm is that of the key.
+func loadSigner(keyPath, certPath, caBundlePath, alg string) (*signer, error) {
+	rawKey, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %v", err)
+	}
+	key, err := parsePrivateKey(rawKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key: %v", err)
+	}
+
+	keyAlg, err := keyAlgorithm(key)
+	if err != nil {
+		return nil, err
+	}
+	if alg != "" {
+		value, ok := commonpb.SignatureAlgorithm_value[alg]
+		if !ok || value == int32(commonpb.SignatureAlgorithm_SIGNATURE_ALGORITHM_UNSPECIFIED) {
+			return nil, fmt.Errorf("unknown signature algorithm %q", alg)
+		}
+		if commonpb.SignatureAlgorithm(value) != keyAlg {
+			return nil, fmt.Errorf("signature algorithm %v does not match the %v key", alg, keyAlg)
+		}
+	}
+
+	cert, err := readCertificate(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %v", err)
+	}
+	parsed, _ := x509.ParseCertificate(cert)
+	if pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(parsed.PublicKey) {
+		return nil, errors.New("the key does not match the certificate")
+	}
+
+	caBundle, err := os.ReadFile(caBundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+	}
+	return &signer{algorithm: keyAlg, key: key, cert: cert, caBundle: caBundle}, nil
+}
+
+func parsePrivateKey(raw []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("no PEM block")
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unexpected PEM type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return s, nil
+}
+
+// keyAlgorithm returns the signature algorithm of a P-256 ECDSA or RSA key.
+func keyAlgorithm(key crypto.Signer) (commonpb.SignatureAlgorithm, error) {
+	switch pub := key.Public().(type) {
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return 0, fmt.Errorf("unsupported ECDSA curve %v", pub.Curve.Params().Name)
+		}
+		return commonpb.SignatureAlgorithm_ECDSA_P256_SHA256, nil
+	case *rsa.PublicKey:
+		return commonpb.SignatureAlgorithm_RSASSA_PSS_SHA256, nil
+	default:
+		return 0, fmt.Errorf("unsupported key type %T", pub)
+	}
+}
+
+// sign signs the data for rims.VerifySignature: an ASN.1 ECDSA or an
+// RSA-PSS signature with a salt as long as the hash, over SHA-256.
+func (s *signer) sign(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	var opts crypto.SignerOpts = crypto.SHA256
+	if s.algorithm == commonpb.SignatureAlgorithm_RSASSA_PSS_SHA256 {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+	}
+	return s.key.Sign(rand.Reader, digest[:], opts)
+}
+
+// signPlatformRims wraps the image database in a PlatformRims published at now
+// and expiring after validity, signs it, and checks the GoldenMeasurement
+// verifies with rims.VerifyPlatformRims against the self-signed roots of the CA
+// bundle.
+func signPlatformRims(imageDb *rimpb.ImageDatabase, s *signer, now time.Time, validity time.Duration) (*platformpb.GoldenMeasurement, error) {
+	if validity <= 0 {
+		return nil, fmt.Errorf("validity %v is not positive", validity)
+	}
+	platformRims := &platformpb.PlatformRims{
+		ImageDatabase: imageDb,
+		Timestamp:     timestamppb.New(now),
+		Exp:           timestamppb.New(now.Add(validity)),
+		Cert:          s.cert,
+		CaBundle:      s.caBundle,
+	}
+	raw, err := proto.Marshal(platformRims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal PlatformRims: %v", err)
+	}
+	signature, err := s.sign(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign PlatformRims: %v", err)
+	}
+	gm := &platformpb.GoldenMeasurement{
+		PlatformRims:       raw,
+		Signature:          signature,
+		SignatureAlgorithm: s.algorithm,
+	}
+
+	roots, err := bundleRoots(s.caBundle)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rims.VerifyPlatformRims(gm, rims.Options{Roots: roots, CurrentTime: now}); err != nil {
+		return nil, fmt.Errorf("signed PlatformRims does not verify: %v", err)
+	}
+	return gm, nil
+}
+
+// bundleRoots returns a pool of the self-signed certificates of a PEM CA bundle.
+func bundleRoots(caBundle []byte) (*x509.CertPool, error) {
+	roots := x509.NewCertPool()
+	found := false
+	for rest := caBundle; len(rest) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CA bundle certificate: %v", err)
+		}
+		if cert.CheckSignatureFrom(cert) == nil {
+			roots.AddCert(cert)
+			found = true
+		}
+	}
+	if !found {
+		return nil, errors.New("CA bundle has no root certificate")
+	}
+	return roots, nil
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/internal/certtest"
+	"github.com/GoogleCloudPlatform/confidential-space/server/rims"
+	"github.com/GoogleCloudPlatform/confidential-space/server/rims/rimstest"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	commonpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/common"
+	rimpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/image_database"
+)
+
+const testCmdLine = "BOOT_IMAGE=/syslinux/vmlinuz.A ro console=ttyS0 cos.launcher=confidential-space"
+
+var testNow = time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+func writePEM(t *testing.T, path, blockType string, blocks ...[]byte) {
+	t.Helper()
+	var out []byte
+	for _, block := range blocks {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: block})...)
+	}
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		t.Fatalf("os.WriteFile() failed: %v", err)
+	}
+}
+
+func newTestSigner(t *testing.T, alg commonpb.SignatureAlgorithm) *rimstest.Signer {
+	t.Helper()
+	s, err := rimstest.NewSigner(alg, testNow.Add(-24*time.Hour), testNow.Add(365*24*time.Hour))
+	if err != nil {
+		t.Fatalf("rimstest.NewSigner() failed: %v", err)
+	}
+	return s
+}
+
+// writeSigningFiles writes the signer's PKCS #8 key, its certificate and its CA
+// bundle to dir, and returns their paths.
+func writeSigningFiles(t *testing.T, dir string, s *rimstest.Signer) (keyPath, certPath, caBundlePath string) {
+	t.Helper()
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(s.Key)
+	if err != nil {
+		t.Fatalf("x509.MarshalPKCS8PrivateKey() failed: %v", err)
+	}
+	keyPath = filepath.Join(dir, "key.pem")
+	certPath = filepath.Join(dir, "cert.pem")
+	caBundlePath = filepath.Join(dir, "ca_bundle.pem")
+	writePEM(t, keyPath, "PRIVATE KEY", pkcs8)
+	writePEM(t, certPath, "CERTIFICATE", s.Cert)
+	if err := os.WriteFile(caBundlePath, s.CABundle, 0644); err != nil {
+		t.Fatalf("os.WriteFile() failed: %v", err)
+	}
+	return keyPath, certPath, caBundlePath
+}
+
+// writeManifest writes a manifest with a known cert to dir, and returns its
+// path and the DER known cert.
+func writeManifest(t *testing.T, dir string) (string, []byte) {
+	t.Helper()
+	knownCert, err := certtest.NewCA(&x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test DB"},
+		NotBefore:    testNow.Add(-24 * time.Hour),
+		NotAfter:     testNow.Add(365 * 24 * time.Hour),
+	}, elliptic.P256(), nil)
+	if err != nil {
+		t.Fatalf("certtest.NewCA() failed: %v", err)
+	}
+	writePEM(t, filepath.Join(dir, "test_db.pem"), "CERTIFICATE", knownCert.Cert.Raw)
+
+	m := map[string]any{
+		"releases": []map[string]any{
+			{
+				"image_release_name": "confidential-space-250100",
+				"cmdline":            testCmdLine + "\x00",
+				"hardened":           true,
+				"image_base_version": 3,
+				"swversion":          250100,
+				"labels":             []string{"STABLE", "LATEST"},
+			},
+			{
+				"image_release_name": "confidential-space-debug-240900",
+				"cmdline":            testCmdLine + " cos.debug=1",
+				"image_base_version": 3,
+				"swversion":          240900,
+				"deprecated":         true,
+			},
+		},
+		"base_versions": map[string]any{
+			"3": map[string]any{
+				"db":        map[string]any{"certs": []string{"TEST_DB"}},
+				"dbx":       map[string]any{"certs": []string{"COS_DB_V10"}, "digests": []string{"ABCD"}},
+				"authority": map[string]any{"certs": []string{"TEST_DB", "COS_DB_V20251004"}},
+			},
+		},
+		"known_certs":              map[string]string{"TEST_DB": "test_db.pem"},
+		"earliest_cert_issue_time": "2025-01-01T00:00:00Z",
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	path := filepath.Join(dir, "manifest.json")
+	if err := os.WriteFile(path, raw, 0644); err != nil {
+		t.Fatalf("os.WriteFile() failed: %v", err)
+	}
+	return path, knownCert.Cert.Raw
+}
+
+func TestLoadImageDatabase(t *testing.T) {
+	dir := t.TempDir()
+	manifestPath, knownCert := writeManifest(t, dir)
+
+	got, err := loadImageDatabase(manifestPath)
+	if err != nil {
+		t.Fatalf("loadImageDatabase() failed: %v", err)
+	}
+
+	digest := sha256.Sum256(knownCert)
+	fingerprint := hex.EncodeToString(digest[:])
+	want := &rimpb.ImageDatabase{
+		GoldenValues: map[string]*rimpb.ImageDatabase_ImageGoldenEntry{
+			testCmdLine: {
+				ImageReleaseName: "confidential-space-250100",
+				IsHardened:       true,
+				ImageBaseVersion: 3,
+				Swversion:        250100,
+				AttributeLabels:  []rimpb.ImageDatabase_AttributeLabel{rimpb.ImageDatabase_STABLE, rimpb.ImageDatabase_LATEST},
+			},
+			testCmdLine + " cos.debug=1": {
+				ImageReleaseName: "confidential-space-debug-240900",
+				ImageBaseVersion: 3,
+				Swversion:        240900,
+				Deprecated:       true,
+			},
+		},
+		ImageBaseValues: map[uint32]*rimpb.ImageDatabase_ImageBaseEntry{
+			3: {
+				Db: &rimpb.ImageDatabase_CCDatabase{KnownCertFingerprints: []string{fingerprint}},
+				Dbx: &rimpb.ImageDatabase_CCDatabase{
+					KnownCertificates: []rimpb.ImageDatabase_CCKnownCertificates{rimpb.ImageDatabase_COS_DB_V10},
+					Digests:           []string{"abcd"},
+				},
+				Authority: &rimpb.ImageDatabase_CCDatabase{
+					KnownCertificates:     []rimpb.ImageDatabase_CCKnownCertificates{rimpb.ImageDatabase_COS_DB_V20251004},
+					KnownCertFingerprints: []string{fingerprint},
+				},
+			},
+		},
+		KnownCerts: map[string][]byte{"TEST_DB": knownCert},
+		ServiceBasePolicy: &rimpb.ImageDatabase_ServiceBasePolicy{
+			EarliestCertIssueTime: timestamppb.New(time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)),
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("loadImageDatabase() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildImageDatabaseErrors(t *testing.T) {
+	baseVersions := map[string]ccDatabaseEntry{"3": {}}
+	testCases := []struct {
+		name     string
+		manifest manifest
+		wantErr  string
+	}{
+		{
+			name: "duplicate cmdline",
+			manifest: manifest{
+				Releases: []release{
+					{ImageReleaseName: "a", CmdLine: "ro quiet", ImageBaseVersion: 3},
+					{ImageReleaseName: "b", CmdLine: "ro quiet\x00", ImageBaseVersion: 3},
+				},
+				BaseVersions: baseVersions,
+			},
+			wantErr: "same cmdline",
+		},
+		{
+			name: "malformed cmdline",
+			manifest: manifest{
+				Releases:     []release{{ImageReleaseName: "a", CmdLine: `ro dm="1 vroot`, ImageBaseVersion: 3}},
+				BaseVersions: baseVersions,
+			},
+			wantErr: "malformed cmdline",
+		},
+		{
+			name: "missing base version",
+			manifest: manifest{
+				Releases:     []release{{ImageReleaseName: "a", CmdLine: "ro", ImageBaseVersion: 4}},
+				BaseVersions: baseVersions,
+			},
+			wantErr: "not in base_versions",
+		},
+		{
+			name: "unknown label",
+			manifest: manifest{
+				Releases:     []release{{ImageReleaseName: "a", CmdLine: "ro", ImageBaseVersion: 3, Labels: []string{"STALE"}}},
+				BaseVersions: baseVersions,
+			},
+			wantErr: "unknown label",
+		},
+		{
+			name: "unknown cert",
+			manifest: manifest{
+				BaseVersions: map[string]ccDatabaseEntry{"3": {DB: ccDatabase{Certs: []string{"TEST_DB"}}}},
+			},
+			wantErr: `unknown cert "TEST_DB"`,
+		},
+		{
+			name: "malformed fingerprint",
+			manifest: manifest{
+				BaseVersions: map[string]ccDatabaseEntry{"3": {DBX: ccDatabase{Fingerprints: []string{"abcd"}}}},
+			},
+			wantErr: "malformed SHA-256 fingerprint",
+		},
+		{
+			name:     "known cert shadows enum",
+			manifest: manifest{KnownCerts: map[string]string{"COS_DB_V10": "cos_db_v10.pem"}},
+			wantErr:  "shadows",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := buildImageDatabase(tc.manifest, t.TempDir())
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("buildImageDatabase() = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignPlatformRims(t *testing.T) {
+	testCases := []struct {
+		name string
+		alg  string
+		want commonpb.SignatureAlgorithm
+	}{
+		{"ECDSA", "", commonpb.SignatureAlgorithm_ECDSA_P256_SHA256},
+		{"RSA-PSS", "RSASSA_PSS_SHA256", commonpb.SignatureAlgorithm_RSASSA_PSS_SHA256},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			manifestPath, _ := writeManifest(t, dir)
+			rimSigner := newTestSigner(t, tc.want)
+			keyPath, certPath, caBundlePath := writeSigningFiles(t, dir, rimSigner)
+
+			imageDb, err := loadImageDatabase(manifestPath)
+			if err != nil {
+				t.Fatalf("loadImageDatabase() failed: %v", err)
+			}
+			s, err := loadSigner(keyPath, certPath, caBundlePath, tc.alg)
+			if err != nil {
+				t.Fatalf("loadSigner() failed: %v", err)
+			}
+			gm, err := signPlatformRims(imageDb, s, testNow, 7*24*time.Hour)
+			if err != nil {
+				t.Fatalf("signPlatformRims() failed: %v", err)
+			}
+			if gm.GetSignatureAlgorithm() != tc.want {
+				t.Errorf("got signature algorithm %v, want %v", gm.GetSignatureAlgorithm(), tc.want)
+			}
+
+			raw, err := proto.Marshal(gm)
+			if err != nil {
+				t.Fatalf("proto.Marshal() failed: %v", err)
+			}
+			roots := rimSigner.Roots()
+			got, err := rims.LoadImageDatabase(raw, rims.Options{Roots: roots, CurrentTime: testNow.Add(time.Hour)})
+			if err != nil {
+				t.Fatalf("rims.LoadImageDatabase() failed: %v", err)
+			}
+			if diff := cmp.Diff(imageDb, got, protocmp.Transform()); diff != "" {
+				t.Errorf("rims.LoadImageDatabase() mismatch (-want +got):\n%s", diff)
+			}
+
+			// The PlatformRims expires after the validity.
+			if _, err := rims.LoadImageDatabase(raw, rims.Options{Roots: roots, CurrentTime: testNow.Add(8 * 24 * time.Hour)}); err == nil || !strings.Contains(err.Error(), "expired") {
+				t.Errorf("rims.LoadImageDatabase() after the validity = %v, want expired error", err)
+			}
+		})
+	}
+}
+
+func TestLoadSignerErrors(t *testing.T) {
+	dir := t.TempDir()
+	keyPath, certPath, caBundlePath := writeSigningFiles(t, dir, newTestSigner(t, commonpb.SignatureAlgorithm_ECDSA_P256_SHA256))
+
+	if _, err := loadSigner(keyPath, certPath, caBundlePath, "RSASSA_PSS_SHA256"); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("loadSigner() with an RSA-PSS algorithm for an ECDSA key = %v, want mismatch error", err)
+	}
+	if _, err := loadSigner(keyPath, certPath, caBundlePath, "ED25519"); err == nil || !strings.Contains(err.Error(), "unknown signature algorithm") {
+		t.Errorf("loadSigner() with an unknown algorithm = %v, want unknown algorithm error", err)
+	}
+
+	_, otherCertPath, _ := writeSigningFiles(t, t.TempDir(), newTestSigner(t, commonpb.SignatureAlgorithm_ECDSA_P256_SHA256))
+	if _, err := loadSigner(keyPath, otherCertPath, caBundlePath, ""); err == nil || !strings.Contains(err.Error(), "does not match the certificate") {
+		t.Errorf("loadSigner() with another key's certificate = %v, want key mismatch error", err)
+	}
+}
+
+func TestSignPlatformRimsUnverifiable(t *testing.T) {
+	keyPath, certPath, _ := writeSigningFiles(t, t.TempDir(), newTestSigner(t, commonpb.SignatureAlgorithm_ECDSA_P256_SHA256))
+
+	// A CA bundle that does not chain to the signing certificate.
+	_, _, otherBundlePath := writeSigningFiles(t, t.TempDir(), newTestSigner(t, commonpb.SignatureAlgorithm_ECDSA_P256_SHA256))
+	s, err := loadSigner(keyPath, certPath, otherBundlePath, "")
+	if err != nil {
+		t.Fatalf("loadSigner() failed: %v", err)
+	}
+	if _, err := signPlatformRims(&rimpb.ImageDatabase{}, s, testNow, time.Hour); err == nil || !strings.Contains(err.Error(), "does not verify") {
+		t.Errorf("signPlatformRims() = %v, want verification error", err)
+	}
+}
@@ -0,0 +1,164 @@
+// Package claims converts verified Confidential Space state into the claims of
+// a Confidential Space attestation token.
+package claims
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	rimpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/image_database"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+const (
+	// SwName is the swname claim of Confidential Space images.
+	SwName = "CONFIDENTIAL_SPACE"
+
+	// GoogleOEMID is the oemid claim, Google's IANA Private Enterprise Number.
+	GoogleOEMID = 11129
+
+	// DebugStatusEnabled is the dbgstat claim of debug images.
+	DebugStatusEnabled = "enabled"
+	// DebugStatusDisabledSinceBoot is the dbgstat claim of hardened images.
+	DebugStatusDisabledSinceBoot = "disabled-since-boot"
+)
+
+// Claims are the workload claims of a Confidential Space attestation token.
+// Token envelope claims such as iss, aud, exp and eat_nonce are set by the
+// token issuer and are not included.
+type Claims struct {
+	HWModel   string   `json:"hwmodel"`
+	SwName    string   `json:"swname"`
+	SwVersion []string `json:"swversion"`
+	DbgStat   string   `json:"dbgstat"`
+	SecBoot   bool     `json:"secboot"`
+	OEMID     uint64   `json:"oemid"`
+	Submods   Submods  `json:"submods"`
+}
+
+// Submods are the claims of the token's submodules.
+type Submods struct {
+	Container         *Container         `json:"container,omitempty"`
+	ConfidentialSpace *ConfidentialSpace `json:"confidential_space,omitempty"`
+	NvidiaGPU         *NvidiaGPU         `json:"nvidia_gpu,omitempty"`
+}
+
+// Container are the claims of the workload container.
+type Container struct {
+	ImageReference string            `json:"image_reference"`
+	ImageDigest    string            `json:"image_digest"`
+	RestartPolicy  string            `json:"restart_policy"`
+	ImageID        string            `json:"image_id"`
+	Env            map[string]string `json:"env,omitempty"`
+	Args           []string          `json:"args,omitempty"`
+	EnvOverride    map[string]string `json:"env_override,omitempty"`
+	CmdOverride    []string          `json:"cmd_override,omitempty"`
+}
+
+// ConfidentialSpace are the claims of the Confidential Space image.
+type ConfidentialSpace struct {
+	SupportAttributes []string          `json:"support_attributes"`
+	MonitoringEnabled MonitoringEnabled `json:"monitoring_enabled"`
+}
+
+// MonitoringEnabled is the health monitoring enabled in the workload.
+type MonitoringEnabled struct {
+	Memory bool `json:"memory"`
+}
+
+// NvidiaGPU are the claims of the attached NVIDIA GPUs.
+type NvidiaGPU struct {
+	CCMode string `json:"cc_mode"`
+}
+
+// Build returns the claims of a workload from its verified COS state, the golden
+// entry returned by image.Validate and the hardware it runs on. secboot is set,
+// since image.Validate only returns a golden entry for a Secure Boot enabled
+// machine.
+func Build(cosState *pb.AttestedCosState, golden *rimpb.ImageDatabase_ImageGoldenEntry, hardware pb.GCEConfidentialTechnology) (*Claims, error) {
+	if cosState == nil {
+		return nil, errors.New("COS state is nil")
+	}
+	if golden == nil {
+		return nil, errors.New("image golden entry is nil")
+	}
+
+	hwModel, err := HWModel(hardware)
+	if err != nil {
+		return nil, err
+	}
+
+	dbgStat := DebugStatusEnabled
+	if golden.GetIsHardened() {
+		dbgStat = DebugStatusDisabledSinceBoot
+	}
+
+	claims := &Claims{
+		HWModel:   hwModel,
+		SwName:    SwName,
+		SwVersion: []string{strconv.FormatUint(uint64(golden.GetSwversion()), 10)},
+		DbgStat:   dbgStat,
+		SecBoot:   true,
+		OEMID:     GoogleOEMID,
+		Submods: Submods{
+			ConfidentialSpace: &ConfidentialSpace{
+				SupportAttributes: supportAttributes(golden.GetAttributeLabels()),
+				MonitoringEnabled: MonitoringEnabled{
+					Memory: cosState.GetHealthMonitoring().GetMemoryEnabled(),
+				},
+			},
+		},
+	}
+
+	if container := cosState.GetContainer(); container != nil {
+		claims.Submods.Container = &Container{
+			ImageReference: container.GetImageReference(),
+			ImageDigest:    container.GetImageDigest(),
+			RestartPolicy:  container.GetRestartPolicy().String(),
+			ImageID:        container.GetImageId(),
+			Env:            container.GetEnvVars(),
+			Args:           container.GetArgs(),
+			EnvOverride:    container.GetOverriddenEnvVars(),
+			CmdOverride:    container.GetOverriddenArgs(),
+		}
+	}
+
+	// extract always sets a GpuDeviceState, so only report it when the event log
+	// has a GPU CC mode or device attestation binding.
+	if gpu := cosState.GetGpuDeviceState(); gpu.GetCcMode() != pb.GPUDeviceCCMode_UNSET || gpu.GetNvidiaAttestationReport() != nil {
+		claims.Submods.NvidiaGPU = &NvidiaGPU{CCMode: gpu.GetCcMode().String()}
+	}
+
+	return claims, nil
+}
+
+// HWModel returns the hwmodel claim of the hardware.
+func HWModel(hardware pb.GCEConfidentialTechnology) (string, error) {
+	switch hardware {
+	case pb.GCEConfidentialTechnology_NONE:
+		return "GCP_SHIELDED_VM", nil
+	case pb.GCEConfidentialTechnology_AMD_SEV:
+		return "GCP_AMD_SEV", nil
+	case pb.GCEConfidentialTechnology_AMD_SEV_ES:
+		return "GCP_AMD_SEV_ES", nil
+	case pb.GCEConfidentialTechnology_AMD_SEV_SNP:
+		return "GCP_AMD_SEV_SNP", nil
+	case pb.GCEConfidentialTechnology_INTEL_TDX:
+		return "GCP_INTEL_TDX", nil
+	default:
+		return "", fmt.Errorf("unknown hardware type %v", hardware)
+	}
+}
+
+// supportAttributes returns the support_attributes claim of the image's labels.
+func supportAttributes(labels []rimpb.ImageDatabase_AttributeLabel) []string {
+	attributes := []string{}
+	for _, label := range labels {
+		if label == rimpb.ImageDatabase_NIL {
+			continue
+		}
+		attributes = append(attributes, label.String())
+	}
+	return attributes
+}
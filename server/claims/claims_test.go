@@ -0,0 +1,168 @@
+package claims
+
+import (
+	"crypto"
+	"encoding/json"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/GoogleCloudPlatform/confidential-space/server/extract"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-eventlog/cel"
+
+	rimpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/image_database"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+const testImageDigest = "sha256:bc4c32cb2ca046ba07dcd964b07a320b7d0ca88a5cf8e979da15cae68a2103ee"
+
+// testCosState returns the COS state extract parses from a COS CEL of a
+// workload, with a GPU in CC mode if gpu is set.
+func testCosState(t *testing.T, gpu bool) *pb.AttestedCosState {
+	t.Helper()
+	b, err := coscel.NewBuilder(cel.PCRType)
+	if err != nil {
+		t.Fatalf("NewBuilder() failed: %v", err)
+	}
+	for _, appendEvent := range []func() error{
+		func() error { return b.AppendImageRef("us-docker.pkg.dev/uwear/workload:latest") },
+		func() error { return b.AppendImageDigest(testImageDigest) },
+		func() error { return b.AppendRestartPolicy(pb.RestartPolicy_Never) },
+		func() error { return b.AppendImageID("sha256:0123") },
+		func() error { return b.AppendArg("/workload") },
+		func() error { return b.AppendEnvVar("FOO", "bar") },
+		func() error { return b.AppendOverrideEnv("FOO", "bar") },
+		func() error { return b.AppendMemoryMonitor(true) },
+	} {
+		if err := appendEvent(); err != nil {
+			t.Fatalf("appending COS event failed: %v", err)
+		}
+	}
+	if gpu {
+		if err := b.AppendGpuCCMode(pb.GPUDeviceCCMode_ON); err != nil {
+			t.Fatalf("AppendGpuCCMode() failed: %v", err)
+		}
+	}
+	if err := b.AppendSeparator(); err != nil {
+		t.Fatalf("AppendSeparator() failed: %v", err)
+	}
+
+	rawCEL, err := b.EncodeCEL()
+	if err != nil {
+		t.Fatalf("EncodeCEL() failed: %v", err)
+	}
+	bank, err := b.MRBank(crypto.SHA256)
+	if err != nil {
+		t.Fatalf("MRBank() failed: %v", err)
+	}
+	cosState, err := extract.ParseCOSCEL(rawCEL, bank, extract.Options{})
+	if err != nil {
+		t.Fatalf("ParseCOSCEL() failed: %v", err)
+	}
+	return cosState
+}
+
+func testGoldenEntry() *rimpb.ImageDatabase_ImageGoldenEntry {
+	return &rimpb.ImageDatabase_ImageGoldenEntry{
+		ImageReleaseName: "confidential-space-250301",
+		IsHardened:       true,
+		Swversion:        250301,
+		AttributeLabels:  []rimpb.ImageDatabase_AttributeLabel{rimpb.ImageDatabase_STABLE, rimpb.ImageDatabase_USABLE},
+	}
+}
+
+func TestBuildJSON(t *testing.T) {
+	claims, err := Build(testCosState(t, true), testGoldenEntry(), pb.GCEConfidentialTechnology_INTEL_TDX)
+	if err != nil {
+		t.Fatalf("Build() failed: %v", err)
+	}
+
+	got, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	var gotJSON, wantJSON map[string]any
+	if err := json.Unmarshal(got, &gotJSON); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+
+	want := `{
+		"hwmodel": "GCP_INTEL_TDX",
+		"swname": "CONFIDENTIAL_SPACE",
+		"swversion": ["250301"],
+		"dbgstat": "disabled-since-boot",
+		"secboot": true,
+		"oemid": 11129,
+		"submods": {
+			"container": {
+				"image_reference": "us-docker.pkg.dev/uwear/workload:latest",
+				"image_digest": "` + testImageDigest + `",
+				"restart_policy": "Never",
+				"image_id": "sha256:0123",
+				"env": {"FOO": "bar"},
+				"args": ["/workload"],
+				"env_override": {"FOO": "bar"}
+			},
+			"confidential_space": {
+				"support_attributes": ["STABLE", "USABLE"],
+				"monitoring_enabled": {"memory": true}
+			},
+			"nvidia_gpu": {"cc_mode": "ON"}
+		}
+	}`
+	if err := json.Unmarshal([]byte(want), &wantJSON); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+
+	if diff := cmp.Diff(wantJSON, gotJSON); diff != "" {
+		t.Errorf("Build() JSON mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildDebugImage(t *testing.T) {
+	golden := testGoldenEntry()
+	golden.IsHardened = false
+	golden.AttributeLabels = nil
+	cosState := testCosState(t, false)
+	cosState.HealthMonitoring = nil
+
+	claims, err := Build(cosState, golden, pb.GCEConfidentialTechnology_AMD_SEV)
+	if err != nil {
+		t.Fatalf("Build() failed: %v", err)
+	}
+	if claims.DbgStat != DebugStatusEnabled {
+		t.Errorf("Build() dbgstat = %q, want %q", claims.DbgStat, DebugStatusEnabled)
+	}
+	if claims.HWModel != "GCP_AMD_SEV" {
+		t.Errorf("Build() hwmodel = %q, want GCP_AMD_SEV", claims.HWModel)
+	}
+	if claims.Submods.ConfidentialSpace.MonitoringEnabled.Memory {
+		t.Errorf("Build() memory monitoring enabled, want disabled")
+	}
+	if claims.Submods.ConfidentialSpace.SupportAttributes == nil {
+		t.Errorf("Build() support_attributes is nil, want empty")
+	}
+	if claims.Submods.NvidiaGPU != nil {
+		t.Errorf("Build() nvidia_gpu = %+v, want nil", claims.Submods.NvidiaGPU)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cosState *pb.AttestedCosState
+		golden   *rimpb.ImageDatabase_ImageGoldenEntry
+		hardware pb.GCEConfidentialTechnology
+	}{
+		{"nil COS state", nil, testGoldenEntry(), pb.GCEConfidentialTechnology_INTEL_TDX},
+		{"nil golden entry", testCosState(t, true), nil, pb.GCEConfidentialTechnology_INTEL_TDX},
+		{"unknown hardware", testCosState(t, true), testGoldenEntry(), pb.GCEConfidentialTechnology(100)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Build(tc.cosState, tc.golden, tc.hardware); err == nil {
+				t.Errorf("Build() succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package coscel
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"strconv"
+
+	"github.com/google/go-eventlog/cel"
+	"github.com/google/go-eventlog/proto/state"
+	"github.com/google/go-eventlog/register"
+	"google.golang.org/protobuf/proto"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+// Builder builds a COS CEL and tracks the register values it is expected to
+// produce, starting from a zero register.
+type Builder struct {
+	log       cel.CEL
+	mrIndex   int
+	hashAlgos []crypto.Hash
+	registers map[crypto.Hash][]byte
+}
+
+// NewBuilder returns a Builder for a COS CEL of the given MR type. PCR logs are
+// measured into EventPCRIndex on each of hashAlgos, defaulting to SHA-256. CCMR
+// logs are measured into COSCCELMRIndex (RTMR3), which only supports SHA-384.
+func NewBuilder(mrType cel.MRType, hashAlgos ...crypto.Hash) (*Builder, error) {
+	b := &Builder{registers: make(map[crypto.Hash][]byte)}
+
+	switch mrType {
+	case cel.PCRType:
+		b.log = cel.NewPCR()
+		b.mrIndex = EventPCRIndex
+		if len(hashAlgos) == 0 {
+			hashAlgos = []crypto.Hash{crypto.SHA256}
+		}
+	case cel.CCMRType:
+		b.log = cel.NewConfComputeMR()
+		b.mrIndex = COSCCELMRIndex
+		if len(hashAlgos) == 0 {
+			hashAlgos = []crypto.Hash{crypto.SHA384}
+		}
+		if len(hashAlgos) != 1 || hashAlgos[0] != crypto.SHA384 {
+			return nil, fmt.Errorf("CCMR COS CEL only supports SHA-384, got %v", hashAlgos)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported MR type %d", mrType)
+	}
+
+	for _, hashAlgo := range hashAlgos {
+		if _, err := tcgHashAlgo(hashAlgo); err != nil {
+			return nil, err
+		}
+		b.registers[hashAlgo] = make([]byte, hashAlgo.Size())
+	}
+	b.hashAlgos = hashAlgos
+	return b, nil
+}
+
+// Append measures the event into the expected registers and appends it to the CEL.
+func (b *Builder) Append(event COSTLV) error {
+	return b.log.AppendEvent(event, b.hashAlgos, b.mrIndex, func(hashAlgo crypto.Hash, _ int, digest []byte) error {
+		hash := hashAlgo.New()
+		hash.Write(b.registers[hashAlgo])
+		hash.Write(digest)
+		b.registers[hashAlgo] = hash.Sum(nil)
+		return nil
+	})
+}
+
+// AppendImageRef appends an ImageRefType event.
+func (b *Builder) AppendImageRef(imageRef string) error {
+	return b.Append(COSTLV{EventType: ImageRefType, EventContent: []byte(imageRef)})
+}
+
+// AppendImageDigest appends an ImageDigestType event.
+func (b *Builder) AppendImageDigest(imageDigest string) error {
+	return b.Append(COSTLV{EventType: ImageDigestType, EventContent: []byte(imageDigest)})
+}
+
+// AppendRestartPolicy appends a RestartPolicyType event.
+func (b *Builder) AppendRestartPolicy(restartPolicy pb.RestartPolicy) error {
+	return b.Append(COSTLV{EventType: RestartPolicyType, EventContent: []byte(restartPolicy.String())})
+}
+
+// AppendImageID appends an ImageIDType event.
+func (b *Builder) AppendImageID(imageID string) error {
+	return b.Append(COSTLV{EventType: ImageIDType, EventContent: []byte(imageID)})
+}
+
+// AppendArg appends an ArgType event.
+func (b *Builder) AppendArg(arg string) error {
+	return b.Append(COSTLV{EventType: ArgType, EventContent: []byte(arg)})
+}
+
+// AppendEnvVar appends an EnvVarType event, or returns an error if the name or
+// value is invalid.
+func (b *Builder) AppendEnvVar(name, value string) error {
+	envVar, err := FormatEnvVar(name, value)
+	if err != nil {
+		return err
+	}
+	return b.Append(COSTLV{EventType: EnvVarType, EventContent: []byte(envVar)})
+}
+
+// AppendOverrideArg appends an OverrideArgType event.
+func (b *Builder) AppendOverrideArg(arg string) error {
+	return b.Append(COSTLV{EventType: OverrideArgType, EventContent: []byte(arg)})
+}
+
+// AppendOverrideEnv appends an OverrideEnvType event, or returns an error if the
+// name or value is invalid.
+func (b *Builder) AppendOverrideEnv(name, value string) error {
+	envVar, err := FormatEnvVar(name, value)
+	if err != nil {
+		return err
+	}
+	return b.Append(COSTLV{EventType: OverrideEnvType, EventContent: []byte(envVar)})
+}
+
+// AppendSeparator appends a LaunchSeparatorType event.
+func (b *Builder) AppendSeparator() error {
+	return b.Append(COSTLV{EventType: LaunchSeparatorType})
+}
+
+// AppendMemoryMonitor appends a MemoryMonitorType event.
+func (b *Builder) AppendMemoryMonitor(enabled bool) error {
+	content := []byte{0}
+	if enabled {
+		content = []byte{1}
+	}
+	return b.Append(COSTLV{EventType: MemoryMonitorType, EventContent: content})
+}
+
+// AppendGpuCCMode appends a GpuCCModeType event.
+func (b *Builder) AppendGpuCCMode(ccMode pb.GPUDeviceCCMode) error {
+	return b.Append(COSTLV{EventType: GpuCCModeType, EventContent: []byte(ccMode.String())})
+}
+
+// AppendGPUDeviceAttestationBinding appends a GPUDeviceAttestationBindingType event
+// binding the GPU attestation report.
+func (b *Builder) AppendGPUDeviceAttestationBinding(report *attestpb.NvidiaAttestationReport) error {
+	content, err := proto.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal GPU attestation report: %v", err)
+	}
+	return b.Append(COSTLV{EventType: GPUDeviceAttestationBindingType, EventContent: content})
+}
+
+// AppendRestartCount appends a ContainerRestartCountType event.
+func (b *Builder) AppendRestartCount(count uint64) error {
+	return b.Append(COSTLV{EventType: ContainerRestartCountType, EventContent: []byte(strconv.FormatUint(count, 10))})
+}
+
+// AppendExitStatus appends a ContainerExitStatusType event.
+func (b *Builder) AppendExitStatus(status int32) error {
+	return b.Append(COSTLV{EventType: ContainerExitStatusType, EventContent: []byte(strconv.FormatInt(int64(status), 10))})
+}
+
+// AppendRuntimeMount appends a RuntimeMountType event, or returns an error if the
+// mount is invalid.
+func (b *Builder) AppendRuntimeMount(mountType, source, destination string) error {
+	mount, err := FormatMount(mountType, source, destination)
+	if err != nil {
+		return err
+	}
+	return b.Append(COSTLV{EventType: RuntimeMountType, EventContent: []byte(mount)})
+}
+
+// CEL returns the built CEL.
+func (b *Builder) CEL() cel.CEL {
+	return b.log
+}
+
+// EncodeCEL returns the encoded CEL.
+func (b *Builder) EncodeCEL() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := b.log.EncodeCEL(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MRBank returns the register bank the CEL is expected to replay against for
+// the given hash algorithm: a PCRBank holding EventPCRIndex for PCR logs, or an
+// RTMRBank holding RTMR3 for CCMR logs.
+func (b *Builder) MRBank(hashAlgo crypto.Hash) (register.MRBank, error) {
+	digest, ok := b.registers[hashAlgo]
+	if !ok {
+		return nil, fmt.Errorf("COS CEL is not measured with %v", hashAlgo)
+	}
+
+	switch b.log.MRType() {
+	case cel.PCRType:
+		tcgHash, err := tcgHashAlgo(hashAlgo)
+		if err != nil {
+			return nil, err
+		}
+		return register.PCRBank{
+			TCGHashAlgo: tcgHash,
+			PCRs:        []register.PCR{{Index: EventPCRIndex, Digest: digest, DigestAlg: hashAlgo}},
+		}, nil
+	case cel.CCMRType:
+		return register.RTMRBank{
+			RTMRs: []register.RTMR{{Index: EventRTMRIndex, Digest: digest}},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported MR type %d", b.log.MRType())
+	}
+}
+
+func tcgHashAlgo(hashAlgo crypto.Hash) (state.HashAlgo, error) {
+	switch hashAlgo {
+	case crypto.SHA1:
+		return state.HashAlgo_SHA1, nil
+	case crypto.SHA256:
+		return state.HashAlgo_SHA256, nil
+	case crypto.SHA384:
+		return state.HashAlgo_SHA384, nil
+	case crypto.SHA512:
+		return state.HashAlgo_SHA512, nil
+	default:
+		return state.HashAlgo_HASH_INVALID, fmt.Errorf("unsupported hash algorithm %v", hashAlgo)
+	}
+}
@@ -0,0 +1,150 @@
+package coscel
+
+import (
+	"bytes"
+	"crypto"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-eventlog/cel"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+// decodeCOSEvents decodes a COS CEL and returns its events.
+func decodeCOSEvents(t *testing.T, rawCEL []byte) (cel.CEL, []COSTLV) {
+	t.Helper()
+	decoded, err := cel.DecodeToCEL(bytes.NewBuffer(rawCEL))
+	if err != nil {
+		t.Fatalf("DecodeToCEL() failed: %v", err)
+	}
+	var events []COSTLV
+	for _, record := range decoded.Records() {
+		event, err := ParseToCOSTLV(record.Content)
+		if err != nil {
+			t.Fatalf("ParseToCOSTLV() failed: %v", err)
+		}
+		events = append(events, event)
+	}
+	return decoded, events
+}
+
+func TestBuilder(t *testing.T) {
+	testcases := []struct {
+		name      string
+		mrType    cel.MRType
+		hashAlgos []crypto.Hash
+		wantAlgos []crypto.Hash
+	}{
+		{"PCR", cel.PCRType, []crypto.Hash{crypto.SHA1, crypto.SHA256}, []crypto.Hash{crypto.SHA1, crypto.SHA256}},
+		{"PCR default", cel.PCRType, nil, []crypto.Hash{crypto.SHA256}},
+		{"CCMR", cel.CCMRType, nil, []crypto.Hash{crypto.SHA384}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := NewBuilder(tc.mrType, tc.hashAlgos...)
+			if err != nil {
+				t.Fatalf("NewBuilder() failed: %v", err)
+			}
+			for _, appendEvent := range []func() error{
+				func() error { return b.AppendImageRef("docker.io/library/hello-world:latest") },
+				func() error { return b.AppendRestartPolicy(pb.RestartPolicy_Always) },
+				func() error { return b.AppendEnvVar("foo", "bar") },
+				func() error { return b.AppendArg("--x") },
+				func() error { return b.AppendMemoryMonitor(true) },
+				func() error { return b.AppendGpuCCMode(pb.GPUDeviceCCMode_ON) },
+				func() error {
+					return b.AppendGPUDeviceAttestationBinding(&attestpb.NvidiaAttestationReport{Nonce: []byte{0xab}})
+				},
+				b.AppendSeparator,
+				func() error { return b.AppendRestartCount(2) },
+				func() error { return b.AppendRuntimeMount("tmpfs", "", "/tmp") },
+			} {
+				if err := appendEvent(); err != nil {
+					t.Fatalf("appending event failed: %v", err)
+				}
+			}
+
+			rawCEL, err := b.EncodeCEL()
+			if err != nil {
+				t.Fatalf("EncodeCEL() failed: %v", err)
+			}
+			decoded, events := decodeCOSEvents(t, rawCEL)
+			var gotTypes []ContentType
+			for _, event := range events {
+				gotTypes = append(gotTypes, event.EventType)
+			}
+			wantTypes := []ContentType{
+				ImageRefType, RestartPolicyType, EnvVarType, ArgType, MemoryMonitorType, GpuCCModeType,
+				GPUDeviceAttestationBindingType, LaunchSeparatorType, ContainerRestartCountType, RuntimeMountType,
+			}
+			if diff := cmp.Diff(wantTypes, gotTypes); diff != "" {
+				t.Errorf("CEL event types mismatch (-want +got):\n%s", diff)
+			}
+			if got := string(events[2].EventContent); got != "foo=bar" {
+				t.Errorf("got env var event %q, want foo=bar", got)
+			}
+
+			for _, hashAlgo := range tc.wantAlgos {
+				bank, err := b.MRBank(hashAlgo)
+				if err != nil {
+					t.Fatalf("MRBank(%v) failed: %v", hashAlgo, err)
+				}
+				if err := decoded.Replay(bank); err != nil {
+					t.Errorf("Replay() against the %v bank failed: %v", hashAlgo, err)
+				}
+			}
+		})
+	}
+}
+
+func TestBuilderMRBankMismatch(t *testing.T) {
+	b, err := NewBuilder(cel.PCRType)
+	if err != nil {
+		t.Fatalf("NewBuilder() failed: %v", err)
+	}
+	if err := b.AppendImageRef("docker.io/library/hello-world:latest"); err != nil {
+		t.Fatalf("AppendImageRef() failed: %v", err)
+	}
+	bank, err := b.MRBank(crypto.SHA256)
+	if err != nil {
+		t.Fatalf("MRBank() failed: %v", err)
+	}
+	// The bank holds the value before the later event.
+	if err := b.AppendArg("--x"); err != nil {
+		t.Fatalf("AppendArg() failed: %v", err)
+	}
+	rawCEL, err := b.EncodeCEL()
+	if err != nil {
+		t.Fatalf("EncodeCEL() failed: %v", err)
+	}
+	decoded, _ := decodeCOSEvents(t, rawCEL)
+	if err := decoded.Replay(bank); err == nil {
+		t.Errorf("Replay() against a stale bank succeeded, want error")
+	}
+}
+
+func TestNewBuilderErrors(t *testing.T) {
+	if _, err := NewBuilder(cel.CCMRType, crypto.SHA256); err == nil {
+		t.Errorf("NewBuilder(CCMRType, SHA256) succeeded, want error")
+	}
+	if _, err := NewBuilder(cel.PCRType, crypto.MD5); err == nil {
+		t.Errorf("NewBuilder(PCRType, MD5) succeeded, want error")
+	}
+	if _, err := NewBuilder(cel.MRType(2)); err == nil {
+		t.Errorf("NewBuilder() with unknown MR type succeeded, want error")
+	}
+
+	b, err := NewBuilder(cel.PCRType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AppendEnvVar("1foo", "bar"); err == nil {
+		t.Errorf("AppendEnvVar() with invalid name succeeded, want error")
+	}
+	if _, err := b.MRBank(crypto.SHA384); err == nil {
+		t.Errorf("MRBank() for unmeasured hash algorithm succeeded, want error")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 
@@ -48,8 +49,38 @@ const (
 	MemoryMonitorType
 	GpuCCModeType
 	GPUDeviceAttestationBindingType
+	// Runtime event types, only valid after the LaunchSeparatorType event.
+	ContainerRestartCountType
+	ContainerExitStatusType
+	RuntimeMountType
 )
 
+var contentTypeNames = map[ContentType]string{
+	ImageRefType:                    "ImageRef",
+	ImageDigestType:                 "ImageDigest",
+	RestartPolicyType:               "RestartPolicy",
+	ImageIDType:                     "ImageID",
+	ArgType:                         "Arg",
+	EnvVarType:                      "EnvVar",
+	OverrideArgType:                 "OverrideArg",
+	OverrideEnvType:                 "OverrideEnv",
+	LaunchSeparatorType:             "LaunchSeparator",
+	MemoryMonitorType:               "MemoryMonitor",
+	GpuCCModeType:                   "GpuCCMode",
+	GPUDeviceAttestationBindingType: "GPUDeviceAttestationBinding",
+	ContainerRestartCountType:       "ContainerRestartCount",
+	ContainerExitStatusType:         "ContainerExitStatus",
+	RuntimeMountType:                "RuntimeMount",
+}
+
+// String returns the name of the content type, or its number if it is unknown.
+func (t ContentType) String() string {
+	if name, ok := contentTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("ContentType(%d)", uint8(t))
+}
+
 // COSTLV is a specific event type created for the COS (Google Container-Optimized OS),
 // used as a CEL content.
 type COSTLV struct {
@@ -59,7 +90,7 @@ type COSTLV struct {
 
 // TLV returns the TLV representation of the COS TLV.
 func (c COSTLV) TLV() (cel.TLV, error) {
-	data, err := cel.TLV{uint8(c.EventType), c.EventContent}.MarshalBinary()
+	data, err := cel.TLV{Type: uint8(c.EventType), Value: c.EventContent}.MarshalBinary()
 	if err != nil {
 		return cel.TLV{}, err
 	}
@@ -141,3 +172,69 @@ func ParseEnvVar(envvar string) (string, string, error) {
 
 	return e[0], e[1], nil
 }
+
+// mountFields are the keys of a measured runtime mount, in order.
+var mountFields = []string{"type", "src", "dst"}
+
+// FormatMount takes in a runtime-mounted volume's type, source and destination, and
+// returns the measured "type=<type>,src=<source>,dst=<destination>" form, or an error
+// if any field is invalid.
+func FormatMount(mountType, source, destination string) (string, error) {
+	for i, field := range []string{mountType, source, destination} {
+		if !utf8.ValidString(field) {
+			return "", fmt.Errorf("malformed mount %s, contains non-utf8 character: [%s]", mountFields[i], field)
+		}
+		if strings.ContainsAny(field, ",=") {
+			return "", fmt.Errorf("malformed mount %s [%s], must not contain ',' or '='", mountFields[i], field)
+		}
+	}
+	if mountType == "" || destination == "" {
+		return "", fmt.Errorf("malformed mount, type and destination must be set")
+	}
+	return "type=" + mountType + ",src=" + source + ",dst=" + destination, nil
+}
+
+// ParseMount takes in a measured runtime mount (type=tmpfs,src=,dst=/tmp), parses it
+// and returns its type, source and destination, or an error if it fails the
+// validation check.
+func ParseMount(mount string) (string, string, string, error) {
+	fields := strings.Split(mount, ",")
+	if len(fields) != 3 {
+		return "", "", "", fmt.Errorf("malformed mount, expected 3 fields: [%s]", mount)
+	}
+
+	var values [3]string
+	for i, key := range mountFields {
+		value, ok := strings.CutPrefix(fields[i], key+"=")
+		if !ok {
+			return "", "", "", fmt.Errorf("malformed mount, expected field %q at position %d: [%s]", key, i, mount)
+		}
+		values[i] = value
+	}
+
+	if _, err := FormatMount(values[0], values[1], values[2]); err != nil {
+		return "", "", "", err
+	}
+
+	return values[0], values[1], values[2], nil
+}
+
+// ParseRestartCount parses the content of a ContainerRestartCountType event, which is
+// the decimal number of times the container has been restarted.
+func ParseRestartCount(content []byte) (uint64, error) {
+	count, err := strconv.ParseUint(string(content), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed restart count [%s]: %v", content, err)
+	}
+	return count, nil
+}
+
+// ParseExitStatus parses the content of a ContainerExitStatusType event, which is the
+// decimal exit status of the container.
+func ParseExitStatus(content []byte) (int32, error) {
+	status, err := strconv.ParseInt(string(content), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("malformed exit status [%s]: %v", content, err)
+	}
+	return int32(status), nil
+}
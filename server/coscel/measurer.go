@@ -0,0 +1,170 @@
+package coscel
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/google/go-configfs-tsm/configfs/configfsi"
+	"github.com/google/go-configfs-tsm/rtmr"
+	"github.com/google/go-eventlog/cel"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Measurer measures COS events into a measurement register and records them in a CEL.
+type Measurer interface {
+	// Measure extends the event's digests into the register and appends the
+	// event to the CEL. The CEL record is built and validated before the
+	// register is extended, so an event that fails validation or whose extend
+	// fails is not appended. If the event cannot be appended after it was
+	// extended, Measure returns an error wrapping ErrCELOutOfSync.
+	Measure(event COSTLV) error
+	// CEL returns a copy of the CEL of the measured events. It is safe to call
+	// while other goroutines measure events.
+	CEL() (cel.CEL, error)
+}
+
+// ErrCELOutOfSync is returned by Measure when an event was extended into the
+// register but could not be appended to the CEL. The CEL no longer replays
+// against the register, and the Measurer must not be used any further.
+var ErrCELOutOfSync = errors.New("event was extended into the register but not appended to the CEL")
+
+// measurer extends all digests of an event in a single operation, then appends
+// the event, so the CEL never gets out of sync with the register.
+type measurer struct {
+	mu        sync.Mutex
+	log       cel.CEL
+	mrIndex   int
+	hashAlgos []crypto.Hash
+	extend    func(digests map[crypto.Hash][]byte) error
+}
+
+// NewTPMMeasurer returns a Measurer that extends COS events into EventPCRIndex on
+// each of the TPM's hashAlgos banks, defaulting to SHA-256.
+func NewTPMMeasurer(rw io.ReadWriter, hashAlgos ...crypto.Hash) (Measurer, error) {
+	if len(hashAlgos) == 0 {
+		hashAlgos = []crypto.Hash{crypto.SHA256}
+	}
+	for _, hashAlgo := range hashAlgos {
+		if _, err := tpmHashAlgo(hashAlgo); err != nil {
+			return nil, err
+		}
+	}
+
+	tpm := transport.FromReadWriter(rw)
+	return &measurer{
+		log:       cel.NewPCR(),
+		mrIndex:   EventPCRIndex,
+		hashAlgos: hashAlgos,
+		extend: func(digests map[crypto.Hash][]byte) error {
+			values := tpm2.TPMLDigestValues{}
+			for _, hashAlgo := range hashAlgos {
+				tpmAlg, err := tpmHashAlgo(hashAlgo)
+				if err != nil {
+					return err
+				}
+				values.Digests = append(values.Digests, tpm2.TPMTHA{HashAlg: tpmAlg, Digest: digests[hashAlgo]})
+			}
+			_, err := tpm2.PCRExtend{
+				PCRHandle: tpm2.AuthHandle{
+					Handle: tpm2.TPMHandle(EventPCRIndex),
+					Auth:   tpm2.PasswordAuth(nil),
+				},
+				Digests: values,
+			}.Execute(tpm)
+			return err
+		},
+	}, nil
+}
+
+// NewRTMRMeasurer returns a Measurer that extends COS events into RTMR3 through the
+// configfs-tsm client.
+func NewRTMRMeasurer(client configfsi.Client) Measurer {
+	return &measurer{
+		log:       cel.NewConfComputeMR(),
+		mrIndex:   COSCCELMRIndex,
+		hashAlgos: []crypto.Hash{crypto.SHA384},
+		extend: func(digests map[crypto.Hash][]byte) error {
+			return rtmr.ExtendDigest(client, EventRTMRIndex, digests[crypto.SHA384])
+		},
+	}
+}
+
+// Measure extends the event's digests into the register and appends the event
+// to the CEL.
+func (m *measurer) Measure(event COSTLV) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	digests := make(map[crypto.Hash][]byte)
+	for _, hashAlgo := range m.hashAlgos {
+		digest, err := event.GenerateDigest(hashAlgo)
+		if err != nil {
+			return fmt.Errorf("failed to generate %v digest: %v", hashAlgo, err)
+		}
+		digests[hashAlgo] = digest
+	}
+
+	// Build the record in a scratch CEL of the same type first, so that an
+	// event the CEL would reject is never extended.
+	scratch := newCEL(m.log.MRType())
+	if err := scratch.AppendEvent(event, m.hashAlgos, m.mrIndex, noExtend); err != nil {
+		return fmt.Errorf("invalid event: %v", err)
+	}
+
+	if err := m.extend(digests); err != nil {
+		return fmt.Errorf("failed to extend event to MR%d: %v", m.mrIndex, err)
+	}
+
+	// The event is already extended, so the append does not extend it again.
+	if err := m.log.AppendEvent(event, m.hashAlgos, m.mrIndex, noExtend); err != nil {
+		return fmt.Errorf("%w: %v", ErrCELOutOfSync, err)
+	}
+	return nil
+}
+
+func noExtend(crypto.Hash, int, []byte) error { return nil }
+
+// CEL returns a copy of the CEL of the measured events, so that it does not
+// change under the caller as further events are measured.
+func (m *measurer) CEL() (cel.CEL, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	log := newCEL(m.log.MRType())
+	for _, record := range m.log.Records() {
+		event, err := ParseToCOSTLV(record.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CEL record %d: %v", record.RecNum, err)
+		}
+		if err := log.AppendEvent(event, m.hashAlgos, m.mrIndex, noExtend); err != nil {
+			return nil, fmt.Errorf("failed to copy CEL record %d: %v", record.RecNum, err)
+		}
+	}
+	return log, nil
+}
+
+func newCEL(mrType cel.MRType) cel.CEL {
+	if mrType == cel.CCMRType {
+		return cel.NewConfComputeMR()
+	}
+	return cel.NewPCR()
+}
+
+func tpmHashAlgo(hashAlgo crypto.Hash) (tpm2.TPMAlgID, error) {
+	switch hashAlgo {
+	case crypto.SHA1:
+		return tpm2.TPMAlgSHA1, nil
+	case crypto.SHA256:
+		return tpm2.TPMAlgSHA256, nil
+	case crypto.SHA384:
+		return tpm2.TPMAlgSHA384, nil
+	case crypto.SHA512:
+		return tpm2.TPMAlgSHA512, nil
+	default:
+		return 0, fmt.Errorf("unsupported hash algorithm %v", hashAlgo)
+	}
+}
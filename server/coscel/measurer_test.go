@@ -0,0 +1,187 @@
+package coscel
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/go-configfs-tsm/configfs/fakertmr"
+	configfstsmrtmr "github.com/google/go-configfs-tsm/rtmr"
+	"github.com/google/go-eventlog/cel"
+	"github.com/google/go-eventlog/register"
+)
+
+func getRTMRBank(t *testing.T, fakeRTMR *fakertmr.RtmrSubsystem) register.RTMRBank {
+	rtmrBank := register.RTMRBank{}
+	// RTMR 0 to 3
+	for i := 0; i < 4; i++ {
+		digest, err := configfstsmrtmr.GetDigest(fakeRTMR, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rtmrBank.RTMRs = append(rtmrBank.RTMRs, register.RTMR{Index: i, Digest: digest.Digest})
+	}
+	return rtmrBank
+}
+
+func TestRTMRMeasurer(t *testing.T) {
+	fakeRTMR := fakertmr.CreateRtmrSubsystem(t.TempDir())
+	measurer := NewRTMRMeasurer(fakeRTMR)
+
+	events := []COSTLV{
+		{EventType: ImageRefType, EventContent: []byte("docker.io/bazel/experimental/test:latest")},
+		{EventType: EnvVarType, EventContent: []byte("foo=bar")},
+		{EventType: LaunchSeparatorType},
+	}
+	for _, event := range events {
+		if err := measurer.Measure(event); err != nil {
+			t.Fatalf("Measure() failed: %v", err)
+		}
+	}
+
+	log, err := measurer.CEL()
+	if err != nil {
+		t.Fatalf("CEL() failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := log.EncodeCEL(&buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := cel.DecodeToCEL(&buf)
+	if err != nil {
+		t.Fatalf("DecodeToCEL() failed: %v", err)
+	}
+	if got := decoded.MRType(); got != cel.CCMRType {
+		t.Errorf("got CEL MR type %v, want %v", got, cel.CCMRType)
+	}
+	if got := len(decoded.Records()); got != len(events) {
+		t.Fatalf("got %d CEL records, want %d", got, len(events))
+	}
+	for i, record := range decoded.Records() {
+		if record.Index != COSCCELMRIndex {
+			t.Errorf("record %d: got MR index %d, want %d", i, record.Index, COSCCELMRIndex)
+		}
+	}
+	if err := decoded.Replay(getRTMRBank(t, fakeRTMR)); err != nil {
+		t.Errorf("Replay() against the RTMRs failed: %v", err)
+	}
+}
+
+func TestMeasureExtendFailure(t *testing.T) {
+	failExtend := false
+	m := &measurer{
+		log:       cel.NewConfComputeMR(),
+		mrIndex:   COSCCELMRIndex,
+		hashAlgos: []crypto.Hash{crypto.SHA384},
+		extend: func(map[crypto.Hash][]byte) error {
+			if failExtend {
+				return errors.New("extend failed")
+			}
+			return nil
+		},
+	}
+
+	if err := m.Measure(COSTLV{EventType: ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")}); err != nil {
+		t.Fatalf("Measure() failed: %v", err)
+	}
+	failExtend = true
+	if err := m.Measure(COSTLV{EventType: ArgType, EventContent: []byte("--x")}); err == nil {
+		t.Errorf("Measure() with a failing extend succeeded, want error")
+	}
+	log, err := m.CEL()
+	if err != nil {
+		t.Fatalf("CEL() failed: %v", err)
+	}
+	if got := len(log.Records()); got != 1 {
+		t.Errorf("got %d CEL records after a failed extend, want 1", got)
+	}
+}
+
+func TestMeasureInvalidEventNotExtended(t *testing.T) {
+	extended := false
+	m := &measurer{
+		log: cel.NewConfComputeMR(),
+		// The CEL rejects a negative MR index.
+		mrIndex:   -1,
+		hashAlgos: []crypto.Hash{crypto.SHA384},
+		extend: func(map[crypto.Hash][]byte) error {
+			extended = true
+			return nil
+		},
+	}
+
+	err := m.Measure(COSTLV{EventType: ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")})
+	if err == nil {
+		t.Fatalf("Measure() of an invalid record succeeded, want error")
+	}
+	if errors.Is(err, ErrCELOutOfSync) {
+		t.Errorf("Measure() = %v, want an error before the extend", err)
+	}
+	if extended {
+		t.Errorf("Measure() extended an event the CEL rejects")
+	}
+	log, err := m.CEL()
+	if err != nil {
+		t.Fatalf("CEL() failed: %v", err)
+	}
+	if got := len(log.Records()); got != 0 {
+		t.Errorf("got %d CEL records, want 0", got)
+	}
+}
+
+func TestNewTPMMeasurerUnsupportedHash(t *testing.T) {
+	if _, err := NewTPMMeasurer(nil, crypto.MD5); err == nil {
+		t.Errorf("NewTPMMeasurer(MD5) succeeded, want error")
+	}
+}
+
+func TestMeasurerCELConcurrentMeasure(t *testing.T) {
+	m := &measurer{
+		log:       cel.NewConfComputeMR(),
+		mrIndex:   COSCCELMRIndex,
+		hashAlgos: []crypto.Hash{crypto.SHA384},
+		extend:    func(map[crypto.Hash][]byte) error { return nil },
+	}
+
+	const numEvents = 50
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < numEvents; i++ {
+			if err := m.Measure(COSTLV{EventType: ArgType, EventContent: []byte(fmt.Sprintf("--arg%d", i))}); err != nil {
+				t.Errorf("Measure() failed: %v", err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < numEvents; i++ {
+		if _, err := m.CEL(); err != nil {
+			t.Errorf("CEL() failed: %v", err)
+		}
+	}
+	wg.Wait()
+
+	log, err := m.CEL()
+	if err != nil {
+		t.Fatalf("CEL() failed: %v", err)
+	}
+	if got := len(log.Records()); got != numEvents {
+		t.Fatalf("got %d CEL records, want %d", got, numEvents)
+	}
+
+	// Appending to the returned copy must not change the measured CEL.
+	if err := log.AppendEvent(COSTLV{EventType: LaunchSeparatorType}, m.hashAlgos, m.mrIndex, noExtend); err != nil {
+		t.Fatal(err)
+	}
+	again, err := m.CEL()
+	if err != nil {
+		t.Fatalf("CEL() failed: %v", err)
+	}
+	if got := len(again.Records()); got != numEvents {
+		t.Errorf("got %d CEL records after appending to a copy, want %d", got, numEvents)
+	}
+}
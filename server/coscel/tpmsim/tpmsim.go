@@ -0,0 +1,45 @@
+// Package tpmsim provides a COS event Measurer backed by the go-tpm-tools TPM
+// simulator, so that COS launches can be measured and quoted without hardware.
+package tpmsim
+
+import (
+	"crypto"
+	"io"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-tpm-tools/simulator"
+)
+
+// Measurer is a coscel.Measurer that measures into PCR 13 of a simulated TPM.
+type Measurer struct {
+	coscel.Measurer
+	sim *simulator.Simulator
+}
+
+// NewMeasurer starts a TPM simulator and returns a Measurer for it. PCR 13 is
+// extended on each of hashAlgos, defaulting to SHA-256. The caller must Close
+// the Measurer.
+func NewMeasurer(hashAlgos ...crypto.Hash) (*Measurer, error) {
+	sim, err := simulator.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := coscel.NewTPMMeasurer(sim, hashAlgos...)
+	if err != nil {
+		sim.Close()
+		return nil, err
+	}
+	return &Measurer{Measurer: m, sim: sim}, nil
+}
+
+// TPM returns the simulated TPM, e.g. for creating an attestation key and
+// quoting the measured PCRs.
+func (m *Measurer) TPM() io.ReadWriter {
+	return m.sim
+}
+
+// Close closes the simulated TPM.
+func (m *Measurer) Close() error {
+	return m.sim.Close()
+}
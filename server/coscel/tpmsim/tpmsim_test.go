@@ -0,0 +1,106 @@
+package tpmsim
+
+import (
+	"bytes"
+	"crypto"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/GoogleCloudPlatform/confidential-space/server/extract"
+	"github.com/google/go-eventlog/proto/state"
+	"github.com/google/go-eventlog/register"
+	"github.com/google/go-tpm-tools/client"
+	"github.com/google/go-tpm/legacy/tpm2"
+
+	tpmquote "github.com/google/go-tpm-tools/quote"
+)
+
+func TestMeasureQuoteParse(t *testing.T) {
+	m, err := NewMeasurer(crypto.SHA1, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("NewMeasurer() failed: %v", err)
+	}
+	defer m.Close()
+
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+		{EventType: coscel.LaunchSeparatorType},
+		{EventType: coscel.ContainerRestartCountType, EventContent: []byte("1")},
+	}
+	for _, event := range events {
+		if err := m.Measure(event); err != nil {
+			t.Fatalf("Measure() failed: %v", err)
+		}
+	}
+
+	log, err := m.CEL()
+	if err != nil {
+		t.Fatalf("CEL() failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := log.EncodeCEL(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	ak, err := client.AttestationKeyECC(m.TPM())
+	if err != nil {
+		t.Fatalf("failed to create AK: %v", err)
+	}
+	defer ak.Close()
+
+	nonce := []byte("nonce")
+	for _, alg := range []tpm2.Algorithm{tpm2.AlgSHA1, tpm2.AlgSHA256} {
+		quote, err := ak.Quote(tpm2.PCRSelection{Hash: alg, PCRs: []int{coscel.EventPCRIndex}}, nonce)
+		if err != nil {
+			t.Fatalf("failed to quote: %v", err)
+		}
+		if err := tpmquote.Verify(quote, ak.PublicKey(), nonce); err != nil {
+			t.Fatalf("failed to verify quote: %v", err)
+		}
+
+		pcrBank := register.PCRBank{TCGHashAlgo: state.HashAlgo(quote.GetPcrs().GetHash())}
+		digestAlg, err := pcrBank.TCGHashAlgo.CryptoHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for index, digest := range quote.GetPcrs().GetPcrs() {
+			pcrBank.PCRs = append(pcrBank.PCRs, register.PCR{Index: int(index), Digest: digest, DigestAlg: digestAlg})
+		}
+
+		cosState, err := extract.ParseCOSEventLog(buf.Bytes(), pcrBank, extract.Options{})
+		if err != nil {
+			t.Fatalf("ParseCOSEventLog() with %v bank failed: %v", alg, err)
+		}
+		if got := cosState.Cos.GetContainer().GetImageReference(); got != "docker.io/library/hello-world:latest" {
+			t.Errorf("got image reference %q, want the measured image reference", got)
+		}
+		if got := cosState.Runtime.RestartCount; got != 1 {
+			t.Errorf("got restart count %d, want 1", got)
+		}
+	}
+}
+
+func TestMeasureFailureDoesNotAppend(t *testing.T) {
+	m, err := NewMeasurer()
+	if err != nil {
+		t.Fatalf("NewMeasurer() failed: %v", err)
+	}
+	if err := m.Measure(coscel.COSTLV{EventType: coscel.ImageRefType, EventContent: []byte("image")}); err != nil {
+		t.Fatalf("Measure() failed: %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Measure(coscel.COSTLV{EventType: coscel.ArgType, EventContent: []byte("--x")}); err == nil {
+		t.Fatalf("Measure() on closed TPM succeeded, want error")
+	}
+	log, err := m.CEL()
+	if err != nil {
+		t.Fatalf("CEL() failed: %v", err)
+	}
+	if got := len(log.Records()); got != 1 {
+		t.Errorf("got %d CEL records after failed Measure(), want 1", got)
+	}
+}
@@ -0,0 +1,494 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// QEMU fw_cfg files of the ACPI data.
+const (
+	ACPIRSDPFile   = "etc/acpi/rsdp"
+	ACPITablesFile = "etc/acpi/tables"
+)
+
+// LoaderCommandType is the command of a QEMU etc/table-loader entry.
+type LoaderCommandType uint32
+
+// Commands of the QEMU BIOS linker/loader, see QEMU hw/acpi/bios-linker-loader.c.
+const (
+	LoaderAllocate     LoaderCommandType = 1
+	LoaderAddPointer   LoaderCommandType = 2
+	LoaderAddChecksum  LoaderCommandType = 3
+	LoaderWritePointer LoaderCommandType = 4
+)
+
+func (t LoaderCommandType) String() string {
+	switch t {
+	case LoaderAllocate:
+		return "ALLOCATE"
+	case LoaderAddPointer:
+		return "ADD_POINTER"
+	case LoaderAddChecksum:
+		return "ADD_CHECKSUM"
+	case LoaderWritePointer:
+		return "WRITE_POINTER"
+	default:
+		return fmt.Sprintf("LoaderCommandType(%d)", uint32(t))
+	}
+}
+
+// Allocation zones of the ALLOCATE command.
+const (
+	LoaderZoneHigh = 1
+	LoaderZoneFSeg = 2
+)
+
+const (
+	loaderEntrySize    = 128
+	loaderFileNameSize = 56
+)
+
+// LoaderCommand is a decoded etc/table-loader entry.
+type LoaderCommand struct {
+	Command LoaderCommandType
+	// File is the allocated file of ALLOCATE, the checksummed file of
+	// ADD_CHECKSUM, and the patched destination file of ADD_POINTER and
+	// WRITE_POINTER.
+	File string
+	// SrcFile is the file pointed to by ADD_POINTER and WRITE_POINTER.
+	SrcFile string
+	// Align and Zone are the ALLOCATE alignment and zone.
+	Align uint32
+	Zone  uint8
+	// Offset is the offset of the pointer of ADD_POINTER and WRITE_POINTER, or
+	// of the checksum of ADD_CHECKSUM, in File.
+	Offset uint32
+	// SrcOffset is the WRITE_POINTER offset in SrcFile.
+	SrcOffset uint32
+	// Start and Length are the ADD_CHECKSUM range in File.
+	Start  uint32
+	Length uint32
+	// Size is the pointer size of ADD_POINTER and WRITE_POINTER.
+	Size uint8
+}
+
+// ParseTableLoader decodes the QEMU etc/table-loader commands of the AcpiData
+// table_loader. Unknown commands are rejected.
+func ParseTableLoader(raw []byte) ([]LoaderCommand, error) {
+	if len(raw)%loaderEntrySize != 0 {
+		return nil, fmt.Errorf("table loader has %d bytes, want a multiple of %d", len(raw), loaderEntrySize)
+	}
+
+	var commands []LoaderCommand
+	for i := 0; i < len(raw); i += loaderEntrySize {
+		entry := raw[i : i+loaderEntrySize]
+		cmd := LoaderCommand{Command: LoaderCommandType(binary.LittleEndian.Uint32(entry))}
+		body := entry[4:]
+		switch cmd.Command {
+		case LoaderAllocate:
+			cmd.File = loaderFileName(body)
+			cmd.Align = binary.LittleEndian.Uint32(body[56:])
+			cmd.Zone = body[60]
+		case LoaderAddPointer:
+			cmd.File = loaderFileName(body)
+			cmd.SrcFile = loaderFileName(body[56:])
+			cmd.Offset = binary.LittleEndian.Uint32(body[112:])
+			cmd.Size = body[116]
+		case LoaderAddChecksum:
+			cmd.File = loaderFileName(body)
+			cmd.Offset = binary.LittleEndian.Uint32(body[56:])
+			cmd.Start = binary.LittleEndian.Uint32(body[60:])
+			cmd.Length = binary.LittleEndian.Uint32(body[64:])
+		case LoaderWritePointer:
+			cmd.File = loaderFileName(body)
+			cmd.SrcFile = loaderFileName(body[56:])
+			cmd.Offset = binary.LittleEndian.Uint32(body[112:])
+			cmd.SrcOffset = binary.LittleEndian.Uint32(body[116:])
+			cmd.Size = body[120]
+		default:
+			return nil, fmt.Errorf("unknown table loader command %d at entry %d", uint32(cmd.Command), i/loaderEntrySize)
+		}
+		commands = append(commands, cmd)
+	}
+	return commands, nil
+}
+
+func loaderFileName(b []byte) string {
+	name := b[:loaderFileNameSize]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	return string(name)
+}
+
+// Synthetic base addresses of the allocation zones. The firmware picks the real
+// addresses, which only shift the pointer values.
+const (
+	fsegBase = 0xE0000
+	fsegEnd  = 0x100000
+	highBase = 0x7F000000
+)
+
+// loadedFile is a file allocated by the table loader.
+type loadedFile struct {
+	data []byte
+	base uint64
+}
+
+// applyTableLoader runs the table loader commands over copies of the files the
+// way the firmware does, and returns the allocated files. Pointers and
+// checksums may only reference ranges within the provided files.
+//
+// QEMU also allocates files whose contents are not part of the AcpiData and
+// points tables into them, see uncarriedFileTables. Their size and address are
+// unknown, so pointers into them are zeroed rather than given an address that
+// could alias a provided file, and pointers within them are not patched. Any
+// other pointer into such a file is rejected, so that the RSDP, the root tables
+// and the FADT cannot point at unverified data.
+func applyTableLoader(commands []LoaderCommand, files map[string][]byte) (map[string]*loadedFile, error) {
+	loaded := make(map[string]*loadedFile)
+	nextBase := map[uint8]uint64{LoaderZoneFSeg: fsegBase, LoaderZoneHigh: highBase}
+
+	// The layout of the unpatched tables file, to find the table a pointer
+	// into an uncarried file belongs to.
+	var tables []ACPITable
+	tablesParsed := false
+
+	allocated := func(name string) (*loadedFile, error) {
+		file, ok := loaded[name]
+		if !ok {
+			return nil, fmt.Errorf("file %q is not allocated", name)
+		}
+		return file, nil
+	}
+
+	for i, cmd := range commands {
+		switch cmd.Command {
+		case LoaderAllocate:
+			if _, ok := loaded[cmd.File]; ok {
+				return nil, fmt.Errorf("command %d: file %q allocated twice", i, cmd.File)
+			}
+			base, ok := nextBase[cmd.Zone]
+			if !ok {
+				return nil, fmt.Errorf("command %d: unknown allocation zone %d", i, cmd.Zone)
+			}
+			if cmd.Align == 0 || cmd.Align&(cmd.Align-1) != 0 {
+				return nil, fmt.Errorf("command %d: invalid alignment %d", i, cmd.Align)
+			}
+			base = (base + uint64(cmd.Align) - 1) &^ (uint64(cmd.Align) - 1)
+			file := &loadedFile{base: base}
+			if data, ok := files[cmd.File]; ok {
+				file.data = append([]byte{}, data...)
+			}
+			nextBase[cmd.Zone] = base + uint64(len(file.data))
+			if cmd.Zone == LoaderZoneFSeg && nextBase[cmd.Zone] > fsegEnd {
+				return nil, fmt.Errorf("command %d: file %q does not fit in the FSEG zone", i, cmd.File)
+			}
+			loaded[cmd.File] = file
+
+		case LoaderAddPointer:
+			dst, err := allocated(cmd.File)
+			if err != nil {
+				return nil, fmt.Errorf("command %d: %v", i, err)
+			}
+			src, err := allocated(cmd.SrcFile)
+			if err != nil {
+				return nil, fmt.Errorf("command %d: %v", i, err)
+			}
+			if !validPointerSize(cmd.Size) {
+				return nil, fmt.Errorf("command %d: invalid pointer size %d", i, cmd.Size)
+			}
+			if dst.data == nil {
+				continue
+			}
+			if src.data == nil {
+				if !tablesParsed {
+					var err error
+					if tables, err = parseACPITables(files[ACPITablesFile], false); err != nil {
+						return nil, fmt.Errorf("command %d: invalid ACPI tables: %v", i, err)
+					}
+					tablesParsed = true
+				}
+				if err := checkUncarriedPointer(cmd, tables); err != nil {
+					return nil, fmt.Errorf("command %d: %v", i, err)
+				}
+				if err := writePointer(dst.data, cmd.Offset, cmd.Size, 0); err != nil {
+					return nil, fmt.Errorf("command %d: %v", i, err)
+				}
+				continue
+			}
+			pointer, err := readPointer(dst.data, cmd.Offset, cmd.Size)
+			if err != nil {
+				return nil, fmt.Errorf("command %d: %v", i, err)
+			}
+			if pointer >= uint64(len(src.data)) {
+				return nil, fmt.Errorf("command %d: pointer at %q offset %d points to offset %d, outside %q of %d bytes",
+					i, cmd.File, cmd.Offset, pointer, cmd.SrcFile, len(src.data))
+			}
+			if err := writePointer(dst.data, cmd.Offset, cmd.Size, src.base+pointer); err != nil {
+				return nil, fmt.Errorf("command %d: %v", i, err)
+			}
+
+		case LoaderAddChecksum:
+			file, err := allocated(cmd.File)
+			if err != nil {
+				return nil, fmt.Errorf("command %d: %v", i, err)
+			}
+			if file.data == nil {
+				return nil, fmt.Errorf("command %d: checksummed file %q is not provided", i, cmd.File)
+			}
+			if uint64(cmd.Start)+uint64(cmd.Length) > uint64(len(file.data)) || cmd.Offset >= uint32(len(file.data)) {
+				return nil, fmt.Errorf("command %d: checksum of %q range [%d, %d) at offset %d is outside the file of %d bytes",
+					i, cmd.File, cmd.Start, uint64(cmd.Start)+uint64(cmd.Length), cmd.Offset, len(file.data))
+			}
+			file.data[cmd.Offset] -= acpiChecksum(file.data[cmd.Start : cmd.Start+cmd.Length])
+
+		case LoaderWritePointer:
+			// The destination is a writable fw_cfg file read back by the host,
+			// so only the source range is checked, if the source is provided.
+			src, err := allocated(cmd.SrcFile)
+			if err != nil {
+				return nil, fmt.Errorf("command %d: %v", i, err)
+			}
+			if !validPointerSize(cmd.Size) {
+				return nil, fmt.Errorf("command %d: invalid pointer size %d", i, cmd.Size)
+			}
+			if src.data != nil && uint64(cmd.SrcOffset) >= uint64(len(src.data)) {
+				return nil, fmt.Errorf("command %d: pointer to %q offset %d is outside the file of %d bytes", i, cmd.SrcFile, cmd.SrcOffset, len(src.data))
+			}
+
+		default:
+			return nil, fmt.Errorf("command %d: unknown table loader command %d", i, uint32(cmd.Command))
+		}
+	}
+	return loaded, nil
+}
+
+// uncarriedFileTables are the files QEMU allocates without carrying them in the
+// AcpiData, and the tables that may point into them: the TPM2 or TCPA log area
+// points into the TPM event log, and the VGIA of the vmgenid SSDT into the VM
+// generation ID buffer.
+var uncarriedFileTables = map[string]func(ACPITable) bool{
+	"etc/tpm/log": func(table ACPITable) bool {
+		return table.Signature == "TPM2" || table.Signature == "TCPA"
+	},
+	"etc/vmgenid_guid": func(table ACPITable) bool {
+		return table.Signature == "SSDT" && table.OEMTableID == "VMGENID"
+	},
+}
+
+// checkUncarriedPointer checks that an ADD_POINTER into a file the AcpiData does
+// not carry patches the body of a table allowed to point into that file.
+func checkUncarriedPointer(cmd LoaderCommand, tables []ACPITable) error {
+	allowed, ok := uncarriedFileTables[cmd.SrcFile]
+	if !ok || cmd.File != ACPITablesFile {
+		return fmt.Errorf("pointer at %q offset %d points into %q, which the AcpiData does not carry", cmd.File, cmd.Offset, cmd.SrcFile)
+	}
+	start, end := uint64(cmd.Offset), uint64(cmd.Offset)+uint64(cmd.Size)
+	for _, table := range tables {
+		if start < uint64(table.Offset) || end > uint64(table.Offset)+uint64(table.Length) {
+			continue
+		}
+		if !allowed(table) || start < uint64(table.Offset)+acpiHeaderSize {
+			return fmt.Errorf("pointer at %q offset %d in the %s table may not point into %q", cmd.File, cmd.Offset, table.Signature, cmd.SrcFile)
+		}
+		return nil
+	}
+	return fmt.Errorf("pointer at %q offset %d into %q is not within a table", cmd.File, cmd.Offset, cmd.SrcFile)
+}
+
+func validPointerSize(size uint8) bool {
+	return size == 1 || size == 2 || size == 4 || size == 8
+}
+
+func readPointer(data []byte, offset uint32, size uint8) (uint64, error) {
+	if !validPointerSize(size) {
+		return 0, fmt.Errorf("invalid pointer size %d", size)
+	}
+	if uint64(offset)+uint64(size) > uint64(len(data)) {
+		return 0, fmt.Errorf("pointer at offset %d of size %d is outside the file of %d bytes", offset, size, len(data))
+	}
+	var buf [8]byte
+	copy(buf[:], data[offset:offset+uint32(size)])
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+func writePointer(data []byte, offset uint32, size uint8, value uint64) error {
+	if !validPointerSize(size) {
+		return fmt.Errorf("invalid pointer size %d", size)
+	}
+	if uint64(offset)+uint64(size) > uint64(len(data)) {
+		return fmt.Errorf("pointer at offset %d of size %d is outside the file of %d bytes", offset, size, len(data))
+	}
+	if size < 8 && value>>(8*uint(size)) != 0 {
+		return fmt.Errorf("address 0x%x does not fit in a %d byte pointer", value, size)
+	}
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], value)
+	copy(data[offset:offset+uint32(size)], buf[:size])
+	return nil
+}
+
+// RSDP layout, see the ACPI specification 5.2.5.3.
+const (
+	rsdpSignature         = "RSD PTR "
+	rsdpV1Size            = 20
+	rsdpV2Size            = 36
+	rsdpRevisionOffset    = 15
+	rsdpRSDTAddressOffset = 16
+	rsdpLengthOffset      = 20
+	rsdpXSDTAddressOffset = 24
+)
+
+// FADT pointer fields, see the ACPI specification 5.2.9.
+const (
+	fadtFirmwareCtrlOffset  = 36
+	fadtDSDTOffset          = 40
+	fadtXFirmwareCtrlOffset = 132
+	fadtXDSDTOffset         = 140
+)
+
+// acpiLayout is the table layout reachable from the patched RSDP.
+type acpiLayout struct {
+	root    ACPITable
+	entries []ACPITable
+}
+
+// verifyACPILayout checks the table layout reachable from the patched RSDP: the
+// RSDP, the XSDT or RSDT it points to and the FADT must have valid checksums,
+// and every pointer must point to the start of a table in the tables file.
+func verifyACPILayout(loaded map[string]*loadedFile) (*acpiLayout, error) {
+	rsdpFile, ok := loaded[ACPIRSDPFile]
+	if !ok || rsdpFile.data == nil {
+		return nil, fmt.Errorf("table loader does not allocate %q", ACPIRSDPFile)
+	}
+	tablesFile, ok := loaded[ACPITablesFile]
+	if !ok || tablesFile.data == nil {
+		return nil, fmt.Errorf("table loader does not allocate %q", ACPITablesFile)
+	}
+
+	// After the table loader ran, every table must have a valid checksum.
+	tables, err := parseACPITables(tablesFile.data, true)
+	if err != nil {
+		return nil, fmt.Errorf("invalid patched ACPI tables: %v", err)
+	}
+	tableAt := func(address uint64) (ACPITable, error) {
+		if address < tablesFile.base || address >= tablesFile.base+uint64(len(tablesFile.data)) {
+			return ACPITable{}, fmt.Errorf("address 0x%x is outside %q", address, ACPITablesFile)
+		}
+		offset := int(address - tablesFile.base)
+		for _, table := range tables {
+			if table.Offset == offset {
+				return table, nil
+			}
+		}
+		return ACPITable{}, fmt.Errorf("address 0x%x does not point to the start of a table", address)
+	}
+
+	rsdp := rsdpFile.data
+	if len(rsdp) < rsdpV1Size || string(rsdp[:8]) != rsdpSignature {
+		return nil, fmt.Errorf("invalid RSDP")
+	}
+	if acpiChecksum(rsdp[:rsdpV1Size]) != 0 {
+		return nil, fmt.Errorf("RSDP has an invalid checksum")
+	}
+
+	layout := &acpiLayout{}
+	entrySize := 4
+	rootSignature := "RSDT"
+	if rsdp[rsdpRevisionOffset] >= 2 {
+		if len(rsdp) < rsdpV2Size {
+			return nil, fmt.Errorf("RSDP revision %d has %d bytes, want %d", rsdp[rsdpRevisionOffset], len(rsdp), rsdpV2Size)
+		}
+		length := binary.LittleEndian.Uint32(rsdp[rsdpLengthOffset:])
+		if length < rsdpV2Size || length > uint32(len(rsdp)) {
+			return nil, fmt.Errorf("RSDP has invalid length %d", length)
+		}
+		if acpiChecksum(rsdp[:length]) != 0 {
+			return nil, fmt.Errorf("RSDP has an invalid extended checksum")
+		}
+		// A revision 2 RSDP must point to an XSDT; falling back to the RSDT
+		// would let a zero XSDT address hide the root table actually used.
+		xsdt := binary.LittleEndian.Uint64(rsdp[rsdpXSDTAddressOffset:])
+		if layout.root, err = tableAt(xsdt); err != nil {
+			return nil, fmt.Errorf("invalid RSDP XSDT address: %v", err)
+		}
+		entrySize = 8
+		rootSignature = "XSDT"
+	}
+	if rootSignature == "RSDT" {
+		rsdt := uint64(binary.LittleEndian.Uint32(rsdp[rsdpRSDTAddressOffset:]))
+		if layout.root, err = tableAt(rsdt); err != nil {
+			return nil, fmt.Errorf("invalid RSDP RSDT address: %v", err)
+		}
+	}
+	if layout.root.Signature != rootSignature {
+		return nil, fmt.Errorf("RSDP points to a %q table, want %q", layout.root.Signature, rootSignature)
+	}
+
+	entries := layout.root.Data[acpiHeaderSize:]
+	if len(entries)%entrySize != 0 {
+		return nil, fmt.Errorf("%s has a partial entry", rootSignature)
+	}
+	for i := 0; i < len(entries); i += entrySize {
+		var address uint64
+		if entrySize == 8 {
+			address = binary.LittleEndian.Uint64(entries[i:])
+		} else {
+			address = uint64(binary.LittleEndian.Uint32(entries[i:]))
+		}
+		entry, err := tableAt(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry %d: %v", rootSignature, i/entrySize, err)
+		}
+		if entry.Signature == facsSignature || entry.Signature == "DSDT" {
+			return nil, fmt.Errorf("%s entry %d points to the %s, which is only referenced by the FADT", rootSignature, i/entrySize, entry.Signature)
+		}
+		if entry.Signature == "FACP" {
+			if err := verifyFADTPointers(entry, tableAt); err != nil {
+				return nil, err
+			}
+		}
+		layout.entries = append(layout.entries, entry)
+	}
+	return layout, nil
+}
+
+// verifyFADTPointers checks that the FADT FACS and DSDT pointers point to a FACS
+// and a DSDT in the tables file.
+func verifyFADTPointers(fadt ACPITable, tableAt func(uint64) (ACPITable, error)) error {
+	fields := []struct {
+		name      string
+		offset    int
+		size      int
+		signature string
+	}{
+		{"FIRMWARE_CTRL", fadtFirmwareCtrlOffset, 4, facsSignature},
+		{"DSDT", fadtDSDTOffset, 4, "DSDT"},
+		{"X_FIRMWARE_CTRL", fadtXFirmwareCtrlOffset, 8, facsSignature},
+		{"X_DSDT", fadtXDSDTOffset, 8, "DSDT"},
+	}
+	for _, field := range fields {
+		if len(fadt.Data) < field.offset+field.size {
+			continue
+		}
+		var address uint64
+		if field.size == 8 {
+			address = binary.LittleEndian.Uint64(fadt.Data[field.offset:])
+		} else {
+			address = uint64(binary.LittleEndian.Uint32(fadt.Data[field.offset:]))
+		}
+		if address == 0 {
+			continue
+		}
+		table, err := tableAt(address)
+		if err != nil {
+			return fmt.Errorf("invalid FADT %s: %v", field.name, err)
+		}
+		if table.Signature != field.signature {
+			return fmt.Errorf("FADT %s points to a %q table, want %q", field.name, table.Signature, field.signature)
+		}
+	}
+	return nil
+}
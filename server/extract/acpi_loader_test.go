@@ -0,0 +1,507 @@
+package extract
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+)
+
+func loaderFile(b []byte, name string) {
+	copy(b[:loaderFileNameSize], name)
+}
+
+func loaderEntry(cmd LoaderCommand) []byte {
+	entry := make([]byte, loaderEntrySize)
+	binary.LittleEndian.PutUint32(entry, uint32(cmd.Command))
+	body := entry[4:]
+	switch cmd.Command {
+	case LoaderAllocate:
+		loaderFile(body, cmd.File)
+		binary.LittleEndian.PutUint32(body[56:], cmd.Align)
+		body[60] = cmd.Zone
+	case LoaderAddPointer:
+		loaderFile(body, cmd.File)
+		loaderFile(body[56:], cmd.SrcFile)
+		binary.LittleEndian.PutUint32(body[112:], cmd.Offset)
+		body[116] = cmd.Size
+	case LoaderAddChecksum:
+		loaderFile(body, cmd.File)
+		binary.LittleEndian.PutUint32(body[56:], cmd.Offset)
+		binary.LittleEndian.PutUint32(body[60:], cmd.Start)
+		binary.LittleEndian.PutUint32(body[64:], cmd.Length)
+	case LoaderWritePointer:
+		loaderFile(body, cmd.File)
+		loaderFile(body[56:], cmd.SrcFile)
+		binary.LittleEndian.PutUint32(body[112:], cmd.Offset)
+		binary.LittleEndian.PutUint32(body[116:], cmd.SrcOffset)
+		body[120] = cmd.Size
+	}
+	return entry
+}
+
+func encodeTableLoader(commands []LoaderCommand) []byte {
+	var raw []byte
+	for _, cmd := range commands {
+		raw = append(raw, loaderEntry(cmd)...)
+	}
+	return raw
+}
+
+// testACPIBuild is an ACPI build the way QEMU generates it: tables with zero
+// checksums and unpatched pointers holding offsets into the tables blob, and
+// the table loader commands that patch them.
+type testACPIBuild struct {
+	rsdp     []byte
+	tables   []byte
+	commands []LoaderCommand
+}
+
+func (b *testACPIBuild) addTable(table []byte) uint32 {
+	offset := uint32(len(b.tables))
+	b.tables = append(b.tables, table...)
+	return offset
+}
+
+func (b *testACPIBuild) addPointer(file string, offset uint32, size uint8, srcOffset uint64) {
+	data := b.tables
+	if file == ACPIRSDPFile {
+		data = b.rsdp
+	}
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], srcOffset)
+	copy(data[offset:offset+uint32(size)], buf[:size])
+	b.commands = append(b.commands, LoaderCommand{Command: LoaderAddPointer, File: file, SrcFile: ACPITablesFile, Offset: offset, Size: size})
+}
+
+func (b *testACPIBuild) addTableChecksum(offset uint32) {
+	length := binary.LittleEndian.Uint32(b.tables[offset+4:])
+	b.commands = append(b.commands, LoaderCommand{Command: LoaderAddChecksum, File: ACPITablesFile, Offset: offset + acpiChecksumOffset, Start: offset, Length: length})
+}
+
+func (b *testACPIBuild) acpiData() *attestpb.AcpiData {
+	return &attestpb.AcpiData{Rsdp: b.rsdp, Tables: b.tables, TableLoader: encodeTableLoader(b.commands)}
+}
+
+// testXSDTSize is the size of the XSDT of newTestACPIBuild, the last table.
+const testXSDTSize = acpiHeaderSize + 3*8
+
+// newTestACPIBuild returns a build with a DSDT, FACS, FADT, two SSDTs and an
+// XSDT pointed to by a revision 2 RSDP.
+func newTestACPIBuild() *testACPIBuild {
+	b := &testACPIBuild{}
+	b.commands = []LoaderCommand{
+		{Command: LoaderAllocate, File: ACPITablesFile, Align: 64, Zone: LoaderZoneHigh},
+	}
+
+	dsdt := b.addTable(testACPITable("DSDT", 1, []byte{0x10, 0x20}, false))
+	facs := b.addTable(testFACS())
+	fadt := b.addTable(testACPITable("FACP", 1, make([]byte, 8), false))
+	b.addPointer(ACPITablesFile, fadt+fadtFirmwareCtrlOffset, 4, uint64(facs))
+	b.addPointer(ACPITablesFile, fadt+fadtDSDTOffset, 4, uint64(dsdt))
+	ssdt1 := b.addTable(testACPITable("SSDT", 1, []byte{0x30}, false))
+	ssdt2 := b.addTable(testACPITable("SSDT", 1, []byte{0x40}, false))
+
+	entries := []uint32{fadt, ssdt1, ssdt2}
+	xsdt := b.addTable(testACPITable("XSDT", 1, make([]byte, 8*len(entries)), false))
+	for i, entry := range entries {
+		b.addPointer(ACPITablesFile, xsdt+acpiHeaderSize+uint32(8*i), 8, uint64(entry))
+	}
+	for _, table := range []uint32{dsdt, fadt, ssdt1, ssdt2, xsdt} {
+		b.addTableChecksum(table)
+	}
+
+	b.rsdp = make([]byte, rsdpV2Size)
+	copy(b.rsdp, rsdpSignature)
+	copy(b.rsdp[9:15], "BOCHS ")
+	b.rsdp[rsdpRevisionOffset] = 2
+	binary.LittleEndian.PutUint32(b.rsdp[rsdpLengthOffset:], rsdpV2Size)
+	b.commands = append(b.commands, LoaderCommand{Command: LoaderAllocate, File: ACPIRSDPFile, Align: 16, Zone: LoaderZoneFSeg})
+	b.addPointer(ACPIRSDPFile, rsdpXSDTAddressOffset, 8, uint64(xsdt))
+	b.commands = append(b.commands,
+		LoaderCommand{Command: LoaderAddChecksum, File: ACPIRSDPFile, Offset: 8, Start: 0, Length: rsdpV1Size},
+		LoaderCommand{Command: LoaderAddChecksum, File: ACPIRSDPFile, Offset: 32, Start: 0, Length: rsdpV2Size},
+	)
+	return b
+}
+
+func TestParseTableLoader(t *testing.T) {
+	want := []LoaderCommand{
+		{Command: LoaderAllocate, File: ACPITablesFile, Align: 64, Zone: LoaderZoneHigh},
+		{Command: LoaderAddPointer, File: ACPITablesFile, SrcFile: ACPITablesFile, Offset: 100, Size: 4},
+		{Command: LoaderAddChecksum, File: ACPITablesFile, Offset: 9, Start: 0, Length: 36},
+		{Command: LoaderWritePointer, File: "etc/vmgenid_addr", SrcFile: "etc/vmgenid_guid", Offset: 0, SrcOffset: 40, Size: 8},
+	}
+	got, err := ParseTableLoader(encodeTableLoader(want))
+	if err != nil {
+		t.Fatalf("ParseTableLoader() failed: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseTableLoader() mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := ParseTableLoader(make([]byte, loaderEntrySize+1)); err == nil {
+		t.Errorf("ParseTableLoader() with a partial entry succeeded, want error")
+	}
+	unknown := loaderEntry(LoaderCommand{Command: 7})
+	if _, err := ParseTableLoader(unknown); err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("ParseTableLoader() = %v, want unknown command error", err)
+	}
+}
+
+func TestVerifyACPIDataLayout(t *testing.T) {
+	acpiData := newTestACPIBuild().acpiData()
+	state, err := VerifyACPIData(acpiData, measuredACPIData(acpiData))
+	if err != nil {
+		t.Fatalf("VerifyACPIData() failed: %v", err)
+	}
+	if state.RootTable.Signature != "XSDT" {
+		t.Errorf("VerifyACPIData() RootTable = %q, want XSDT", state.RootTable.Signature)
+	}
+	var entries []string
+	for _, entry := range state.RootTableEntries {
+		entries = append(entries, entry.Signature)
+	}
+	if diff := cmp.Diff([]string{"FACP", "SSDT", "SSDT"}, entries); diff != "" {
+		t.Errorf("VerifyACPIData() RootTableEntries mismatch (-want +got):\n%s", diff)
+	}
+	for _, entry := range state.RootTableEntries {
+		if acpiChecksum(entry.Data) != 0 {
+			t.Errorf("patched %s has an invalid checksum", entry.Signature)
+		}
+	}
+	if len(state.LoaderCommands) == 0 {
+		t.Errorf("VerifyACPIData() returned no loader commands")
+	}
+}
+
+func TestVerifyACPIDataLayoutRSDT(t *testing.T) {
+	b := &testACPIBuild{}
+	b.commands = []LoaderCommand{{Command: LoaderAllocate, File: ACPITablesFile, Align: 64, Zone: LoaderZoneHigh}}
+	ssdt := b.addTable(testACPITable("SSDT", 1, []byte{0x30}, false))
+	rsdt := b.addTable(testACPITable("RSDT", 1, make([]byte, 4), false))
+	b.addPointer(ACPITablesFile, rsdt+acpiHeaderSize, 4, uint64(ssdt))
+	b.addTableChecksum(ssdt)
+	b.addTableChecksum(rsdt)
+	b.rsdp = make([]byte, rsdpV1Size)
+	copy(b.rsdp, rsdpSignature)
+	b.commands = append(b.commands, LoaderCommand{Command: LoaderAllocate, File: ACPIRSDPFile, Align: 16, Zone: LoaderZoneFSeg})
+	b.addPointer(ACPIRSDPFile, rsdpRSDTAddressOffset, 4, uint64(rsdt))
+	b.commands = append(b.commands, LoaderCommand{Command: LoaderAddChecksum, File: ACPIRSDPFile, Offset: 8, Start: 0, Length: rsdpV1Size})
+
+	acpiData := b.acpiData()
+	state, err := VerifyACPIData(acpiData, measuredACPIData(acpiData))
+	if err != nil {
+		t.Fatalf("VerifyACPIData() failed: %v", err)
+	}
+	if state.RootTable.Signature != "RSDT" || len(state.RootTableEntries) != 1 || state.RootTableEntries[0].Signature != "SSDT" {
+		t.Errorf("VerifyACPIData() = RSDT %q entries %+v, want RSDT pointing to the SSDT", state.RootTable.Signature, state.RootTableEntries)
+	}
+}
+
+// newTestQEMUBuild returns a build with the table loader commands QEMU emits for
+// a q35 machine with a TPM 2.0 and a VM generation ID device, following
+// hw/i386/acpi-build.c, hw/acpi/tpm.c and hw/acpi/vmgenid.c: the TPM2 table
+// LASA points into etc/tpm/log and the vmgenid SSDT VGIA into
+// etc/vmgenid_guid, neither of which the AcpiData carries, and the guid address
+// is written back to etc/vmgenid_addr.
+func newTestQEMUBuild() *testACPIBuild {
+	const (
+		tpmLogFile      = "etc/tpm/log"
+		vmgenidGUIDFile = "etc/vmgenid_guid"
+		vmgenidAddrFile = "etc/vmgenid_addr"
+		// tpm2LASAOffset is the offset of the log area start address in the
+		// TPM2 table.
+		tpm2LASAOffset = 68
+		// vmgenidGUIDOffset is the offset of the GUID in etc/vmgenid_guid.
+		vmgenidGUIDOffset = 40
+	)
+
+	b := &testACPIBuild{}
+	b.commands = []LoaderCommand{
+		{Command: LoaderAllocate, File: ACPITablesFile, Align: 64, Zone: LoaderZoneHigh},
+		{Command: LoaderAllocate, File: tpmLogFile, Align: 1, Zone: LoaderZoneHigh},
+	}
+
+	facs := b.addTable(testFACS())
+	dsdt := b.addTable(testACPITable("DSDT", 1, []byte{0x10, 0x20}, false))
+	b.addTableChecksum(dsdt)
+	fadt := b.addTable(testACPITable("FACP", 1, make([]byte, 8), false))
+	b.addPointer(ACPITablesFile, fadt+fadtFirmwareCtrlOffset, 4, uint64(facs))
+	b.addPointer(ACPITablesFile, fadt+fadtDSDTOffset, 4, uint64(dsdt))
+	b.addTableChecksum(fadt)
+
+	// The VGIA name holds the address of the vmgenid GUID buffer.
+	b.commands = append(b.commands, LoaderCommand{Command: LoaderAllocate, File: vmgenidGUIDFile, Align: 4096, Zone: LoaderZoneHigh})
+	vmgenidSSDT := testACPITable("SSDT", 1, make([]byte, 8), false)
+	copy(vmgenidSSDT[16:24], "VMGENID ")
+	vmgenid := b.addTable(vmgenidSSDT)
+	b.commands = append(b.commands,
+		LoaderCommand{Command: LoaderAddPointer, File: ACPITablesFile, SrcFile: vmgenidGUIDFile, Offset: vmgenid + acpiHeaderSize, Size: 4},
+		LoaderCommand{Command: LoaderWritePointer, File: vmgenidAddrFile, SrcFile: vmgenidGUIDFile, Offset: 0, SrcOffset: vmgenidGUIDOffset, Size: 8},
+	)
+	b.addTableChecksum(vmgenid)
+
+	tpm2 := b.addTable(testACPITable("TPM2", 4, make([]byte, tpm2LASAOffset+8-acpiHeaderSize), false))
+	b.commands = append(b.commands, LoaderCommand{Command: LoaderAddPointer, File: ACPITablesFile, SrcFile: tpmLogFile, Offset: tpm2 + tpm2LASAOffset, Size: 8})
+	b.addTableChecksum(tpm2)
+
+	entries := []uint32{fadt, vmgenid, tpm2}
+	xsdt := b.addTable(testACPITable("XSDT", 1, make([]byte, 8*len(entries)), false))
+	for i, entry := range entries {
+		b.addPointer(ACPITablesFile, xsdt+acpiHeaderSize+uint32(8*i), 8, uint64(entry))
+	}
+	b.addTableChecksum(xsdt)
+
+	b.rsdp = make([]byte, rsdpV2Size)
+	copy(b.rsdp, rsdpSignature)
+	copy(b.rsdp[9:15], "BOCHS ")
+	b.rsdp[rsdpRevisionOffset] = 2
+	binary.LittleEndian.PutUint32(b.rsdp[rsdpLengthOffset:], rsdpV2Size)
+	b.commands = append(b.commands, LoaderCommand{Command: LoaderAllocate, File: ACPIRSDPFile, Align: 16, Zone: LoaderZoneFSeg})
+	b.addPointer(ACPIRSDPFile, rsdpXSDTAddressOffset, 8, uint64(xsdt))
+	b.commands = append(b.commands,
+		LoaderCommand{Command: LoaderAddChecksum, File: ACPIRSDPFile, Offset: 8, Start: 0, Length: rsdpV1Size},
+		LoaderCommand{Command: LoaderAddChecksum, File: ACPIRSDPFile, Offset: 32, Start: 0, Length: rsdpV2Size},
+	)
+	return b
+}
+
+func TestVerifyACPIDataQEMULoader(t *testing.T) {
+	acpiData := newTestQEMUBuild().acpiData()
+	state, err := VerifyACPIData(acpiData, measuredACPIData(acpiData))
+	if err != nil {
+		t.Fatalf("VerifyACPIData() failed: %v", err)
+	}
+	var entries []string
+	for _, entry := range state.RootTableEntries {
+		entries = append(entries, entry.Signature)
+		if acpiChecksum(entry.Data) != 0 {
+			t.Errorf("patched %s has an invalid checksum", entry.Signature)
+		}
+	}
+	if diff := cmp.Diff([]string{"FACP", "SSDT", "TPM2"}, entries); diff != "" {
+		t.Errorf("VerifyACPIData() RootTableEntries mismatch (-want +got):\n%s", diff)
+	}
+	// Pointers into files the AcpiData does not carry are zeroed.
+	tpm2 := state.RootTableEntries[2]
+	if lasa := binary.LittleEndian.Uint64(tpm2.Data[68:]); lasa != 0 {
+		t.Errorf("patched TPM2 LASA = 0x%x, want 0", lasa)
+	}
+}
+
+// pointUncarried allocates the uncarried file and retargets the ADD_POINTER at
+// the offset of the file to it.
+func pointUncarried(b *testACPIBuild, file string, offset uint32, srcFile string) {
+	b.commands = append([]LoaderCommand{{Command: LoaderAllocate, File: srcFile, Align: 1, Zone: LoaderZoneHigh}}, b.commands...)
+	for i, cmd := range b.commands {
+		if cmd.Command == LoaderAddPointer && cmd.File == file && cmd.Offset == offset {
+			b.commands[i].SrcFile = srcFile
+		}
+	}
+}
+
+func TestWritePointer(t *testing.T) {
+	data := make([]byte, 8)
+	if err := writePointer(data, 4, 4, 0x11223344); err != nil {
+		t.Fatalf("writePointer() failed: %v", err)
+	}
+	if got := binary.LittleEndian.Uint32(data[4:]); got != 0x11223344 {
+		t.Errorf("writePointer() wrote 0x%x, want 0x11223344", got)
+	}
+	if err := writePointer(data, 6, 4, 0); err == nil || !strings.Contains(err.Error(), "outside") {
+		t.Errorf("writePointer() past the data = %v, want outside error", err)
+	}
+	if err := writePointer(data, 1000, 8, 0); err == nil || !strings.Contains(err.Error(), "outside") {
+		t.Errorf("writePointer() far past the data = %v, want outside error", err)
+	}
+	if err := writePointer(data, 0, 2, 0x10000); err == nil {
+		t.Errorf("writePointer() of a value too large succeeded, want error")
+	}
+}
+
+func TestVerifyACPIDataLayoutErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		modify  func(b *testACPIBuild)
+		wantErr string
+	}{
+		{
+			name: "XSDT entry past the tables",
+			modify: func(b *testACPIBuild) {
+				xsdt := b.tables[len(b.tables)-testXSDTSize:]
+				binary.LittleEndian.PutUint64(xsdt[acpiHeaderSize:], uint64(len(b.tables)+16))
+			},
+			wantErr: "outside",
+		},
+		{
+			name: "XSDT entry into the middle of a table",
+			modify: func(b *testACPIBuild) {
+				xsdt := b.tables[len(b.tables)-testXSDTSize:]
+				binary.LittleEndian.PutUint64(xsdt[acpiHeaderSize:], 4)
+			},
+			wantErr: "start of a table",
+		},
+		{
+			name: "XSDT entry into an unprovided file",
+			modify: func(b *testACPIBuild) {
+				pointUncarried(b, ACPITablesFile, uint32(len(b.tables)-testXSDTSize+acpiHeaderSize), "etc/tpm/log")
+			},
+			wantErr: "XSDT table may not point into \"etc/tpm/log\"",
+		},
+		{
+			name: "RSDP XSDT address into an unprovided file",
+			modify: func(b *testACPIBuild) {
+				pointUncarried(b, ACPIRSDPFile, rsdpXSDTAddressOffset, "etc/tpm/log")
+			},
+			wantErr: "does not carry",
+		},
+		{
+			name: "FADT DSDT into an unprovided file",
+			modify: func(b *testACPIBuild) {
+				fadt := uint32(len(testACPITable("DSDT", 1, []byte{0x10, 0x20}, false)) + facsMinSize)
+				pointUncarried(b, ACPITablesFile, fadt+fadtDSDTOffset, "etc/vmgenid_guid")
+			},
+			wantErr: "FACP table may not point",
+		},
+		{
+			name: "SSDT other than vmgenid into the vmgenid buffer",
+			modify: func(b *testACPIBuild) {
+				ssdt := uint32(len(b.tables) - testXSDTSize - 2*(acpiHeaderSize+1))
+				b.commands = append([]LoaderCommand{{Command: LoaderAllocate, File: "etc/vmgenid_guid", Align: 4096, Zone: LoaderZoneHigh}}, b.commands...)
+				b.commands = append(b.commands, LoaderCommand{Command: LoaderAddPointer, File: ACPITablesFile, SrcFile: "etc/vmgenid_guid", Offset: ssdt + acpiHeaderSize, Size: 1})
+			},
+			wantErr: "SSDT table may not point",
+		},
+		{
+			name: "pointer into an unprovided file past the tables",
+			modify: func(b *testACPIBuild) {
+				b.commands = append([]LoaderCommand{{Command: LoaderAllocate, File: "etc/tpm/log", Align: 1, Zone: LoaderZoneHigh}}, b.commands...)
+				b.commands = append(b.commands, LoaderCommand{Command: LoaderAddPointer, File: ACPITablesFile, SrcFile: "etc/tpm/log", Offset: 1000, Size: 8})
+			},
+			wantErr: "not within a table",
+		},
+		{
+			name: "revision 2 RSDP without an XSDT address",
+			modify: func(b *testACPIBuild) {
+				var commands []LoaderCommand
+				for _, cmd := range b.commands {
+					if cmd.Command != LoaderAddPointer || cmd.File != ACPIRSDPFile {
+						commands = append(commands, cmd)
+					}
+				}
+				b.commands = commands
+				binary.LittleEndian.PutUint64(b.rsdp[rsdpXSDTAddressOffset:], 0)
+			},
+			wantErr: "invalid RSDP XSDT address",
+		},
+		{
+			name: "checksum of an unprovided file",
+			modify: func(b *testACPIBuild) {
+				b.commands = append(b.commands,
+					LoaderCommand{Command: LoaderAllocate, File: "etc/tpm/log", Align: 1, Zone: LoaderZoneHigh},
+					LoaderCommand{Command: LoaderAddChecksum, File: "etc/tpm/log", Offset: 0, Start: 0, Length: 1},
+				)
+			},
+			wantErr: "not provided",
+		},
+		{
+			name: "pointer into an unallocated file",
+			modify: func(b *testACPIBuild) {
+				b.commands = append(b.commands, LoaderCommand{Command: LoaderAddPointer, File: ACPITablesFile, SrcFile: "etc/other", Offset: 0, Size: 4})
+			},
+			wantErr: "not allocated",
+		},
+		{
+			name: "pointer location past the file",
+			modify: func(b *testACPIBuild) {
+				b.commands = append(b.commands, LoaderCommand{Command: LoaderAddPointer, File: ACPIRSDPFile, SrcFile: ACPITablesFile, Offset: rsdpV2Size - 2, Size: 4})
+			},
+			wantErr: "outside",
+		},
+		{
+			name: "invalid pointer size",
+			modify: func(b *testACPIBuild) {
+				b.commands = append(b.commands, LoaderCommand{Command: LoaderAddPointer, File: ACPITablesFile, SrcFile: ACPITablesFile, Offset: 0, Size: 3})
+			},
+			wantErr: "pointer size",
+		},
+		{
+			name: "checksum past the file",
+			modify: func(b *testACPIBuild) {
+				b.commands = append(b.commands, LoaderCommand{Command: LoaderAddChecksum, File: ACPIRSDPFile, Offset: 8, Start: 0, Length: rsdpV2Size + 1})
+			},
+			wantErr: "outside",
+		},
+		{
+			name: "write pointer past the file",
+			modify: func(b *testACPIBuild) {
+				b.commands = append(b.commands, LoaderCommand{Command: LoaderWritePointer, File: "etc/vmgenid_addr", SrcFile: ACPITablesFile, SrcOffset: uint32(len(b.tables)), Size: 8})
+			},
+			wantErr: "outside",
+		},
+		{
+			name: "file allocated twice",
+			modify: func(b *testACPIBuild) {
+				b.commands = append(b.commands, LoaderCommand{Command: LoaderAllocate, File: ACPITablesFile, Align: 64, Zone: LoaderZoneHigh})
+			},
+			wantErr: "allocated twice",
+		},
+		{
+			name: "missing table checksum",
+			modify: func(b *testACPIBuild) {
+				for i, cmd := range b.commands {
+					if cmd.Command == LoaderAddChecksum && cmd.File == ACPITablesFile {
+						b.commands = append(b.commands[:i], b.commands[i+1:]...)
+						return
+					}
+				}
+			},
+			wantErr: "checksum",
+		},
+		{
+			name: "FADT DSDT pointing to an SSDT",
+			modify: func(b *testACPIBuild) {
+				// The FADT follows the DSDT and FACS; the first SSDT follows the FADT.
+				fadt := b.tables[len(testACPITable("DSDT", 1, []byte{0x10, 0x20}, false))+facsMinSize:]
+				binary.LittleEndian.PutUint32(fadt[fadtDSDTOffset:], binary.LittleEndian.Uint32(fadt[fadtFirmwareCtrlOffset:])+facsMinSize+acpiHeaderSize+8)
+			},
+			wantErr: "FADT DSDT",
+		},
+		{
+			name: "RSDP pointing to an SSDT",
+			modify: func(b *testACPIBuild) {
+				binary.LittleEndian.PutUint64(b.rsdp[rsdpXSDTAddressOffset:], uint64(len(b.tables)-testXSDTSize-acpiHeaderSize-1))
+			},
+			wantErr: "want \"XSDT\"",
+		},
+		{
+			name: "RSDP not allocated",
+			modify: func(b *testACPIBuild) {
+				var commands []LoaderCommand
+				for _, cmd := range b.commands {
+					if cmd.File != ACPIRSDPFile {
+						commands = append(commands, cmd)
+					}
+				}
+				b.commands = commands
+			},
+			wantErr: "does not allocate",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newTestACPIBuild()
+			tc.modify(b)
+			acpiData := b.acpiData()
+			_, err := VerifyACPIData(acpiData, measuredACPIData(acpiData))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("VerifyACPIData() = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package extract
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+	rimpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/image_database"
+	elpb "github.com/google/go-eventlog/proto/state"
+)
+
+// ACPIMachineShape identifies the ACPI reference values of a VM.
+type ACPIMachineShape struct {
+	MachineType string
+	VCPUCount   uint32
+	MemoryMB    uint64
+}
+
+func (s ACPIMachineShape) String() string {
+	return fmt.Sprintf("%s/%d vCPUs/%d MB", s.MachineType, s.VCPUCount, s.MemoryMB)
+}
+
+// VerifyACPIReference verifies the ACPI data against the verified UEFI event
+// log, as VerifyACPIData does, and checks it against the image database's ACPI
+// reference values of the machine shape, so that the tables are known to be
+// the ones a legitimate host supplies.
+func VerifyACPIReference(acpiData *attestpb.AcpiData, fls *elpb.FirmwareLogState, shape ACPIMachineShape, imageDb *rimpb.ImageDatabase) (*ACPIState, error) {
+	if imageDb == nil {
+		return nil, errors.New("ImageDB is nil")
+	}
+	reference, err := findACPIReference(shape, imageDb.GetAcpiReferenceValues())
+	if err != nil {
+		return nil, err
+	}
+	state, err := VerifyACPIData(acpiData, fls)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkACPIReference(state, acpiData.GetTableLoader(), reference); err != nil {
+		return nil, fmt.Errorf("ACPI data does not match the reference values of machine shape %v: %v", shape, err)
+	}
+	return state, nil
+}
+
+func findACPIReference(shape ACPIMachineShape, references []*rimpb.ImageDatabase_AcpiReferenceEntry) (*rimpb.ImageDatabase_AcpiReferenceEntry, error) {
+	var found *rimpb.ImageDatabase_AcpiReferenceEntry
+	for _, reference := range references {
+		if reference.GetMachineType() != shape.MachineType || reference.GetVcpuCount() != shape.VCPUCount || reference.GetMemoryMb() != shape.MemoryMB {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("multiple ACPI reference values for machine shape %v", shape)
+		}
+		found = reference
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no ACPI reference values for machine shape %v", shape)
+	}
+	return found, nil
+}
+
+// checkACPIReference checks the tables, as provided before the table loader
+// patched them, and the table loader against the reference entry.
+func checkACPIReference(state *ACPIState, tableLoader []byte, reference *rimpb.ImageDatabase_AcpiReferenceEntry) error {
+	if len(reference.GetAllowedTableDigests()) == 0 && len(reference.GetAllowedTableSets()) == 0 {
+		return errors.New("reference values allow no tables")
+	}
+
+	var digests []string
+	for _, table := range state.Tables {
+		digests = append(digests, acpiDigest(table.Data))
+	}
+
+	if allowed := reference.GetAllowedTableDigests(); len(allowed) > 0 {
+		var unknown []string
+		for i, digest := range digests {
+			if !containsDigest(allowed, digest) {
+				unknown = append(unknown, fmt.Sprintf("%s at offset %d", state.Tables[i].Signature, state.Tables[i].Offset))
+			}
+		}
+		if len(unknown) > 0 {
+			return fmt.Errorf("tables are not allowed: %s", strings.Join(unknown, ", "))
+		}
+	}
+
+	if sets := reference.GetAllowedTableSets(); len(sets) > 0 {
+		matched := slices.ContainsFunc(sets, func(set *rimpb.ImageDatabase_AcpiTableSet) bool {
+			return slices.EqualFunc(set.GetTableDigests(), digests, strings.EqualFold)
+		})
+		if !matched {
+			return fmt.Errorf("tables do not match any of the %d allowed table sets", len(sets))
+		}
+	}
+
+	if allowed := reference.GetAllowedTableLoaderDigests(); len(allowed) > 0 && !containsDigest(allowed, acpiDigest(tableLoader)) {
+		return errors.New("table loader is not allowed")
+	}
+	return nil
+}
+
+// acpiDigest returns the hex-encoded SHA-384 digest the ACPI reference values
+// use.
+func acpiDigest(data []byte) string {
+	digest := sha512.Sum384(data)
+	return hex.EncodeToString(digest[:])
+}
+
+func containsDigest(digests []string, digest string) bool {
+	return slices.ContainsFunc(digests, func(d string) bool { return strings.EqualFold(d, digest) })
+}
@@ -0,0 +1,145 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+
+	rimpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/image_database"
+)
+
+func TestVerifyACPIReference(t *testing.T) {
+	b := newTestACPIBuild()
+	acpiData := b.acpiData()
+	fls := measuredACPIData(acpiData)
+	tables, err := ParseACPITables(acpiData.GetTables())
+	if err != nil {
+		t.Fatalf("ParseACPITables() failed: %v", err)
+	}
+	var digests []string
+	for _, table := range tables {
+		digests = append(digests, acpiDigest(table.Data))
+	}
+	shape := ACPIMachineShape{MachineType: "c3-standard-4", VCPUCount: 4, MemoryMB: 16384}
+	otherShape := ACPIMachineShape{MachineType: "c3-standard-8", VCPUCount: 8, MemoryMB: 32768}
+	entry := func(mutate func(*rimpb.ImageDatabase_AcpiReferenceEntry)) *rimpb.ImageDatabase {
+		e := &rimpb.ImageDatabase_AcpiReferenceEntry{
+			MachineType: shape.MachineType,
+			VcpuCount:   shape.VCPUCount,
+			MemoryMb:    shape.MemoryMB,
+		}
+		mutate(e)
+		return &rimpb.ImageDatabase{AcpiReferenceValues: []*rimpb.ImageDatabase_AcpiReferenceEntry{
+			{MachineType: otherShape.MachineType, VcpuCount: otherShape.VCPUCount, MemoryMb: otherShape.MemoryMB, AllowedTableDigests: []string{"00"}},
+			e,
+		}}
+	}
+
+	testCases := []struct {
+		name    string
+		shape   ACPIMachineShape
+		imageDb *rimpb.ImageDatabase
+		wantErr string
+	}{
+		{
+			name:  "allowed table digests",
+			shape: shape,
+			imageDb: entry(func(e *rimpb.ImageDatabase_AcpiReferenceEntry) {
+				e.AllowedTableDigests = append(digests, acpiDigest([]byte("other")))
+			}),
+		},
+		{
+			name:  "allowed table set",
+			shape: shape,
+			imageDb: entry(func(e *rimpb.ImageDatabase_AcpiReferenceEntry) {
+				e.AllowedTableSets = []*rimpb.ImageDatabase_AcpiTableSet{{TableDigests: digests[1:]}, {TableDigests: digests}}
+			}),
+		},
+		{
+			name:  "allowed table loader",
+			shape: shape,
+			imageDb: entry(func(e *rimpb.ImageDatabase_AcpiReferenceEntry) {
+				e.AllowedTableDigests = digests
+				e.AllowedTableLoaderDigests = []string{strings.ToUpper(acpiDigest(acpiData.GetTableLoader()))}
+			}),
+		},
+		{
+			name:    "unknown table",
+			shape:   shape,
+			imageDb: entry(func(e *rimpb.ImageDatabase_AcpiReferenceEntry) { e.AllowedTableDigests = digests[1:] }),
+			wantErr: "DSDT at offset 0",
+		},
+		{
+			name:  "no matching table set",
+			shape: shape,
+			imageDb: entry(func(e *rimpb.ImageDatabase_AcpiReferenceEntry) {
+				e.AllowedTableSets = []*rimpb.ImageDatabase_AcpiTableSet{{TableDigests: digests[:len(digests)-1]}}
+			}),
+			wantErr: "allowed table sets",
+		},
+		{
+			name:  "unknown table loader",
+			shape: shape,
+			imageDb: entry(func(e *rimpb.ImageDatabase_AcpiReferenceEntry) {
+				e.AllowedTableDigests = digests
+				e.AllowedTableLoaderDigests = []string{acpiDigest([]byte("other"))}
+			}),
+			wantErr: "table loader",
+		},
+		{
+			name:    "no allowed tables",
+			shape:   shape,
+			imageDb: entry(func(e *rimpb.ImageDatabase_AcpiReferenceEntry) {}),
+			wantErr: "allow no tables",
+		},
+		{
+			name:    "unknown machine shape",
+			shape:   ACPIMachineShape{MachineType: "c3-standard-4", VCPUCount: 4, MemoryMB: 8192},
+			imageDb: entry(func(e *rimpb.ImageDatabase_AcpiReferenceEntry) { e.AllowedTableDigests = digests }),
+			wantErr: "no ACPI reference values",
+		},
+		{
+			name:    "another shape's reference values",
+			shape:   otherShape,
+			imageDb: entry(func(e *rimpb.ImageDatabase_AcpiReferenceEntry) { e.AllowedTableDigests = digests }),
+			wantErr: "not allowed",
+		},
+		{
+			name:  "duplicate machine shape",
+			shape: otherShape,
+			imageDb: entry(func(e *rimpb.ImageDatabase_AcpiReferenceEntry) {
+				e.MachineType, e.VcpuCount, e.MemoryMb = otherShape.MachineType, otherShape.VCPUCount, otherShape.MemoryMB
+			}),
+			wantErr: "multiple",
+		},
+		{
+			name:    "nil image database",
+			shape:   shape,
+			wantErr: "ImageDB is nil",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			state, err := VerifyACPIReference(acpiData, fls, tc.shape, tc.imageDb)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("VerifyACPIReference() failed: %v", err)
+				}
+				if len(state.Tables) != len(tables) {
+					t.Errorf("VerifyACPIReference() returned %d tables, want %d", len(state.Tables), len(tables))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("VerifyACPIReference() = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+
+	// The ACPI data must still match the event log.
+	imageDb := entry(func(e *rimpb.ImageDatabase_AcpiReferenceEntry) { e.AllowedTableDigests = digests })
+	fls.RawEvents = fls.RawEvents[:2]
+	if _, err := VerifyACPIReference(acpiData, fls, shape, imageDb); err == nil {
+		t.Errorf("VerifyACPIReference() with an unmeasured tables blob succeeded, want error")
+	}
+}
@@ -0,0 +1,197 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+	elpb "github.com/google/go-eventlog/proto/state"
+)
+
+const (
+	// acpiHeaderSize is the size of the ACPI System Description Table header.
+	acpiHeaderSize = 36
+	// acpiChecksumOffset is the offset of the checksum in the table header.
+	acpiChecksumOffset = 9
+	// facsMinSize is the size of the FACS, the only table in the blob without a
+	// System Description Table header.
+	facsMinSize   = 64
+	facsSignature = "FACS"
+)
+
+// ACPITable is an ACPI table of the AcpiData tables blob.
+type ACPITable struct {
+	// Offset is the offset of the table in the tables blob.
+	Offset int
+	// Signature identifies the table, e.g. DSDT, FACP (FADT), APIC (MADT) or SSDT.
+	Signature string
+	Length    uint32
+	Revision  uint8
+	Checksum  uint8
+	// The OEM and creator fields are empty for the FACS, which has no System
+	// Description Table header.
+	OEMID           string
+	OEMTableID      string
+	OEMRevision     uint32
+	CreatorID       string
+	CreatorRevision uint32
+	// Data is the whole table, including its header.
+	Data []byte
+}
+
+// ACPIState is the verified ACPI data of a VM.
+type ACPIState struct {
+	// Tables are the tables of the AcpiData tables blob, in blob order, as
+	// provided before the table loader patched them.
+	Tables []ACPITable
+	// LoaderCommands are the decoded commands of the AcpiData table_loader.
+	LoaderCommands []LoaderCommand
+	// RootTable is the XSDT, or the RSDT for an ACPI 1.0 RSDP, the patched RSDP
+	// points to.
+	RootTable ACPITable
+	// RootTableEntries are the tables the root table points to, in entry order.
+	RootTableEntries []ACPITable
+}
+
+// TablesWithSignature returns the tables with the given signature, e.g. all SSDTs.
+func (s *ACPIState) TablesWithSignature(signature string) []ACPITable {
+	var tables []ACPITable
+	for _, table := range s.Tables {
+		if table.Signature == signature {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// VerifyACPIData verifies the ACPI data against the verified UEFI event log,
+// as VerifyACPIDataAgainstLog does, and returns its parsed tables.
+//
+// The table loader is then run over the rsdp and tables the way the firmware
+// does, rejecting pointers outside the provided files. Pointers into files the
+// AcpiData does not carry are zeroed if they belong to the TPM2, TCPA or vmgenid
+// tables and rejected otherwise. The patched RSDP must lead through the XSDT, or
+// the RSDT of an ACPI 1.0 RSDP, to tables of the tables blob.
+func VerifyACPIData(acpiData *attestpb.AcpiData, fls *elpb.FirmwareLogState) (*ACPIState, error) {
+	if err := VerifyACPIDataAgainstLog(acpiData, fls); err != nil {
+		return nil, err
+	}
+	tables, err := ParseACPITables(acpiData.GetTables())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ACPI tables: %v", err)
+	}
+	commands, err := ParseTableLoader(acpiData.GetTableLoader())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ACPI table loader: %v", err)
+	}
+	loaded, err := applyTableLoader(commands, map[string][]byte{
+		ACPIRSDPFile:   acpiData.GetRsdp(),
+		ACPITablesFile: acpiData.GetTables(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid ACPI table loader: %v", err)
+	}
+	layout, err := verifyACPILayout(loaded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid patched ACPI layout: %v", err)
+	}
+	return &ACPIState{
+		Tables:           tables,
+		LoaderCommands:   commands,
+		RootTable:        layout.root,
+		RootTableEntries: layout.entries,
+	}, nil
+}
+
+// ParseACPITables splits the AcpiData tables blob into its ACPI tables and
+// validates their checksums. Trailing zero padding is ignored.
+//
+// QEMU leaves the checksums in the blob zero and has the firmware fill them in
+// with the table loader's ADD_CHECKSUM commands, so a zero checksum is not
+// validated. Any other checksum must make the table sum to zero.
+func ParseACPITables(blob []byte) ([]ACPITable, error) {
+	return parseACPITables(blob, false)
+}
+
+// parseACPITables parses the tables blob. If strict is set, zero checksums are
+// validated too, as they must be after the table loader ran.
+func parseACPITables(blob []byte, strict bool) ([]ACPITable, error) {
+	var tables []ACPITable
+	for offset := 0; offset < len(blob); {
+		rest := blob[offset:]
+		if isZero(rest) {
+			break
+		}
+		if len(rest) < 8 {
+			return nil, fmt.Errorf("truncated ACPI table header at offset %d", offset)
+		}
+
+		signature := string(rest[:4])
+		length := binary.LittleEndian.Uint32(rest[4:8])
+		minLength := acpiHeaderSize
+		if signature == facsSignature {
+			minLength = facsMinSize
+		}
+		if length < uint32(minLength) {
+			return nil, fmt.Errorf("ACPI table %q at offset %d has length %d, want at least %d", signature, offset, length, minLength)
+		}
+		if uint64(length) > uint64(len(rest)) {
+			return nil, fmt.Errorf("ACPI table %q at offset %d has length %d, but only %d bytes remain", signature, offset, length, len(rest))
+		}
+		data := rest[:length]
+
+		table := ACPITable{
+			Offset:    offset,
+			Signature: signature,
+			Length:    length,
+			Data:      data,
+		}
+		if signature == facsSignature {
+			table.Revision = data[32]
+		} else {
+			table.Revision = data[8]
+			table.Checksum = data[acpiChecksumOffset]
+			table.OEMID = acpiString(data[10:16])
+			table.OEMTableID = acpiString(data[16:24])
+			table.OEMRevision = binary.LittleEndian.Uint32(data[24:28])
+			table.CreatorID = acpiString(data[28:32])
+			table.CreatorRevision = binary.LittleEndian.Uint32(data[32:36])
+			if (strict || table.Checksum != 0) && acpiChecksum(data) != 0 {
+				return nil, fmt.Errorf("ACPI table %q at offset %d has an invalid checksum 0x%02x", signature, offset, table.Checksum)
+			}
+		}
+
+		tables = append(tables, table)
+		offset += int(length)
+	}
+	if len(tables) == 0 {
+		return nil, errors.New("no ACPI tables found")
+	}
+	return tables, nil
+}
+
+// acpiChecksum returns the 8-bit sum of the data, which is zero for a table
+// with a valid checksum.
+func acpiChecksum(data []byte) uint8 {
+	var sum uint8
+	for _, b := range data {
+		sum += b
+	}
+	return sum
+}
+
+// acpiString returns an OEM or creator ID with its space and NUL padding removed.
+func acpiString(b []byte) string {
+	return string(bytes.TrimRight(b, " \x00"))
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
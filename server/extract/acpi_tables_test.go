@@ -0,0 +1,146 @@
+package extract
+
+import (
+	"crypto"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+	elpb "github.com/google/go-eventlog/proto/state"
+)
+
+// testACPITable returns an ACPI table with a System Description Table header
+// and the body. The checksum is left zero unless withChecksum is set.
+func testACPITable(signature string, revision uint8, body []byte, withChecksum bool) []byte {
+	table := make([]byte, acpiHeaderSize, acpiHeaderSize+len(body))
+	copy(table[0:4], signature)
+	binary.LittleEndian.PutUint32(table[4:8], uint32(acpiHeaderSize+len(body)))
+	table[8] = revision
+	copy(table[10:16], "BOCHS ")
+	copy(table[16:24], "BXPC    ")
+	binary.LittleEndian.PutUint32(table[24:28], 1)
+	copy(table[28:32], "BXPC")
+	binary.LittleEndian.PutUint32(table[32:36], 1)
+	table = append(table, body...)
+	if withChecksum {
+		table[acpiChecksumOffset] = -acpiChecksum(table)
+	}
+	return table
+}
+
+// testFACS returns a FACS, which has no System Description Table header.
+func testFACS() []byte {
+	facs := make([]byte, facsMinSize)
+	copy(facs[0:4], facsSignature)
+	binary.LittleEndian.PutUint32(facs[4:8], facsMinSize)
+	facs[32] = 2
+	return facs
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+func TestParseACPITables(t *testing.T) {
+	dsdt := testACPITable("DSDT", 1, []byte{0x10, 0x20, 0x30}, true)
+	facs := testFACS()
+	fadt := testACPITable("FACP", 6, make([]byte, 8), false)
+	madt := testACPITable("APIC", 5, []byte{0x01, 0x02}, true)
+	blob := concat(dsdt, facs, fadt, madt, make([]byte, 64))
+
+	tables, err := ParseACPITables(blob)
+	if err != nil {
+		t.Fatalf("ParseACPITables() failed: %v", err)
+	}
+
+	want := []ACPITable{
+		{Offset: 0, Signature: "DSDT", Length: uint32(len(dsdt)), Revision: 1, Checksum: dsdt[acpiChecksumOffset], OEMID: "BOCHS", OEMTableID: "BXPC", OEMRevision: 1, CreatorID: "BXPC", CreatorRevision: 1},
+		{Offset: len(dsdt), Signature: "FACS", Length: facsMinSize, Revision: 2},
+		{Offset: len(dsdt) + len(facs), Signature: "FACP", Length: uint32(len(fadt)), Revision: 6, OEMID: "BOCHS", OEMTableID: "BXPC", OEMRevision: 1, CreatorID: "BXPC", CreatorRevision: 1},
+		{Offset: len(dsdt) + len(facs) + len(fadt), Signature: "APIC", Length: uint32(len(madt)), Revision: 5, Checksum: madt[acpiChecksumOffset], OEMID: "BOCHS", OEMTableID: "BXPC", OEMRevision: 1, CreatorID: "BXPC", CreatorRevision: 1},
+	}
+	if diff := cmp.Diff(want, tables, cmpopts.IgnoreFields(ACPITable{}, "Data")); diff != "" {
+		t.Errorf("ParseACPITables() mismatch (-want +got):\n%s", diff)
+	}
+	for _, table := range tables {
+		if string(table.Data) != string(blob[table.Offset:table.Offset+int(table.Length)]) {
+			t.Errorf("table %q data does not match the blob", table.Signature)
+		}
+	}
+}
+
+func TestParseACPITablesErrors(t *testing.T) {
+	dsdt := testACPITable("DSDT", 1, []byte{0x10, 0x20, 0x30}, true)
+	badChecksum := testACPITable("SSDT", 1, []byte{0x01}, true)
+	badChecksum[len(badChecksum)-1]++
+	shortFACS := testFACS()
+	binary.LittleEndian.PutUint32(shortFACS[4:8], 36)
+	shortTable := testACPITable("SSDT", 1, nil, false)
+	binary.LittleEndian.PutUint32(shortTable[4:8], 8)
+
+	testCases := []struct {
+		name    string
+		blob    []byte
+		wantErr string
+	}{
+		{"empty", nil, "no ACPI tables"},
+		{"only padding", make([]byte, 16), "no ACPI tables"},
+		{"truncated header", concat(dsdt, []byte{'S', 'S', 'D'}), "truncated"},
+		{"length past the blob", dsdt[:len(dsdt)-1], "remain"},
+		{"length below header", shortTable, "at least"},
+		{"short FACS", concat(shortFACS, make([]byte, 64)), "at least"},
+		{"invalid checksum", concat(dsdt, badChecksum), "checksum"},
+		{"data after padding", concat(dsdt, make([]byte, 8), []byte{0x01}), "length"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseACPITables(tc.blob)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ParseACPITables() = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// measuredACPIData returns a firmware log state measuring the ACPI data.
+func measuredACPIData(acpiData *attestpb.AcpiData) *elpb.FirmwareLogState {
+	var events []*elpb.Event
+	for _, data := range [][]byte{acpiData.GetTableLoader(), acpiData.GetRsdp(), acpiData.GetTables()} {
+		hasher := crypto.SHA384.New()
+		hasher.Write(data)
+		events = append(events, &elpb.Event{UntrustedType: acpiEventType, Data: acpiLabel, Digest: hasher.Sum(nil)})
+	}
+	return &elpb.FirmwareLogState{Hash: elpb.HashAlgo_SHA384, RawEvents: events}
+}
+
+func TestVerifyACPIDataTables(t *testing.T) {
+	acpiData := newTestACPIBuild().acpiData()
+	fls := measuredACPIData(acpiData)
+
+	state, err := VerifyACPIData(acpiData, fls)
+	if err != nil {
+		t.Fatalf("VerifyACPIData() failed: %v", err)
+	}
+	if len(state.Tables) != 6 {
+		t.Errorf("VerifyACPIData() returned %d tables, want 6", len(state.Tables))
+	}
+	if got := len(state.TablesWithSignature("SSDT")); got != 2 {
+		t.Errorf("TablesWithSignature(SSDT) returned %d tables, want 2", got)
+	}
+	if got := len(state.TablesWithSignature("APIC")); got != 0 {
+		t.Errorf("TablesWithSignature(APIC) returned %d tables, want 0", got)
+	}
+
+	fls.RawEvents = fls.RawEvents[:2]
+	if _, err := VerifyACPIData(acpiData, fls); err == nil {
+		t.Errorf("VerifyACPIData() with an unmeasured tables blob succeeded, want error")
+	}
+}
@@ -53,18 +53,7 @@ func VerifyACPIDataAgainstLog(acpiData *attestpb.AcpiData, fls *elpb.FirmwareLog
 	acpiEventCount := 0
 
 	for _, event := range fls.GetRawEvents() {
-		t := event.GetUntrustedType()
-
-		isTargetType := t == acpiEventType
-
-		if !isTargetType {
-			continue
-		}
-
-		eventData := event.GetData()
-		isACPI := bytes.Contains(eventData, acpiLabel)
-
-		if !isACPI {
+		if !isACPIEvent(event) {
 			continue
 		}
 
@@ -88,3 +77,18 @@ func VerifyACPIDataAgainstLog(acpiData *attestpb.AcpiData, fls *elpb.FirmwareLog
 
 	return nil
 }
+
+// HasACPIEvents reports whether the verified UEFI event log measured any ACPI
+// data (the table loader, RSDP or tables blob).
+func HasACPIEvents(fls *elpb.FirmwareLogState) bool {
+	for _, event := range fls.GetRawEvents() {
+		if isACPIEvent(event) {
+			return true
+		}
+	}
+	return false
+}
+
+func isACPIEvent(event *elpb.Event) bool {
+	return event.GetUntrustedType() == acpiEventType && bytes.Contains(event.GetData(), acpiLabel)
+}
@@ -3,9 +3,11 @@ package extract
 
 import (
 	"bytes"
+	"crypto"
 	"fmt"
 
 	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/GoogleCloudPlatform/confidential-space/server/gpu"
 	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
 	"github.com/google/go-eventlog/cel"
 	"github.com/google/go-eventlog/register"
@@ -16,11 +18,82 @@ import (
 // Options contains the options for parsing the COS event log.
 type Options struct {
 	PopulateGpuDeviceState bool // Whether to populate the GPU device state default is false.
+	// Whether to record authenticated events with an unknown content type or COS
+	// event type in COSEventLogState.Unrecognized, instead of failing. Default is false.
+	AllowUnrecognizedEvents bool
+	// Whether to return a *ReplayError with a ReplayReport when the event log
+	// fails to replay. Default is false.
+	DiagnoseReplayFailure bool
+	// If set, the NVIDIA attestation report bound by the
+	// GPUDeviceAttestationBindingType event is verified with these options, and
+	// the verified GPUs are returned in COSEventLogState.GPUs. Default is nil.
+	GpuVerifyOptions *gpu.Options
+}
+
+// COSEventLogState is the verified state of a COS event log.
+type COSEventLogState struct {
+	// Cos is the launch configuration, measured before the LaunchSeparator event.
+	Cos *pb.AttestedCosState
+
+	// Runtime is the runtime history, measured after the LaunchSeparator event.
+	Runtime *RuntimeState
+
+	// Unrecognized are the authenticated events this verifier does not
+	// understand. Only populated when Options.AllowUnrecognizedEvents is set.
+	Unrecognized []UnrecognizedEvent
+
+	// GPUs are the verified GPUs of the NVIDIA attestation report. Only
+	// populated when Options.GpuVerifyOptions is set. With
+	// gpu.Options.MinVerifiedGPUs, GPUs that failed verification are left out.
+	GPUs []*gpu.VerifiedGPU
+}
+
+// UnrecognizedEvent is an authenticated CEL record whose content type, or COS
+// event type, is not understood by this verifier.
+type UnrecognizedEvent struct {
+	RecNum uint64
+	// Content is the record content. Its Type is the CEL content type, and for
+	// COS events its Value is the nested COS TLV.
+	Content cel.TLV
+}
+
+// RuntimeState contains the container runtime events measured after launch.
+type RuntimeState struct {
+	// RestartCount is the number of times the container has been restarted.
+	RestartCount uint64
+
+	// ExitStatuses are the exit statuses of the container, in the order the
+	// container exited.
+	ExitStatuses []int32
+
+	// Mounts are the volumes mounted into the container at runtime, in the
+	// order they were mounted.
+	Mounts []RuntimeMount
+}
+
+// RuntimeMount is a volume mounted into the container at runtime.
+type RuntimeMount struct {
+	Type        string
+	Source      string
+	Destination string
 }
 
 // ParseCOSCEL takes an encoded Attested COS CEL and MR bank, replays the CEL against the MRs,
 // and returns the AttestedCosState.
+//
+// Only the launch configuration is returned. Use ParseCOSEventLog to also get
+// the runtime events measured after the LaunchSeparator event.
 func ParseCOSCEL(cosEventLog []byte, p register.MRBank, opts Options) (*pb.AttestedCosState, error) {
+	state, err := ParseCOSEventLog(cosEventLog, p, opts)
+	if err != nil {
+		return nil, err
+	}
+	return state.Cos, nil
+}
+
+// ParseCOSEventLog takes an encoded Attested COS CEL and MR bank, replays the CEL against
+// the MRs, and returns the launch configuration and runtime history.
+func ParseCOSEventLog(cosEventLog []byte, p register.MRBank, opts Options) (*COSEventLogState, error) {
 	switch p.(type) {
 	case register.PCRBank:
 		return getCOSStateFromCEL(cosEventLog, p, cel.PCRType, opts)
@@ -31,26 +104,39 @@ func ParseCOSCEL(cosEventLog []byte, p register.MRBank, opts Options) (*pb.Attes
 	}
 }
 
-func getCOSStateFromCEL(rawCanonicalEventLog []byte, register register.MRBank, trustingRegisterType cel.MRType, opts Options) (*pb.AttestedCosState, error) {
+func getCOSStateFromCEL(rawCanonicalEventLog []byte, register register.MRBank, trustingRegisterType cel.MRType, opts Options) (*COSEventLogState, error) {
 	decodedCEL, err := cel.DecodeToCEL(bytes.NewBuffer(rawCanonicalEventLog))
 	if err != nil {
 		return nil, err
 	}
 	// Validate the COS event log first.
-	if err := decodedCEL.Replay(register); err != nil {
+	if err := ReplayCEL(decodedCEL, register, opts.DiagnoseReplayFailure); err != nil {
 		return nil, err
 	}
 
-	cosState, err := VerifiedCOSState(decodedCEL, uint8(trustingRegisterType), opts)
+	state, err := VerifiedCOSEventLog(decodedCEL, uint8(trustingRegisterType), opts)
 	if err != nil {
 		return nil, err
 	}
 
-	return cosState, err
+	return state, err
 }
 
 // VerifiedCOSState returns the AttestedCosState from the given event log.
+//
+// Only the launch configuration is returned. Use VerifiedCOSEventLog to also
+// get the runtime events measured after the LaunchSeparator event.
 func VerifiedCOSState(eventLog cel.CEL, registerType uint8, opts Options) (*pb.AttestedCosState, error) {
+	state, err := VerifiedCOSEventLog(eventLog, registerType, opts)
+	if err != nil {
+		return nil, err
+	}
+	return state.Cos, nil
+}
+
+// VerifiedCOSEventLog returns the launch configuration and runtime history from the
+// given event log.
+func VerifiedCOSEventLog(eventLog cel.CEL, registerType uint8, opts Options) (*COSEventLogState, error) {
 	cosState := &pb.AttestedCosState{}
 	cosState.Container = &pb.ContainerState{}
 	cosState.HealthMonitoring = &pb.HealthMonitoringState{}
@@ -59,6 +145,11 @@ func VerifiedCOSState(eventLog cel.CEL, registerType uint8, opts Options) (*pb.A
 	cosState.Container.EnvVars = make(map[string]string)
 	cosState.Container.OverriddenEnvVars = make(map[string]string)
 
+	runtimeState := &RuntimeState{}
+	var unrecognized []UnrecognizedEvent
+	var gpus []*gpu.VerifiedGPU
+	seenGpuReport := false
+
 	seenSeparator := false
 	for _, record := range eventLog.Records() {
 		if uint8(record.IndexType) != registerType {
@@ -78,24 +169,38 @@ func VerifiedCOSState(eventLog cel.CEL, registerType uint8, opts Options) (*pb.A
 			return nil, fmt.Errorf("unknown COS CEL log index type %d", record.IndexType)
 		}
 
-		// The Content.Type is not verified at this point, so we have to fail
-		// if we see any events that we do not understand. This ensures that
-		// we either verify the digest of event event in this PCR/RTMA, or we
-		// fail to replay the event log.
-		// TODO: See if we can fix this to have the Content Type be verified.
+		// The digests cover the whole marshaled Content TLV, so verifying them
+		// authenticates the Content.Type along with the event itself.
+		if err := cel.VerifyDigests(recordContent(record.Content), record.Digests); err != nil {
+			return nil, fmt.Errorf("failed to verify digests of CEL record %d: %v", record.RecNum, err)
+		}
+
+		if !coscel.IsCOSTLV(record.Content) {
+			if !opts.AllowUnrecognizedEvents {
+				return nil, fmt.Errorf("found non-COS CEL record %d with content type %d", record.RecNum, record.Content.Type)
+			}
+			unrecognized = append(unrecognized, UnrecognizedEvent{RecNum: record.RecNum, Content: record.Content})
+			continue
+		}
+
 		cosTlv, err := coscel.ParseToCOSTLV(record.Content)
 		if err != nil {
 			return nil, err
 		}
 
-		// verify digests for the cos cel content
-		if err := cel.VerifyDigests(cosTlv, record.Digests); err != nil {
-			return nil, err
+		if !isRecognizedCOSEventType(cosTlv.EventType) {
+			if !opts.AllowUnrecognizedEvents {
+				return nil, fmt.Errorf("found unknown COS Event Type %v", cosTlv.EventType)
+			}
+			unrecognized = append(unrecognized, UnrecognizedEvent{RecNum: record.RecNum, Content: record.Content})
+			continue
 		}
 
-		// TODO: Add support for post-separator container data
 		if seenSeparator {
-			return nil, fmt.Errorf("found COS Event Type %v after LaunchSeparator event", cosTlv.EventType)
+			if err := addRuntimeEvent(runtimeState, cosTlv); err != nil {
+				return nil, err
+			}
+			continue
 		}
 
 		switch cosTlv.EventType {
@@ -161,18 +266,120 @@ func VerifiedCOSState(eventLog cel.CEL, registerType uint8, opts Options) (*pb.A
 			}
 			cosState.GpuDeviceState.CcMode = pb.GPUDeviceCCMode(ccMode)
 		case coscel.GPUDeviceAttestationBindingType:
-			if opts.PopulateGpuDeviceState {
+			if opts.PopulateGpuDeviceState || opts.GpuVerifyOptions != nil {
 				report := &attestpb.NvidiaAttestationReport{}
 				if err := proto.Unmarshal(cosTlv.EventContent, report); err != nil {
 					return nil, fmt.Errorf("failed to unmarshal GPU attestation report: %v", err)
 				}
-				cosState.GpuDeviceState.NvidiaAttestationReport = report
+				if opts.GpuVerifyOptions != nil {
+					if seenGpuReport {
+						return nil, fmt.Errorf("found more than one GPUDeviceAttestationBinding event")
+					}
+					seenGpuReport = true
+					result, err := gpu.VerifyReport(report, *opts.GpuVerifyOptions)
+					if err != nil {
+						return nil, fmt.Errorf("failed to verify GPU attestation report: %v", err)
+					}
+					gpus = result.VerifiedGPUs()
+				}
+				if opts.PopulateGpuDeviceState {
+					cosState.GpuDeviceState.NvidiaAttestationReport = report
+				}
 			}
 
+		case coscel.ContainerRestartCountType, coscel.ContainerExitStatusType, coscel.RuntimeMountType:
+			return nil, fmt.Errorf("found runtime COS Event Type %v before LaunchSeparator event", cosTlv.EventType)
+
 		default:
 			return nil, fmt.Errorf("found unknown COS Event Type %v", cosTlv.EventType)
 		}
 
 	}
-	return cosState, nil
+	return &COSEventLogState{Cos: cosState, Runtime: runtimeState, Unrecognized: unrecognized, GPUs: gpus}, nil
+}
+
+// recordContent is the Content of a decoded CEL record. Its digest is computed
+// over the marshaled TLV, which is how COS events are measured.
+type recordContent cel.TLV
+
+// TLV returns the record content.
+func (r recordContent) TLV() (cel.TLV, error) {
+	return cel.TLV(r), nil
+}
+
+// GenerateDigest hashes the marshaled record content.
+func (r recordContent) GenerateDigest(hashAlgo crypto.Hash) ([]byte, error) {
+	b, err := cel.TLV(r).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := hashAlgo.New()
+	if _, err = hash.Write(b); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// isRecognizedCOSEventType returns whether the COS event type is understood by
+// this verifier.
+func isRecognizedCOSEventType(eventType coscel.ContentType) bool {
+	switch eventType {
+	case coscel.ImageRefType,
+		coscel.ImageDigestType,
+		coscel.RestartPolicyType,
+		coscel.ImageIDType,
+		coscel.ArgType,
+		coscel.EnvVarType,
+		coscel.OverrideArgType,
+		coscel.OverrideEnvType,
+		coscel.LaunchSeparatorType,
+		coscel.MemoryMonitorType,
+		coscel.GpuCCModeType,
+		coscel.GPUDeviceAttestationBindingType,
+		coscel.ContainerRestartCountType,
+		coscel.ContainerExitStatusType,
+		coscel.RuntimeMountType:
+		return true
+	default:
+		return false
+	}
+}
+
+// addRuntimeEvent adds a COS event measured after the LaunchSeparator event to the
+// runtime state. Launch configuration events are rejected after the separator.
+func addRuntimeEvent(runtimeState *RuntimeState, cosTlv coscel.COSTLV) error {
+	switch cosTlv.EventType {
+	case coscel.ContainerRestartCountType:
+		count, err := coscel.ParseRestartCount(cosTlv.EventContent)
+		if err != nil {
+			return err
+		}
+		if count <= runtimeState.RestartCount {
+			return fmt.Errorf("found non-increasing restart count %d after restart count %d", count, runtimeState.RestartCount)
+		}
+		runtimeState.RestartCount = count
+
+	case coscel.ContainerExitStatusType:
+		status, err := coscel.ParseExitStatus(cosTlv.EventContent)
+		if err != nil {
+			return err
+		}
+		runtimeState.ExitStatuses = append(runtimeState.ExitStatuses, status)
+
+	case coscel.RuntimeMountType:
+		mountType, source, destination, err := coscel.ParseMount(string(cosTlv.EventContent))
+		if err != nil {
+			return err
+		}
+		runtimeState.Mounts = append(runtimeState.Mounts, RuntimeMount{
+			Type:        mountType,
+			Source:      source,
+			Destination: destination,
+		})
+
+	default:
+		return fmt.Errorf("found COS Event Type %v after LaunchSeparator event", cosTlv.EventType)
+	}
+	return nil
 }
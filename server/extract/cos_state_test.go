@@ -3,11 +3,15 @@ package extract
 import (
 	"bytes"
 	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"math/rand"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/GoogleCloudPlatform/confidential-space/server/gpu"
+	"github.com/GoogleCloudPlatform/confidential-space/server/gpu/gputest"
 	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-configfs-tsm/configfs/fakertmr"
@@ -567,3 +571,337 @@ func extendDigestToPCR(tpm io.ReadWriter, algo crypto.Hash, mrIndex int, digest
 	}
 	return tpm2.PCRExtend(tpm, tpmutil.Handle(mrIndex), tpm2Algo, digest, "")
 }
+
+func appendCOSEvents(t *testing.T, cosEventLog cel.CEL, events []coscel.COSTLV) {
+	t.Helper()
+	for _, event := range events {
+		// VerifiedCOSEventLog does not replay the log, so the events don't need
+		// to be extended into a register.
+		if err := cosEventLog.AppendEvent(event, []crypto.Hash{crypto.SHA384}, coscel.COSCCELMRIndex, func(crypto.Hash, int, []byte) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerifiedCOSEventLogRuntimeEvents(t *testing.T) {
+	cosEventLog := cel.NewConfComputeMR()
+	appendCOSEvents(t, cosEventLog, []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/bazel/experimental/test:latest")},
+		{EventType: coscel.RestartPolicyType, EventContent: []byte(attestationpb.RestartPolicy_OnFailure.String())},
+		{EventType: coscel.LaunchSeparatorType},
+		{EventType: coscel.RuntimeMountType, EventContent: []byte("type=tmpfs,src=,dst=/tmp")},
+		{EventType: coscel.ContainerExitStatusType, EventContent: []byte("1")},
+		{EventType: coscel.ContainerRestartCountType, EventContent: []byte("1")},
+		{EventType: coscel.ContainerExitStatusType, EventContent: []byte("-1")},
+		{EventType: coscel.ContainerRestartCountType, EventContent: []byte("2")},
+		{EventType: coscel.RuntimeMountType, EventContent: []byte("type=bind,src=/mnt/disks/data,dst=/data")},
+	})
+
+	state, err := VerifiedCOSEventLog(cosEventLog, uint8(cel.CCMRType), Options{})
+	if err != nil {
+		t.Fatalf("VerifiedCOSEventLog() failed: %v", err)
+	}
+
+	if got := state.Cos.GetContainer().GetImageReference(); got != "docker.io/bazel/experimental/test:latest" {
+		t.Errorf("got image reference %q, want the launch image reference", got)
+	}
+	wantRuntimeState := &RuntimeState{
+		RestartCount: 2,
+		ExitStatuses: []int32{1, -1},
+		Mounts: []RuntimeMount{
+			{Type: "tmpfs", Source: "", Destination: "/tmp"},
+			{Type: "bind", Source: "/mnt/disks/data", Destination: "/data"},
+		},
+	}
+	if diff := cmp.Diff(state.Runtime, wantRuntimeState); diff != "" {
+		t.Errorf("unexpected runtime state diff: \n%v", diff)
+	}
+
+	// The launch configuration alone is unchanged by runtime events.
+	cosState, err := VerifiedCOSState(cosEventLog, uint8(cel.CCMRType), Options{})
+	if err != nil {
+		t.Fatalf("VerifiedCOSState() failed: %v", err)
+	}
+	if diff := cmp.Diff(cosState, state.Cos, protocmp.Transform()); diff != "" {
+		t.Errorf("unexpected cos state diff: \n%v", diff)
+	}
+}
+
+func TestVerifiedCOSEventLogRuntimeEventErrors(t *testing.T) {
+	testcases := []struct {
+		name   string
+		events []coscel.COSTLV
+	}{
+		{
+			name: "runtime event before separator",
+			events: []coscel.COSTLV{
+				{EventType: coscel.ContainerRestartCountType, EventContent: []byte("1")},
+				{EventType: coscel.LaunchSeparatorType},
+			},
+		},
+		{
+			name: "launch event after separator",
+			events: []coscel.COSTLV{
+				{EventType: coscel.LaunchSeparatorType},
+				{EventType: coscel.EnvVarType, EventContent: []byte("foo=bar")},
+			},
+		},
+		{
+			name: "second separator",
+			events: []coscel.COSTLV{
+				{EventType: coscel.LaunchSeparatorType},
+				{EventType: coscel.LaunchSeparatorType},
+			},
+		},
+		{
+			name: "non-increasing restart count",
+			events: []coscel.COSTLV{
+				{EventType: coscel.LaunchSeparatorType},
+				{EventType: coscel.ContainerRestartCountType, EventContent: []byte("2")},
+				{EventType: coscel.ContainerRestartCountType, EventContent: []byte("2")},
+			},
+		},
+		{
+			name: "malformed restart count",
+			events: []coscel.COSTLV{
+				{EventType: coscel.LaunchSeparatorType},
+				{EventType: coscel.ContainerRestartCountType, EventContent: []byte("-1")},
+			},
+		},
+		{
+			name: "malformed exit status",
+			events: []coscel.COSTLV{
+				{EventType: coscel.LaunchSeparatorType},
+				{EventType: coscel.ContainerExitStatusType, EventContent: []byte("exited")},
+			},
+		},
+		{
+			name: "malformed mount",
+			events: []coscel.COSTLV{
+				{EventType: coscel.LaunchSeparatorType},
+				{EventType: coscel.RuntimeMountType, EventContent: []byte("dst=/tmp,type=tmpfs,src=")},
+			},
+		},
+		{
+			name: "mount without destination",
+			events: []coscel.COSTLV{
+				{EventType: coscel.LaunchSeparatorType},
+				{EventType: coscel.RuntimeMountType, EventContent: []byte("type=tmpfs,src=,dst=")},
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			cosEventLog := cel.NewConfComputeMR()
+			appendCOSEvents(t, cosEventLog, tc.events)
+			if _, err := VerifiedCOSEventLog(cosEventLog, uint8(cel.CCMRType), Options{}); err == nil {
+				t.Errorf("VerifiedCOSEventLog() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestVerifiedCOSEventLogUnrecognizedEvents(t *testing.T) {
+	newEventLog := func(t *testing.T) cel.CEL {
+		t.Helper()
+		cosEventLog := cel.NewConfComputeMR()
+		appendCOSEvents(t, cosEventLog, []coscel.COSTLV{
+			{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/bazel/experimental/test:latest")},
+			{EventType: coscel.ContentType(200), EventContent: []byte("future launch event")},
+		})
+		nonCOSEvent, err := generateNonCOSCELEvent([]crypto.Hash{crypto.SHA384})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cosEventLog.AppendEvent(nonCOSEvent, []crypto.Hash{crypto.SHA384}, coscel.COSCCELMRIndex, func(crypto.Hash, int, []byte) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		appendCOSEvents(t, cosEventLog, []coscel.COSTLV{
+			{EventType: coscel.LaunchSeparatorType},
+			{EventType: coscel.ContentType(201), EventContent: []byte("future runtime event")},
+		})
+		return cosEventLog
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		cosEventLog := newEventLog(t)
+		state, err := VerifiedCOSEventLog(cosEventLog, uint8(cel.CCMRType), Options{AllowUnrecognizedEvents: true})
+		if err != nil {
+			t.Fatalf("VerifiedCOSEventLog() failed: %v", err)
+		}
+		if got := state.Cos.GetContainer().GetImageReference(); got != "docker.io/bazel/experimental/test:latest" {
+			t.Errorf("got image reference %q, want the launch image reference", got)
+		}
+
+		records := cosEventLog.Records()
+		wantUnrecognized := []UnrecognizedEvent{
+			{RecNum: records[1].RecNum, Content: records[1].Content},
+			{RecNum: records[2].RecNum, Content: records[2].Content},
+			{RecNum: records[4].RecNum, Content: records[4].Content},
+		}
+		if diff := cmp.Diff(state.Unrecognized, wantUnrecognized); diff != "" {
+			t.Errorf("unexpected unrecognized events diff: \n%v", diff)
+		}
+	})
+
+	t.Run("not allowed", func(t *testing.T) {
+		if _, err := VerifiedCOSEventLog(newEventLog(t), uint8(cel.CCMRType), Options{}); err == nil {
+			t.Errorf("VerifiedCOSEventLog() with unrecognized events succeeded, want error")
+		}
+	})
+
+	t.Run("tampered content type", func(t *testing.T) {
+		cosEventLog := newEventLog(t)
+		// Relabel a COS event as an unknown content type. The digests no longer
+		// match, so the event is not authenticated.
+		cosEventLog.Records()[0].Content.Type = 81
+		if _, err := VerifiedCOSEventLog(cosEventLog, uint8(cel.CCMRType), Options{AllowUnrecognizedEvents: true}); err == nil {
+			t.Errorf("VerifiedCOSEventLog() with tampered content type succeeded, want error")
+		}
+	})
+}
+
+func TestParseCOSEventLogFromBuilder(t *testing.T) {
+	report, _ := testGpuReport(t)
+
+	testcases := []struct {
+		name      string
+		mrType    cel.MRType
+		hashAlgos []crypto.Hash
+	}{
+		{"PCR", cel.PCRType, []crypto.Hash{crypto.SHA1, crypto.SHA256}},
+		{"CCMR", cel.CCMRType, nil},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			builder, err := coscel.NewBuilder(tc.mrType, tc.hashAlgos...)
+			if err != nil {
+				t.Fatalf("NewBuilder() failed: %v", err)
+			}
+			for _, appendEvent := range []func() error{
+				func() error { return builder.AppendImageRef("docker.io/bazel/experimental/test:latest") },
+				func() error { return builder.AppendImageDigest("sha256:781d8dfdd92118436bd914442c8339e653b83f6bf3c1a7a98efcfb7c4fed7483") },
+				func() error { return builder.AppendRestartPolicy(attestationpb.RestartPolicy_Never) },
+				func() error { return builder.AppendEnvVar("foo", "bar") },
+				func() error { return builder.AppendArg("--x") },
+				func() error { return builder.AppendMemoryMonitor(true) },
+				func() error { return builder.AppendGpuCCMode(attestationpb.GPUDeviceCCMode_ON) },
+				func() error { return builder.AppendGPUDeviceAttestationBinding(report) },
+				builder.AppendSeparator,
+				func() error { return builder.AppendRestartCount(1) },
+				func() error { return builder.AppendRuntimeMount("tmpfs", "", "/tmp") },
+			} {
+				if err := appendEvent(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			eventLog, err := builder.EncodeCEL()
+			if err != nil {
+				t.Fatal(err)
+			}
+			hashAlgos := tc.hashAlgos
+			if len(hashAlgos) == 0 {
+				hashAlgos = []crypto.Hash{crypto.SHA384}
+			}
+			for _, hashAlgo := range hashAlgos {
+				bank, err := builder.MRBank(hashAlgo)
+				if err != nil {
+					t.Fatalf("MRBank(%v) failed: %v", hashAlgo, err)
+				}
+				state, err := ParseCOSEventLog(eventLog, bank, Options{PopulateGpuDeviceState: true})
+				if err != nil {
+					t.Fatalf("ParseCOSEventLog() with %v bank failed: %v", hashAlgo, err)
+				}
+
+				wantContainerState := &attestationpb.ContainerState{
+					ImageReference:    "docker.io/bazel/experimental/test:latest",
+					ImageDigest:       "sha256:781d8dfdd92118436bd914442c8339e653b83f6bf3c1a7a98efcfb7c4fed7483",
+					RestartPolicy:     attestationpb.RestartPolicy_Never,
+					EnvVars:           map[string]string{"foo": "bar"},
+					OverriddenEnvVars: map[string]string{},
+					Args:              []string{"--x"},
+				}
+				if diff := cmp.Diff(state.Cos.Container, wantContainerState, protocmp.Transform()); diff != "" {
+					t.Errorf("unexpected container state diff: \n%v", diff)
+				}
+				if diff := cmp.Diff(state.Cos.GpuDeviceState.GetNvidiaAttestationReport(), report, protocmp.Transform()); diff != "" {
+					t.Errorf("unexpected GPU attestation report diff: \n%v", diff)
+				}
+				wantRuntimeState := &RuntimeState{
+					RestartCount: 1,
+					Mounts:       []RuntimeMount{{Type: "tmpfs", Destination: "/tmp"}},
+				}
+				if diff := cmp.Diff(state.Runtime, wantRuntimeState); diff != "" {
+					t.Errorf("unexpected runtime state diff: \n%v", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCOSEventLogVerifiesGpuReport(t *testing.T) {
+	device, err := gputest.NewDevice("GPU-0", attestpb.GpuArchitectureType_GPU_ARCHITECTURE_TYPE_HOPPER)
+	if err != nil {
+		t.Fatalf("gputest.NewDevice() failed: %v", err)
+	}
+	nonce := bytes.Repeat([]byte{0x42}, gpu.NonceSize)
+	gpuInfo, err := device.GpuInfo(nonce)
+	if err != nil {
+		t.Fatalf("GpuInfo() failed: %v", err)
+	}
+	report := &attestpb.NvidiaAttestationReport{
+		CcFeature: &attestpb.NvidiaAttestationReport_Spt{
+			Spt: &attestpb.NvidiaAttestationReport_SinglePassthroughAttestation{GpuQuote: gpuInfo},
+		},
+		Nonce: nonce,
+	}
+
+	builder, err := coscel.NewBuilder(cel.CCMRType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AppendGpuCCMode(attestationpb.GPUDeviceCCMode_ON); err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AppendGPUDeviceAttestationBinding(report); err != nil {
+		t.Fatal(err)
+	}
+	eventLog, err := builder.EncodeCEL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bank, err := builder.MRBank(crypto.SHA384)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := ParseCOSEventLog(eventLog, bank, Options{GpuVerifyOptions: &gpu.Options{Roots: device.Roots()}})
+	if err != nil {
+		t.Fatalf("ParseCOSEventLog() failed: %v", err)
+	}
+	deviceID := sha256.Sum256(device.Leaf.RawSubjectPublicKeyInfo)
+	wantGPUs := []*gpu.VerifiedGPU{{
+		UUID:          "GPU-0",
+		DeviceID:      hex.EncodeToString(deviceID[:]),
+		Architecture:  attestpb.GpuArchitectureType_GPU_ARCHITECTURE_TYPE_HOPPER,
+		DriverVersion: device.DriverVersion,
+		VbiosVersion:  device.VbiosVersion,
+	}}
+	if diff := cmp.Diff(wantGPUs, state.GPUs); diff != "" {
+		t.Errorf("unexpected verified GPUs diff (-want +got):\n%v", diff)
+	}
+	if state.Cos.GpuDeviceState.GetNvidiaAttestationReport() != nil {
+		t.Errorf("GPU attestation report populated without PopulateGpuDeviceState")
+	}
+
+	otherDevice, err := gputest.NewDevice("GPU-1", attestpb.GpuArchitectureType_GPU_ARCHITECTURE_TYPE_HOPPER)
+	if err != nil {
+		t.Fatalf("gputest.NewDevice() failed: %v", err)
+	}
+	if _, err := ParseCOSEventLog(eventLog, bank, Options{GpuVerifyOptions: &gpu.Options{Roots: otherDevice.Roots()}}); err == nil {
+		t.Errorf("ParseCOSEventLog() with untrusted GPU roots succeeded, want error")
+	}
+}
@@ -0,0 +1,61 @@
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+// LaunchPolicy restricts the launch configuration an operator may apply to a
+// workload, as measured in the AttestedCosState.
+type LaunchPolicy struct {
+	// AllowedOverriddenEnvVars are the names of the env vars the operator may
+	// override. No env var may be overridden if empty.
+	AllowedOverriddenEnvVars []string
+	// AllowOverriddenArgs is whether the operator may override the container args.
+	AllowOverriddenArgs bool
+	// AllowedRestartPolicies are the restart policies the container may run with.
+	// Any restart policy is allowed if empty.
+	AllowedRestartPolicies []pb.RestartPolicy
+	// RequireMemoryMonitoring is whether memory monitoring must be enabled.
+	RequireMemoryMonitoring bool
+}
+
+// EvaluateLaunchPolicy checks the COS state against the launch policy. It returns
+// nil if the state complies with the policy, or an error joining every violation.
+func EvaluateLaunchPolicy(cosState *pb.AttestedCosState, policy LaunchPolicy) error {
+	if cosState == nil {
+		return fmt.Errorf("COS state is nil")
+	}
+
+	var violations []error
+	container := cosState.GetContainer()
+
+	var envVars []string
+	for name := range container.GetOverriddenEnvVars() {
+		envVars = append(envVars, name)
+	}
+	sort.Strings(envVars)
+	for _, name := range envVars {
+		if !slices.Contains(policy.AllowedOverriddenEnvVars, name) {
+			violations = append(violations, fmt.Errorf("env var %q is overridden, but the launch policy does not allow it", name))
+		}
+	}
+
+	if !policy.AllowOverriddenArgs && len(container.GetOverriddenArgs()) != 0 {
+		violations = append(violations, fmt.Errorf("args are overridden with %q, but the launch policy does not allow it", container.GetOverriddenArgs()))
+	}
+
+	if len(policy.AllowedRestartPolicies) != 0 && !slices.Contains(policy.AllowedRestartPolicies, container.GetRestartPolicy()) {
+		violations = append(violations, fmt.Errorf("restart policy %v is not allowed by the launch policy, want one of %v", container.GetRestartPolicy(), policy.AllowedRestartPolicies))
+	}
+
+	if policy.RequireMemoryMonitoring && !cosState.GetHealthMonitoring().GetMemoryEnabled() {
+		violations = append(violations, errors.New("memory monitoring is not enabled, but the launch policy requires it"))
+	}
+
+	return errors.Join(violations...)
+}
@@ -0,0 +1,109 @@
+package extract
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+func testCosState(memoryEnabled bool) *pb.AttestedCosState {
+	return &pb.AttestedCosState{
+		Container: &pb.ContainerState{
+			ImageReference:    "docker.io/library/hello-world:latest",
+			RestartPolicy:     pb.RestartPolicy_Never,
+			OverriddenArgs:    []string{"--debug"},
+			OverriddenEnvVars: map[string]string{"FOO": "foo", "BAR": "bar", "BAZ": "baz"},
+		},
+		HealthMonitoring: &pb.HealthMonitoringState{MemoryEnabled: &memoryEnabled},
+	}
+}
+
+func TestEvaluateLaunchPolicy(t *testing.T) {
+	testCases := []struct {
+		name     string
+		state    *pb.AttestedCosState
+		policy   LaunchPolicy
+		wantErrs []string
+	}{
+		{
+			name:  "compliant",
+			state: testCosState(true),
+			policy: LaunchPolicy{
+				AllowedOverriddenEnvVars: []string{"FOO", "BAR", "BAZ"},
+				AllowOverriddenArgs:      true,
+				AllowedRestartPolicies:   []pb.RestartPolicy{pb.RestartPolicy_Never},
+				RequireMemoryMonitoring:  true,
+			},
+		},
+		{
+			name:  "empty policy allows no overrides",
+			state: testCosState(false),
+			wantErrs: []string{
+				`env var "BAR"`,
+				`env var "BAZ"`,
+				`env var "FOO"`,
+				"args are overridden",
+			},
+		},
+		{
+			name:  "every violation",
+			state: testCosState(false),
+			policy: LaunchPolicy{
+				AllowedOverriddenEnvVars: []string{"FOO", "BAR"},
+				AllowedRestartPolicies:   []pb.RestartPolicy{pb.RestartPolicy_Always, pb.RestartPolicy_OnFailure},
+				RequireMemoryMonitoring:  true,
+			},
+			wantErrs: []string{
+				`env var "BAZ"`,
+				"args are overridden",
+				"restart policy Never",
+				"memory monitoring is not enabled",
+			},
+		},
+		{
+			name:   "missing health monitoring",
+			state:  &pb.AttestedCosState{Container: &pb.ContainerState{}},
+			policy: LaunchPolicy{RequireMemoryMonitoring: true},
+			wantErrs: []string{
+				"memory monitoring is not enabled",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := EvaluateLaunchPolicy(tc.state, tc.policy)
+			if len(tc.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("EvaluateLaunchPolicy() failed: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("EvaluateLaunchPolicy() succeeded, want %d violations", len(tc.wantErrs))
+			}
+			joined, ok := err.(interface{ Unwrap() []error })
+			if !ok {
+				t.Fatalf("EvaluateLaunchPolicy() returned %T, want a joined error", err)
+			}
+			violations := joined.Unwrap()
+			if len(violations) != len(tc.wantErrs) {
+				t.Fatalf("EvaluateLaunchPolicy() returned %d violations, want %d: %v", len(violations), len(tc.wantErrs), err)
+			}
+			for i, want := range tc.wantErrs {
+				if !strings.Contains(violations[i].Error(), want) {
+					t.Errorf("violation %d = %q, want it to contain %q", i, violations[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateLaunchPolicyNilState(t *testing.T) {
+	err := EvaluateLaunchPolicy(nil, LaunchPolicy{})
+	if err == nil || errors.Unwrap(err) != nil {
+		t.Errorf("EvaluateLaunchPolicy(nil) = %v, want a single error", err)
+	}
+}
@@ -0,0 +1,241 @@
+package extract
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-eventlog/cel"
+	"github.com/google/go-eventlog/register"
+	"github.com/google/go-eventlog/tcg"
+)
+
+// ReplayReport describes how a CEL replays against a register bank, to help
+// find the record that was tampered with or is missing when a replay fails.
+type ReplayReport struct {
+	// Hash is the hash algorithm of the register bank.
+	Hash crypto.Hash
+	// MRs has one entry per MR index found in the CEL, in increasing order.
+	MRs []MRReplay
+	// DigestMismatches are the records whose content does not match their
+	// digests, as found by cel.VerifyDigests.
+	DigestMismatches []DigestMismatch
+}
+
+// MRReplay is the replay result of a single MR.
+type MRReplay struct {
+	// Index is the CEL MR index of the records, e.g. a PCR index or a CCMR index.
+	Index uint8
+	// Quoted is the value of the MR in the register bank, or nil if the bank
+	// has no such MR.
+	Quoted []byte
+	// Replayed is the value recomputed from the CEL records for the MR.
+	Replayed []byte
+	// LastConsistentRecNum is the RecNum of the last record after which the
+	// recomputed value equals Quoted, or nil if there is no such record. When
+	// the replay fails, records after it were added or tampered with.
+	LastConsistentRecNum *uint64
+}
+
+// Consistent returns whether the recomputed value equals the quoted value.
+func (m MRReplay) Consistent() bool {
+	return m.Quoted != nil && bytes.Equal(m.Quoted, m.Replayed)
+}
+
+// DigestMismatch is a CEL record whose content does not match its digests.
+type DigestMismatch struct {
+	RecNum uint64
+	Index  uint8
+	Err    error
+}
+
+// String formats the report for humans.
+func (r *ReplayReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEL replay report for bank %v:\n", r.Hash)
+	for _, mr := range r.MRs {
+		lastConsistent := "none"
+		if mr.LastConsistentRecNum != nil {
+			lastConsistent = fmt.Sprint(*mr.LastConsistentRecNum)
+		}
+		fmt.Fprintf(&b, "  MR %d: consistent=%v quoted=%x replayed=%x last consistent record=%s\n",
+			mr.Index, mr.Consistent(), mr.Quoted, mr.Replayed, lastConsistent)
+	}
+	for _, mismatch := range r.DigestMismatches {
+		fmt.Fprintf(&b, "  record %d (MR %d): %v\n", mismatch.RecNum, mismatch.Index, mismatch.Err)
+	}
+	return b.String()
+}
+
+// ReplayError is returned in place of a CEL replay error when diagnostics are
+// requested. Use errors.As to get the report.
+type ReplayError struct {
+	Err    error
+	Report *ReplayReport
+}
+
+func (e *ReplayError) Error() string {
+	return fmt.Sprintf("%v\n%v", e.Err, e.Report)
+}
+
+func (e *ReplayError) Unwrap() error {
+	return e.Err
+}
+
+// DiagnoseReplay replays the CEL against the register bank record by record and
+// returns a report of the quoted and recomputed value of each MR, the last
+// record consistent with the quoted value, and the records whose content does
+// not match their digests.
+func DiagnoseReplay(eventLog cel.CEL, bank register.MRBank) (*ReplayReport, error) {
+	cryptoHash, err := bank.CryptoHash()
+	if err != nil {
+		return nil, err
+	}
+
+	quoted := make(map[int][]byte)
+	for _, mr := range bank.MRs() {
+		quoted[mr.Idx()] = mr.Dgst()
+	}
+
+	report := &ReplayReport{Hash: cryptoHash}
+	mrs := make(map[uint8]*MRReplay)
+	for _, record := range eventLog.Records() {
+		mr, ok := mrs[record.Index]
+		if !ok {
+			mr = &MRReplay{
+				Index:    record.Index,
+				Quoted:   quoted[int(record.Index)],
+				Replayed: make([]byte, cryptoHash.Size()),
+			}
+			mrs[record.Index] = mr
+		}
+
+		if err := cel.VerifyDigests(recordContent(record.Content), record.Digests); err != nil {
+			report.DigestMismatches = append(report.DigestMismatches, DigestMismatch{
+				RecNum: record.RecNum,
+				Index:  record.Index,
+				Err:    err,
+			})
+		}
+
+		digest, ok := record.Digests[cryptoHash]
+		if !ok {
+			report.DigestMismatches = append(report.DigestMismatches, DigestMismatch{
+				RecNum: record.RecNum,
+				Index:  record.Index,
+				Err:    fmt.Errorf("record has no %v digest", cryptoHash),
+			})
+			continue
+		}
+		hasher := cryptoHash.New()
+		hasher.Write(mr.Replayed)
+		hasher.Write(digest)
+		mr.Replayed = hasher.Sum(nil)
+
+		if mr.Quoted != nil && bytes.Equal(mr.Replayed, mr.Quoted) {
+			recNum := record.RecNum
+			mr.LastConsistentRecNum = &recNum
+		}
+	}
+
+	for _, mr := range mrs {
+		report.MRs = append(report.MRs, *mr)
+	}
+	sort.Slice(report.MRs, func(i, j int) bool { return report.MRs[i].Index < report.MRs[j].Index })
+	return report, nil
+}
+
+// DiagnoseTCGReplay replays the events of a TCG PC Client event log against the
+// PCR bank the way tcg.ParseAndReplay does, and returns the same report as
+// DiagnoseReplay. events are the events of the bank's hash algorithm, as
+// returned by tcg.EventLog.Events, and the RecNum of an event is its position
+// in them. Events without a digest for the bank are reported as digest
+// mismatches.
+func DiagnoseTCGReplay(events []tcg.Event, bank register.MRBank) (*ReplayReport, error) {
+	cryptoHash, err := bank.CryptoHash()
+	if err != nil {
+		return nil, err
+	}
+
+	quoted := make(map[int][]byte)
+	for _, mr := range bank.MRs() {
+		quoted[mr.Idx()] = mr.Dgst()
+	}
+
+	report := &ReplayReport{Hash: cryptoHash}
+	mrs := make(map[uint8]*MRReplay)
+	localities := make(map[uint8]byte)
+	for i, event := range events {
+		if event.Index < 0 || event.Index > 0xff {
+			return nil, fmt.Errorf("event %d has invalid PCR index %d", i, event.Index)
+		}
+		index := uint8(event.Index)
+
+		// A StartupLocality event sets the initial value of PCR0 to the locality
+		// TPM2_Startup was issued from. No other EV_NO_ACTION event is extended.
+		if event.Type == tcg.NoAction {
+			if index == 0 && len(event.Data) == 17 && strings.HasPrefix(string(event.Data), "StartupLocality") {
+				localities[index] = event.Data[len(event.Data)-1]
+			}
+			continue
+		}
+
+		mr, ok := mrs[index]
+		if !ok {
+			mr = &MRReplay{Index: index, Quoted: quoted[event.Index]}
+			mrs[index] = mr
+		}
+		// An H-CRTM event resets the PCR to {0, ..., 0, 4} before it is extended.
+		if event.Type == tcg.EFIHCRTMEvent {
+			mr.Replayed = append(bytes.Repeat([]byte{0x00}, cryptoHash.Size()-1), 0x04)
+		}
+
+		recNum := uint64(i)
+		if event.Digest == nil {
+			report.DigestMismatches = append(report.DigestMismatches, DigestMismatch{
+				RecNum: recNum,
+				Index:  index,
+				Err:    fmt.Errorf("event has no %v digest", cryptoHash),
+			})
+			continue
+		}
+		if mr.Replayed == nil {
+			mr.Replayed = make([]byte, cryptoHash.Size())
+			mr.Replayed[len(mr.Replayed)-1] = localities[index]
+		}
+		hasher := cryptoHash.New()
+		hasher.Write(mr.Replayed)
+		hasher.Write(event.Digest)
+		mr.Replayed = hasher.Sum(nil)
+
+		if mr.Quoted != nil && bytes.Equal(mr.Replayed, mr.Quoted) {
+			mr.LastConsistentRecNum = &recNum
+		}
+	}
+
+	for _, mr := range mrs {
+		if mr.Replayed == nil {
+			mr.Replayed = make([]byte, cryptoHash.Size())
+		}
+		report.MRs = append(report.MRs, *mr)
+	}
+	sort.Slice(report.MRs, func(i, j int) bool { return report.MRs[i].Index < report.MRs[j].Index })
+	return report, nil
+}
+
+// ReplayCEL replays the CEL against the register bank. If diagnose is set, a
+// replay failure is returned as a *ReplayError carrying a ReplayReport.
+func ReplayCEL(eventLog cel.CEL, bank register.MRBank, diagnose bool) error {
+	replayErr := eventLog.Replay(bank)
+	if replayErr == nil || !diagnose {
+		return replayErr
+	}
+
+	report, err := DiagnoseReplay(eventLog, bank)
+	if err != nil {
+		return fmt.Errorf("%v (failed to diagnose replay: %v)", replayErr, err)
+	}
+	return &ReplayError{Err: replayErr, Report: report}
+}
@@ -0,0 +1,190 @@
+package extract
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-eventlog/cel"
+	"github.com/google/go-eventlog/proto/state"
+	"github.com/google/go-eventlog/register"
+	"github.com/google/go-eventlog/tcg"
+)
+
+func testBuilder(t *testing.T) *coscel.Builder {
+	t.Helper()
+	builder, err := coscel.NewBuilder(cel.PCRType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AppendImageRef("docker.io/bazel/experimental/test:latest"); err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AppendArg("--x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AppendSeparator(); err != nil {
+		t.Fatal(err)
+	}
+	return builder
+}
+
+func testBuilderBank(t *testing.T, builder *coscel.Builder) register.MRBank {
+	t.Helper()
+	bank, err := builder.MRBank(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bank
+}
+
+func TestDiagnoseReplayConsistent(t *testing.T) {
+	builder := testBuilder(t)
+	report, err := DiagnoseReplay(builder.CEL(), testBuilderBank(t, builder))
+	if err != nil {
+		t.Fatalf("DiagnoseReplay() failed: %v", err)
+	}
+
+	if len(report.MRs) != 1 {
+		t.Fatalf("got %d MRs in report, want 1", len(report.MRs))
+	}
+	mr := report.MRs[0]
+	if mr.Index != coscel.EventPCRIndex || !mr.Consistent() {
+		t.Errorf("got MR %d consistent=%v, want MR %d consistent", mr.Index, mr.Consistent(), coscel.EventPCRIndex)
+	}
+	if mr.LastConsistentRecNum == nil || *mr.LastConsistentRecNum != 2 {
+		t.Errorf("got last consistent record %v, want 2", mr.LastConsistentRecNum)
+	}
+	if len(report.DigestMismatches) != 0 {
+		t.Errorf("got digest mismatches %v, want none", report.DigestMismatches)
+	}
+}
+
+func TestDiagnoseReplayAddedRecord(t *testing.T) {
+	builder := testBuilder(t)
+	bank := testBuilderBank(t, builder)
+	// An event appended to the log after the bank was quoted.
+	if err := builder.AppendRestartCount(1); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := DiagnoseReplay(builder.CEL(), bank)
+	if err != nil {
+		t.Fatalf("DiagnoseReplay() failed: %v", err)
+	}
+	mr := report.MRs[0]
+	if mr.Consistent() {
+		t.Errorf("MR %d is consistent, want inconsistent", mr.Index)
+	}
+	if mr.LastConsistentRecNum == nil || *mr.LastConsistentRecNum != 2 {
+		t.Errorf("got last consistent record %v, want 2", mr.LastConsistentRecNum)
+	}
+}
+
+func TestDiagnoseReplayTamperedContent(t *testing.T) {
+	builder := testBuilder(t)
+	bank := testBuilderBank(t, builder)
+	builder.CEL().Records()[1].Content.Value = []byte("tampered")
+
+	report, err := DiagnoseReplay(builder.CEL(), bank)
+	if err != nil {
+		t.Fatalf("DiagnoseReplay() failed: %v", err)
+	}
+	// The digests are untouched, so the replay is consistent but the record
+	// content no longer matches its digests.
+	if !report.MRs[0].Consistent() {
+		t.Errorf("MR %d is inconsistent, want consistent", report.MRs[0].Index)
+	}
+	if len(report.DigestMismatches) != 1 || report.DigestMismatches[0].RecNum != 1 {
+		t.Errorf("got digest mismatches %v, want record 1", report.DigestMismatches)
+	}
+}
+
+func TestDiagnoseReplayMissingRegister(t *testing.T) {
+	builder := testBuilder(t)
+	report, err := DiagnoseReplay(builder.CEL(), register.PCRBank{TCGHashAlgo: state.HashAlgo_SHA256})
+	if err != nil {
+		t.Fatalf("DiagnoseReplay() failed: %v", err)
+	}
+	mr := report.MRs[0]
+	if mr.Quoted != nil || mr.Consistent() || mr.LastConsistentRecNum != nil {
+		t.Errorf("got MR report %+v, want no quoted value and no consistent record", mr)
+	}
+}
+
+func TestDiagnoseTCGReplay(t *testing.T) {
+	rawLog, err := os.ReadFile("../vm/testdata/cos_101_amd_sev_eventlog.bin")
+	if err != nil {
+		t.Fatalf("failed to read TCG event log: %v", err)
+	}
+	eventLog, err := tcg.ParseEventLog(rawLog, tcg.ParseOpts{})
+	if err != nil {
+		t.Fatalf("ParseEventLog() failed: %v", err)
+	}
+	events := eventLog.Events(register.HashSHA256)
+
+	// Diagnosing against an empty bank recomputes every PCR; the recomputed
+	// values must then replay with tcg.ParseAndReplay.
+	report, err := DiagnoseTCGReplay(events, register.PCRBank{TCGHashAlgo: state.HashAlgo_SHA256})
+	if err != nil {
+		t.Fatalf("DiagnoseTCGReplay() failed: %v", err)
+	}
+	if len(report.DigestMismatches) != 0 {
+		t.Errorf("got digest mismatches %v, want none", report.DigestMismatches)
+	}
+	bank := register.PCRBank{TCGHashAlgo: state.HashAlgo_SHA256}
+	for _, mr := range report.MRs {
+		bank.PCRs = append(bank.PCRs, register.PCR{Index: int(mr.Index), Digest: mr.Replayed, DigestAlg: crypto.SHA256})
+	}
+	if _, err := tcg.ParseAndReplay(rawLog, bank.MRs(), tcg.ParseOpts{}); err != nil {
+		t.Fatalf("ParseAndReplay() against the recomputed PCRs failed: %v", err)
+	}
+
+	report, err = DiagnoseTCGReplay(events, bank)
+	if err != nil {
+		t.Fatalf("DiagnoseTCGReplay() failed: %v", err)
+	}
+	for _, mr := range report.MRs {
+		if !mr.Consistent() || mr.LastConsistentRecNum == nil {
+			t.Errorf("got MR %d consistent=%v, want consistent", mr.Index, mr.Consistent())
+		}
+	}
+
+	bank.PCRs[0].Digest = make([]byte, 32)
+	report, err = DiagnoseTCGReplay(events, bank)
+	if err != nil {
+		t.Fatalf("DiagnoseTCGReplay() failed: %v", err)
+	}
+	if mr := report.MRs[0]; int(mr.Index) != bank.PCRs[0].Index || mr.Consistent() || mr.LastConsistentRecNum != nil {
+		t.Errorf("got MR report %+v, want PCR %d inconsistent with no consistent record", mr, bank.PCRs[0].Index)
+	}
+}
+
+func TestParseCOSEventLogReplayError(t *testing.T) {
+	builder := testBuilder(t)
+	bank := testBuilderBank(t, builder)
+	if err := builder.AppendRestartCount(1); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := builder.CEL().EncodeCEL(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ParseCOSEventLog(buf.Bytes(), bank, Options{DiagnoseReplayFailure: true})
+	var replayErr *ReplayError
+	if !errors.As(err, &replayErr) {
+		t.Fatalf("ParseCOSEventLog() got error %v, want *ReplayError", err)
+	}
+	if got := *replayErr.Report.MRs[0].LastConsistentRecNum; got != 2 {
+		t.Errorf("got last consistent record %d, want 2", got)
+	}
+
+	_, err = ParseCOSEventLog(buf.Bytes(), bank, Options{})
+	if err == nil || errors.As(err, &replayErr) {
+		t.Errorf("ParseCOSEventLog() without diagnostics got error %v, want a plain replay error", err)
+	}
+}
@@ -0,0 +1,288 @@
+// Package gpu verifies NVIDIA GPU attestation reports.
+package gpu
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+)
+
+// Options contains the options for verifying an NVIDIA GPU attestation report.
+type Options struct {
+	// Roots are the NVIDIA device identity roots the GPU attestation
+	// certificate chains must chain to, for architectures without an entry in
+	// ArchitectureRoots.
+	Roots *x509.CertPool
+	// ArchitectureRoots are the device identity roots of each GPU architecture,
+	// e.g. separate roots for Hopper and Blackwell GPUs.
+	ArchitectureRoots map[attestpb.GpuArchitectureType]*x509.CertPool
+	// MinVerifiedGPUs is the minimum number of GPUs that must be verified for
+	// the report to be verified. If 0, every GPU must be verified.
+	MinVerifiedGPUs int
+	// CurrentTime is the time to verify the certificate chains at. Defaults to
+	// the current time.
+	CurrentTime time.Time
+}
+
+// VerifiedGPU is a GPU whose attestation report was verified. The driver and
+// VBIOS versions are taken from the signed report.
+type VerifiedGPU struct {
+	// UUID is the UUID the GPU quote reports. The attestation report does not
+	// sign it, so it is only bound to the GPU through DeviceID: VerifyReport
+	// rejects a report in which a UUID or a DeviceID appears twice.
+	UUID string
+	// DeviceID identifies the GPU by the signed device identity: the hex
+	// SHA-256 digest of the attestation certificate's SubjectPublicKeyInfo.
+	DeviceID      string
+	Architecture  attestpb.GpuArchitectureType
+	DriverVersion string
+	VbiosVersion  string
+}
+
+// Result is the verification result of an NVIDIA attestation report.
+type Result struct {
+	// GPUs has one result per GPU quote, in report order.
+	GPUs []GPUResult
+	// Verified is the overall verdict: the GPU UUIDs and device identities are
+	// unique, and enough GPUs were verified to satisfy Options.MinVerifiedGPUs.
+	Verified bool
+}
+
+// GPUResult is the verification result of a single GPU quote.
+type GPUResult struct {
+	UUID         string
+	Architecture attestpb.GpuArchitectureType
+	// GPU is the verified GPU, or nil if the GPU failed verification.
+	GPU *VerifiedGPU
+	// Err is the reason the GPU failed verification.
+	Err error
+}
+
+// VerifiedGPUs returns the GPUs that passed verification.
+func (r *Result) VerifiedGPUs() []*VerifiedGPU {
+	var gpus []*VerifiedGPU
+	for _, result := range r.GPUs {
+		if result.GPU != nil {
+			gpus = append(gpus, result.GPU)
+		}
+	}
+	return gpus
+}
+
+// VerifyReport verifies the attestation report of every GPU in the NVIDIA
+// attestation report, in SPT or MPT mode, and returns the per-GPU results and
+// the overall verdict.
+//
+// Each GPU's certificate chain is validated against the roots of its
+// architecture, the SPDM MEASUREMENTS response signature is verified with the
+// chain's leaf key, and the SPDM request nonce is checked against the report
+// nonce. A GPU UUID and a GPU device identity, the attestation certificate's
+// key, may each only appear once, so a copy of one GPU's quote under another
+// UUID does not count as another GPU.
+//
+// An error is returned if the report is malformed or the overall verdict is
+// negative. The Result is returned along with a negative verdict.
+func VerifyReport(report *attestpb.NvidiaAttestationReport, opts Options) (*Result, error) {
+	if report == nil {
+		return nil, errors.New("NVIDIA attestation report is nil")
+	}
+	if opts.MinVerifiedGPUs < 0 {
+		return nil, fmt.Errorf("invalid minimum number of verified GPUs %d", opts.MinVerifiedGPUs)
+	}
+
+	var gpus []*attestpb.GpuInfo
+	switch {
+	case report.GetSpt() != nil:
+		gpus = []*attestpb.GpuInfo{report.GetSpt().GetGpuQuote()}
+	case report.GetMpt() != nil:
+		gpus = report.GetMpt().GetGpuQuotes()
+	default:
+		return nil, errors.New("NVIDIA attestation report has no SPT or MPT attestation")
+	}
+	if len(gpus) == 0 {
+		return nil, errors.New("NVIDIA attestation report has no GPU quotes")
+	}
+
+	result := &Result{}
+	var errs []error
+	uuids := make(map[string]bool)
+	deviceIDs := make(map[string]bool)
+	duplicate := false
+	for i, gpu := range gpus {
+		gpuResult := GPUResult{UUID: gpu.GetUuid(), Architecture: gpu.GetGpuArchitectureType()}
+		if uuids[gpu.GetUuid()] {
+			gpuResult.Err = fmt.Errorf("duplicate GPU UUID %q", gpu.GetUuid())
+			duplicate = true
+		} else {
+			uuids[gpu.GetUuid()] = true
+			gpuResult.GPU, gpuResult.Err = VerifyGPU(gpu, report.GetNonce(), opts)
+		}
+		if gpuResult.GPU != nil {
+			if deviceIDs[gpuResult.GPU.DeviceID] {
+				gpuResult.GPU, gpuResult.Err = nil, fmt.Errorf("duplicate GPU device %s", gpuResult.GPU.DeviceID)
+				duplicate = true
+			} else {
+				deviceIDs[gpuResult.GPU.DeviceID] = true
+			}
+		}
+		if gpuResult.Err != nil {
+			errs = append(errs, fmt.Errorf("failed to verify GPU %d (%s): %v", i, gpu.GetUuid(), gpuResult.Err))
+		}
+		result.GPUs = append(result.GPUs, gpuResult)
+	}
+
+	if duplicate {
+		return result, fmt.Errorf("NVIDIA attestation report has duplicate GPUs: %v", errors.Join(errs...))
+	}
+	minVerified := opts.MinVerifiedGPUs
+	if minVerified == 0 {
+		minVerified = len(gpus)
+	}
+	if verified := len(result.VerifiedGPUs()); verified < minVerified {
+		return result, fmt.Errorf("%d of %d GPUs verified, want at least %d: %v", verified, len(gpus), minVerified, errors.Join(errs...))
+	}
+	result.Verified = true
+	return result, nil
+}
+
+// VerifyGPU verifies the attestation report of a single GPU against the nonce.
+func VerifyGPU(gpu *attestpb.GpuInfo, nonce []byte, opts Options) (*VerifiedGPU, error) {
+	if gpu == nil {
+		return nil, errors.New("GPU quote is nil")
+	}
+	roots := opts.Roots
+	if archRoots, ok := opts.ArchitectureRoots[gpu.GetGpuArchitectureType()]; ok {
+		roots = archRoots
+	}
+	if roots == nil {
+		return nil, fmt.Errorf("no NVIDIA roots for GPU architecture %v", gpu.GetGpuArchitectureType())
+	}
+
+	leaf, err := verifyCertChain(gpu.GetAttestationCertificateChain(), roots, opts.CurrentTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify attestation certificate chain: %v", err)
+	}
+
+	report, err := parseSPDMReport(gpu.GetAttestationReport())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse attestation report: %v", err)
+	}
+	if !bytes.Equal(report.requestNonce, nonce) {
+		return nil, fmt.Errorf("attestation report nonce %x does not match the report nonce %x", report.requestNonce, nonce)
+	}
+	if err := verifySignature(leaf, report); err != nil {
+		return nil, err
+	}
+
+	driverVersion, err := report.driverVersion()
+	if err != nil {
+		return nil, err
+	}
+	vbiosVersion, err := report.vbiosVersion()
+	if err != nil {
+		return nil, err
+	}
+	if gpu.GetDriverVersion() != "" && gpu.GetDriverVersion() != driverVersion {
+		return nil, fmt.Errorf("driver version %q does not match the attested driver version %q", gpu.GetDriverVersion(), driverVersion)
+	}
+	if gpu.GetVbiosVersion() != "" && gpu.GetVbiosVersion() != vbiosVersion {
+		return nil, fmt.Errorf("VBIOS version %q does not match the attested VBIOS version %q", gpu.GetVbiosVersion(), vbiosVersion)
+	}
+
+	return &VerifiedGPU{
+		UUID:          gpu.GetUuid(),
+		DeviceID:      deviceID(leaf),
+		Architecture:  gpu.GetGpuArchitectureType(),
+		DriverVersion: driverVersion,
+		VbiosVersion:  vbiosVersion,
+	}, nil
+}
+
+// deviceID returns the hex SHA-256 digest of the attestation certificate's
+// SubjectPublicKeyInfo.
+func deviceID(leaf *x509.Certificate) string {
+	digest := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(digest[:])
+}
+
+// DeviceID returns the device identity of the GPU quote, as VerifiedGPU.DeviceID,
+// without verifying its certificate chain. It is meant for GPU quotes that are
+// already trusted, e.g. because they were measured.
+func DeviceID(gpu *attestpb.GpuInfo) (string, error) {
+	certs, err := parseCertChain(gpu.GetAttestationCertificateChain())
+	if err != nil {
+		return "", fmt.Errorf("failed to parse attestation certificate chain: %v", err)
+	}
+	return deviceID(certs[0]), nil
+}
+
+// parseCertChain parses the PEM certificate chain, leaf first.
+func parseCertChain(chain []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for rest := chain; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %d: %v", len(certs), err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM certificates found")
+	}
+	return certs, nil
+}
+
+// verifyCertChain verifies the PEM certificate chain, leaf first, against the
+// roots and returns the leaf.
+func verifyCertChain(chain []byte, roots *x509.CertPool, currentTime time.Time) (*x509.Certificate, error) {
+	certs, err := parseCertChain(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   currentTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, fmt.Errorf("certificate did not chain to a trusted root: %v", err)
+	}
+	return certs[0], nil
+}
+
+// verifySignature verifies the ECDSA P-384 signature of the MEASUREMENTS response
+// over the SHA-384 digest of the request and the response.
+func verifySignature(leaf *x509.Certificate, report *spdmReport) error {
+	pub, ok := leaf.PublicKey.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P384() {
+		return fmt.Errorf("attestation certificate key is not an ECDSA P-384 key")
+	}
+	digest := sha512.Sum384(report.signedData)
+	r := new(big.Int).SetBytes(report.signature[:SignatureSize/2])
+	s := new(big.Int).SetBytes(report.signature[SignatureSize/2:])
+	if !ecdsa.Verify(pub, digest[:], r, s) {
+		return errors.New("failed to verify attestation report signature")
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package gpu
+
+import (
+	"bytes"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/gpu/gputest"
+	"github.com/google/go-cmp/cmp"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+)
+
+var testNonce = bytes.Repeat([]byte{0x42}, NonceSize)
+
+func newTestDevice(t *testing.T, uuid string) *gputest.Device {
+	t.Helper()
+	device, err := gputest.NewDevice(uuid, attestpb.GpuArchitectureType_GPU_ARCHITECTURE_TYPE_HOPPER)
+	if err != nil {
+		t.Fatalf("gputest.NewDevice() failed: %v", err)
+	}
+	return device
+}
+
+func newGpuInfo(t *testing.T, device *gputest.Device, nonce []byte) *attestpb.GpuInfo {
+	t.Helper()
+	info, err := device.GpuInfo(nonce)
+	if err != nil {
+		t.Fatalf("GpuInfo() failed: %v", err)
+	}
+	return info
+}
+
+func TestVerifyReportSPT(t *testing.T) {
+	device := newTestDevice(t, "GPU-0")
+	report := &attestpb.NvidiaAttestationReport{
+		CcFeature: &attestpb.NvidiaAttestationReport_Spt{
+			Spt: &attestpb.NvidiaAttestationReport_SinglePassthroughAttestation{GpuQuote: newGpuInfo(t, device, testNonce)},
+		},
+		Nonce: testNonce,
+	}
+
+	result, err := VerifyReport(report, Options{Roots: device.Roots()})
+	if err != nil {
+		t.Fatalf("VerifyReport() failed: %v", err)
+	}
+	if !result.Verified {
+		t.Errorf("VerifyReport() verdict is negative, want verified")
+	}
+	got := result.VerifiedGPUs()
+	want := []*VerifiedGPU{{
+		UUID:          "GPU-0",
+		DeviceID:      deviceID(device.Leaf),
+		Architecture:  attestpb.GpuArchitectureType_GPU_ARCHITECTURE_TYPE_HOPPER,
+		DriverVersion: "550.90.07",
+		VbiosVersion:  "96.00.9F.00.01",
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("VerifyReport() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestVerifyReportMPT(t *testing.T) {
+	device0 := newTestDevice(t, "GPU-0")
+	device1 := newTestDevice(t, "GPU-1")
+	roots := device0.Roots()
+	roots.AddCert(device1.Root)
+	report := &attestpb.NvidiaAttestationReport{
+		CcFeature: &attestpb.NvidiaAttestationReport_Mpt{
+			Mpt: &attestpb.NvidiaAttestationReport_MultiGpuSecurePassthroughAttestation{
+				GpuQuotes: []*attestpb.GpuInfo{newGpuInfo(t, device0, testNonce), newGpuInfo(t, device1, testNonce)},
+			},
+		},
+		Nonce: testNonce,
+	}
+
+	result, err := VerifyReport(report, Options{Roots: roots})
+	if err != nil {
+		t.Fatalf("VerifyReport() failed: %v", err)
+	}
+	got := result.VerifiedGPUs()
+	if !result.Verified || len(result.GPUs) != 2 || len(got) != 2 || got[0].UUID != "GPU-0" || got[1].UUID != "GPU-1" {
+		t.Errorf("VerifyReport() = %+v, want GPU-0 and GPU-1", got)
+	}
+}
+
+func TestVerifyReportErrors(t *testing.T) {
+	device := newTestDevice(t, "GPU-0")
+	otherDevice := newTestDevice(t, "GPU-1")
+
+	testCases := []struct {
+		name    string
+		report  *attestpb.NvidiaAttestationReport
+		opts    Options
+		wantErr string
+	}{
+		{
+			name:    "nil report",
+			opts:    Options{Roots: device.Roots()},
+			wantErr: "nil",
+		},
+		{
+			name:    "negative minimum",
+			report:  sptReport(newGpuInfo(t, device, testNonce), testNonce),
+			opts:    Options{Roots: device.Roots(), MinVerifiedGPUs: -1},
+			wantErr: "minimum",
+		},
+		{
+			name:    "no CC feature",
+			report:  &attestpb.NvidiaAttestationReport{Nonce: testNonce},
+			opts:    Options{Roots: device.Roots()},
+			wantErr: "no SPT or MPT",
+		},
+		{
+			name: "empty MPT",
+			report: &attestpb.NvidiaAttestationReport{
+				CcFeature: &attestpb.NvidiaAttestationReport_Mpt{Mpt: &attestpb.NvidiaAttestationReport_MultiGpuSecurePassthroughAttestation{}},
+				Nonce:     testNonce,
+			},
+			opts:    Options{Roots: device.Roots()},
+			wantErr: "no GPU quotes",
+		},
+		{
+			name:    "nil roots",
+			report:  sptReport(newGpuInfo(t, device, testNonce), testNonce),
+			wantErr: "no NVIDIA roots",
+		},
+		{
+			name:    "untrusted root",
+			report:  sptReport(newGpuInfo(t, device, testNonce), testNonce),
+			opts:    Options{Roots: otherDevice.Roots()},
+			wantErr: "certificate chain",
+		},
+		{
+			name:    "expired chain",
+			report:  sptReport(newGpuInfo(t, device, testNonce), testNonce),
+			opts:    Options{Roots: device.Roots(), CurrentTime: time.Now().Add(48 * time.Hour)},
+			wantErr: "certificate chain",
+		},
+		{
+			name:    "nonce mismatch",
+			report:  sptReport(newGpuInfo(t, device, testNonce), bytes.Repeat([]byte{0x43}, NonceSize)),
+			opts:    Options{Roots: device.Roots()},
+			wantErr: "nonce",
+		},
+		{
+			name: "tampered report",
+			report: func() *attestpb.NvidiaAttestationReport {
+				info := newGpuInfo(t, device, testNonce)
+				info.AttestationReport[RequestSize+responseHeaderSize] ^= 0xff
+				return sptReport(info, testNonce)
+			}(),
+			opts:    Options{Roots: device.Roots()},
+			wantErr: "signature",
+		},
+		{
+			name: "report signed by another device",
+			report: func() *attestpb.NvidiaAttestationReport {
+				info := newGpuInfo(t, device, testNonce)
+				info.AttestationReport = newGpuInfo(t, otherDevice, testNonce).GetAttestationReport()
+				return sptReport(info, testNonce)
+			}(),
+			opts:    Options{Roots: device.Roots()},
+			wantErr: "signature",
+		},
+		{
+			name: "driver version mismatch",
+			report: func() *attestpb.NvidiaAttestationReport {
+				info := newGpuInfo(t, device, testNonce)
+				info.DriverVersion = "535.00.00"
+				return sptReport(info, testNonce)
+			}(),
+			opts:    Options{Roots: device.Roots()},
+			wantErr: "driver version",
+		},
+		{
+			name: "VBIOS version mismatch",
+			report: func() *attestpb.NvidiaAttestationReport {
+				info := newGpuInfo(t, device, testNonce)
+				info.VbiosVersion = "96.00.00.00.01"
+				return sptReport(info, testNonce)
+			}(),
+			opts:    Options{Roots: device.Roots()},
+			wantErr: "VBIOS version",
+		},
+		{
+			name: "no certificates",
+			report: func() *attestpb.NvidiaAttestationReport {
+				info := newGpuInfo(t, device, testNonce)
+				info.AttestationCertificateChain = nil
+				return sptReport(info, testNonce)
+			}(),
+			opts:    Options{Roots: device.Roots()},
+			wantErr: "no PEM certificates",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := VerifyReport(tc.report, tc.opts)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("VerifyReport() = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func sptReport(info *attestpb.GpuInfo, nonce []byte) *attestpb.NvidiaAttestationReport {
+	return &attestpb.NvidiaAttestationReport{
+		CcFeature: &attestpb.NvidiaAttestationReport_Spt{
+			Spt: &attestpb.NvidiaAttestationReport_SinglePassthroughAttestation{GpuQuote: info},
+		},
+		Nonce: nonce,
+	}
+}
+
+func mptReport(nonce []byte, infos ...*attestpb.GpuInfo) *attestpb.NvidiaAttestationReport {
+	return &attestpb.NvidiaAttestationReport{
+		CcFeature: &attestpb.NvidiaAttestationReport_Mpt{
+			Mpt: &attestpb.NvidiaAttestationReport_MultiGpuSecurePassthroughAttestation{GpuQuotes: infos},
+		},
+		Nonce: nonce,
+	}
+}
+
+func TestVerifyReportArchitectureRoots(t *testing.T) {
+	hopper := newTestDevice(t, "GPU-HOPPER")
+	blackwell, err := gputest.NewDevice("GPU-BLACKWELL", attestpb.GpuArchitectureType_GPU_ARCHITECTURE_TYPE_BLACKWELL)
+	if err != nil {
+		t.Fatalf("gputest.NewDevice() failed: %v", err)
+	}
+	report := mptReport(testNonce, newGpuInfo(t, hopper, testNonce), newGpuInfo(t, blackwell, testNonce))
+
+	archRoots := map[attestpb.GpuArchitectureType]*x509.CertPool{
+		attestpb.GpuArchitectureType_GPU_ARCHITECTURE_TYPE_HOPPER:    hopper.Roots(),
+		attestpb.GpuArchitectureType_GPU_ARCHITECTURE_TYPE_BLACKWELL: blackwell.Roots(),
+	}
+	if _, err := VerifyReport(report, Options{ArchitectureRoots: archRoots}); err != nil {
+		t.Errorf("VerifyReport() with per-architecture roots failed: %v", err)
+	}
+
+	// A Blackwell GPU must not verify against the Hopper root.
+	swapped := map[attestpb.GpuArchitectureType]*x509.CertPool{
+		attestpb.GpuArchitectureType_GPU_ARCHITECTURE_TYPE_HOPPER:    hopper.Roots(),
+		attestpb.GpuArchitectureType_GPU_ARCHITECTURE_TYPE_BLACKWELL: hopper.Roots(),
+	}
+	result, err := VerifyReport(report, Options{ArchitectureRoots: swapped})
+	if err == nil {
+		t.Fatalf("VerifyReport() with the wrong Blackwell root succeeded, want error")
+	}
+	if result == nil || result.Verified || result.GPUs[0].GPU == nil || result.GPUs[1].Err == nil {
+		t.Errorf("VerifyReport() result = %+v, want the Hopper GPU verified and the Blackwell GPU failed", result)
+	}
+
+	// Without Blackwell roots, the Blackwell GPU falls back to Roots.
+	hopperOnly := map[attestpb.GpuArchitectureType]*x509.CertPool{
+		attestpb.GpuArchitectureType_GPU_ARCHITECTURE_TYPE_HOPPER: hopper.Roots(),
+	}
+	if _, err := VerifyReport(report, Options{Roots: blackwell.Roots(), ArchitectureRoots: hopperOnly}); err != nil {
+		t.Errorf("VerifyReport() with fallback roots failed: %v", err)
+	}
+	if _, err := VerifyReport(report, Options{ArchitectureRoots: hopperOnly}); err == nil {
+		t.Errorf("VerifyReport() without Blackwell roots succeeded, want error")
+	}
+}
+
+func TestVerifyReportDuplicateUUIDs(t *testing.T) {
+	device := newTestDevice(t, "GPU-0")
+	info := newGpuInfo(t, device, testNonce)
+	report := mptReport(testNonce, info, info)
+
+	result, err := VerifyReport(report, Options{Roots: device.Roots(), MinVerifiedGPUs: 1})
+	if err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Fatalf("VerifyReport() = %v, want duplicate UUID error", err)
+	}
+	if result.Verified || result.GPUs[1].GPU != nil || result.GPUs[1].Err == nil {
+		t.Errorf("VerifyReport() result = %+v, want the duplicate GPU rejected", result)
+	}
+}
+
+func TestVerifyReportClonedGPU(t *testing.T) {
+	device := newTestDevice(t, "GPU-0")
+	var infos []*attestpb.GpuInfo
+	for _, uuid := range []string{"GPU-0", "GPU-1", "GPU-2", "GPU-3"} {
+		// The UUID is not signed, so the host can relabel a copy of the quote.
+		info := newGpuInfo(t, device, testNonce)
+		info.Uuid = uuid
+		infos = append(infos, info)
+	}
+	report := mptReport(testNonce, infos...)
+
+	result, err := VerifyReport(report, Options{Roots: device.Roots(), MinVerifiedGPUs: 4})
+	if err == nil || !strings.Contains(err.Error(), "duplicate GPU device") {
+		t.Fatalf("VerifyReport() = %v, want duplicate GPU device error", err)
+	}
+	if result.Verified {
+		t.Errorf("VerifyReport() verdict is positive, want negative")
+	}
+	if got := len(result.VerifiedGPUs()); got != 1 {
+		t.Errorf("VerifyReport() verified %d GPUs, want 1", got)
+	}
+	if _, err := VerifyReport(report, Options{Roots: device.Roots(), MinVerifiedGPUs: 1}); err == nil {
+		t.Errorf("VerifyReport() with cloned GPUs and MinVerifiedGPUs 1 succeeded, want error")
+	}
+}
+
+func TestDeviceID(t *testing.T) {
+	device := newTestDevice(t, "GPU-0")
+	got, err := DeviceID(newGpuInfo(t, device, testNonce))
+	if err != nil {
+		t.Fatalf("DeviceID() failed: %v", err)
+	}
+	if want := deviceID(device.Leaf); got != want {
+		t.Errorf("DeviceID() = %s, want %s", got, want)
+	}
+	if _, err := DeviceID(&attestpb.GpuInfo{}); err == nil {
+		t.Errorf("DeviceID() without a certificate chain succeeded, want error")
+	}
+}
+
+func TestVerifyReportMinVerifiedGPUs(t *testing.T) {
+	devices := []*gputest.Device{newTestDevice(t, "GPU-0"), newTestDevice(t, "GPU-1"), newTestDevice(t, "GPU-2")}
+	roots := x509.NewCertPool()
+	var infos []*attestpb.GpuInfo
+	for _, device := range devices {
+		roots.AddCert(device.Root)
+		infos = append(infos, newGpuInfo(t, device, testNonce))
+	}
+	// GPU-2 reports a stale nonce.
+	infos[2] = newGpuInfo(t, devices[2], bytes.Repeat([]byte{0x43}, NonceSize))
+	report := mptReport(testNonce, infos...)
+
+	testCases := []struct {
+		name         string
+		minVerified  int
+		wantVerified bool
+	}{
+		{"all GPUs by default", 0, false},
+		{"two GPUs", 2, true},
+		{"three GPUs", 3, false},
+		{"more GPUs than attached", 4, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := VerifyReport(report, Options{Roots: roots, MinVerifiedGPUs: tc.minVerified})
+			if (err == nil) != tc.wantVerified {
+				t.Fatalf("VerifyReport() = %v, want verified %v", err, tc.wantVerified)
+			}
+			if result.Verified != tc.wantVerified {
+				t.Errorf("VerifyReport() verdict = %v, want %v", result.Verified, tc.wantVerified)
+			}
+			if got := len(result.VerifiedGPUs()); got != 2 {
+				t.Errorf("VerifyReport() verified %d GPUs, want 2", got)
+			}
+			if result.GPUs[2].Err == nil || !strings.Contains(result.GPUs[2].Err.Error(), "nonce") {
+				t.Errorf("GPU 2 error = %v, want nonce mismatch", result.GPUs[2].Err)
+			}
+		})
+	}
+}
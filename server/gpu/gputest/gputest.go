@@ -0,0 +1,187 @@
+// Package gputest creates fake NVIDIA GPU devices that produce signed attestation
+// reports, for testing GPU attestation verification.
+package gputest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/internal/certtest"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+)
+
+const (
+	nonceSize     = 32
+	signatureSize = 96
+)
+
+// Device is a fake GPU with its own device identity root, an intermediate and
+// a P-384 attestation key.
+type Device struct {
+	UUID          string
+	Architecture  attestpb.GpuArchitectureType
+	DriverVersion string
+	// VbiosVersion is formatted like nvidia-smi, e.g. 96.00.9F.00.01.
+	VbiosVersion string
+
+	Root *x509.Certificate
+	// Leaf is the attestation certificate, whose key signs the attestation
+	// reports.
+	Leaf  *x509.Certificate
+	chain []byte
+	key   *ecdsa.PrivateKey
+}
+
+// NewDevice returns a Device with a freshly generated certificate chain.
+func NewDevice(uuid string, arch attestpb.GpuArchitectureType) (*Device, error) {
+	root, err := certtest.NewCA(&x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Fake NVIDIA Device Identity CA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}, elliptic.P384(), nil)
+	if err != nil {
+		return nil, err
+	}
+	intermediate, err := certtest.NewCA(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Fake NVIDIA GPU Intermediate"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}, elliptic.P384(), root)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := intermediate.Issue(&x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "Fake NVIDIA GPU " + uuid},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, &key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []byte
+	for _, cert := range []*x509.Certificate{leaf, intermediate.Cert} {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+
+	return &Device{
+		UUID:          uuid,
+		Architecture:  arch,
+		DriverVersion: "550.90.07",
+		VbiosVersion:  "96.00.9F.00.01",
+		Root:          root.Cert,
+		Leaf:          leaf,
+		chain:         chain,
+		key:           key,
+	}, nil
+}
+
+// Roots returns a pool holding the device's root.
+func (d *Device) Roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(d.Root)
+	return pool
+}
+
+// GpuInfo returns the device's GPU quote with an attestation report for the nonce.
+func (d *Device) GpuInfo(nonce []byte) (*attestpb.GpuInfo, error) {
+	report, err := d.AttestationReport(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &attestpb.GpuInfo{
+		Uuid:                        d.UUID,
+		DriverVersion:               d.DriverVersion,
+		VbiosVersion:                d.VbiosVersion,
+		GpuArchitectureType:         d.Architecture,
+		AttestationCertificateChain: d.chain,
+		AttestationReport:           report,
+	}, nil
+}
+
+// AttestationReport returns a signed SPDM GET_MEASUREMENTS request and
+// MEASUREMENTS response for the nonce.
+func (d *Device) AttestationReport(nonce []byte) ([]byte, error) {
+	if len(nonce) != nonceSize {
+		return nil, fmt.Errorf("nonce has %d bytes, want %d", len(nonce), nonceSize)
+	}
+	vbios, err := encodeVbiosVersion(d.VbiosVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	report := []byte{0x11, 0xE0, 0x01, 0xFF}
+	report = append(report, nonce...)
+	report = append(report, 0x00)
+
+	// A single fake measurement block.
+	record := []byte{0x01, 0x01, 0x04, 0x00, 0xDE, 0xAD, 0xBE, 0xEF}
+	responseNonce := make([]byte, nonceSize)
+	if _, err := rand.Read(responseNonce); err != nil {
+		return nil, err
+	}
+	opaque := opaqueField(nil, 3, append([]byte(d.DriverVersion), 0))
+	opaque = opaqueField(opaque, 6, vbios)
+
+	report = append(report, 0x11, 0x60, 0x00, 0x00, 0x01,
+		byte(len(record)), byte(len(record)>>8), byte(len(record)>>16))
+	report = append(report, record...)
+	report = append(report, responseNonce...)
+	report = binary.LittleEndian.AppendUint16(report, uint16(len(opaque)))
+	report = append(report, opaque...)
+
+	digest := sha512.Sum384(report)
+	r, s, err := ecdsa.Sign(rand.Reader, d.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	signature := make([]byte, signatureSize)
+	r.FillBytes(signature[:signatureSize/2])
+	s.FillBytes(signature[signatureSize/2:])
+	return append(report, signature...), nil
+}
+
+func opaqueField(opaque []byte, fieldType uint16, value []byte) []byte {
+	opaque = binary.LittleEndian.AppendUint16(opaque, fieldType)
+	opaque = binary.LittleEndian.AppendUint16(opaque, uint16(len(value)))
+	return append(opaque, value...)
+}
+
+// encodeVbiosVersion encodes a VBIOS version formatted like 96.00.9F.00.01 into
+// its 8-byte opaque data field.
+func encodeVbiosVersion(version string) ([]byte, error) {
+	parts := strings.Split(version, ".")
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("VBIOS version %q does not have 5 parts", version)
+	}
+	var b [5]byte
+	for i, part := range parts {
+		decoded, err := hex.DecodeString(part)
+		if err != nil || len(decoded) != 1 {
+			return nil, fmt.Errorf("invalid VBIOS version %q", version)
+		}
+		b[i] = decoded[0]
+	}
+	return []byte{b[3], b[2], b[1], b[0], b[4], 0, 0, 0}, nil
+}
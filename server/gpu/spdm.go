@@ -0,0 +1,129 @@
+package gpu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// SPDM message layout of an NVIDIA GPU attestation report: a GET_MEASUREMENTS
+// request followed by its signed MEASUREMENTS response, as defined in
+// https://www.dmtf.org/sites/default/files/standards/documents/DSP0274_1.1.0.pdf.
+const (
+	spdmGetMeasurementsCode = 0xE0
+	spdmMeasurementsCode    = 0x60
+
+	// NonceSize is the size of the SPDM request and response nonces.
+	NonceSize = 32
+
+	// RequestSize is the size of the GET_MEASUREMENTS request: version, code,
+	// param1, param2, nonce and slot ID.
+	RequestSize = 4 + NonceSize + 1
+
+	// SignatureSize is the size of the ECDSA P-384 response signature, encoded
+	// as r || s.
+	SignatureSize = 96
+
+	// responseHeaderSize is the size of the response version, code, param1,
+	// param2, number of blocks and 3-byte measurement record length.
+	responseHeaderSize = 8
+
+	// Opaque data field IDs of the NVIDIA MEASUREMENTS response.
+	opaqueFieldDriverVersion = 3
+	opaqueFieldVbiosVersion  = 6
+)
+
+// spdmReport is a parsed SPDM GET_MEASUREMENTS request and MEASUREMENTS response.
+type spdmReport struct {
+	requestNonce      []byte
+	measurementRecord []byte
+	responseNonce     []byte
+	opaqueData        map[uint16][]byte
+	// signedData is the request and the response up to the signature.
+	signedData []byte
+	signature  []byte
+}
+
+// parseSPDMReport parses an attestation_report of a GpuInfo.
+func parseSPDMReport(raw []byte) (*spdmReport, error) {
+	if len(raw) < RequestSize+responseHeaderSize {
+		return nil, fmt.Errorf("SPDM report is too short: %d bytes", len(raw))
+	}
+	request, response := raw[:RequestSize], raw[RequestSize:]
+	if request[1] != spdmGetMeasurementsCode {
+		return nil, fmt.Errorf("unexpected SPDM request code 0x%x, want GET_MEASUREMENTS 0x%x", request[1], spdmGetMeasurementsCode)
+	}
+	if response[1] != spdmMeasurementsCode {
+		return nil, fmt.Errorf("unexpected SPDM response code 0x%x, want MEASUREMENTS 0x%x", response[1], spdmMeasurementsCode)
+	}
+
+	report := &spdmReport{requestNonce: request[4 : 4+NonceSize]}
+
+	recordLength := int(response[5]) | int(response[6])<<8 | int(response[7])<<16
+	offset := responseHeaderSize
+	if len(response) < offset+recordLength+NonceSize+2 {
+		return nil, fmt.Errorf("SPDM response is too short for a %d byte measurement record", recordLength)
+	}
+	report.measurementRecord = response[offset : offset+recordLength]
+	offset += recordLength
+	report.responseNonce = response[offset : offset+NonceSize]
+	offset += NonceSize
+
+	opaqueLength := int(binary.LittleEndian.Uint16(response[offset:]))
+	offset += 2
+	if len(response) != offset+opaqueLength+SignatureSize {
+		return nil, fmt.Errorf("SPDM response has %d bytes, want %d for %d bytes of opaque data and a %d byte signature",
+			len(response), offset+opaqueLength+SignatureSize, opaqueLength, SignatureSize)
+	}
+	opaqueData, err := parseOpaqueData(response[offset : offset+opaqueLength])
+	if err != nil {
+		return nil, err
+	}
+	report.opaqueData = opaqueData
+	offset += opaqueLength
+
+	report.signedData = raw[:RequestSize+offset]
+	report.signature = response[offset:]
+	return report, nil
+}
+
+// parseOpaqueData parses the NVIDIA opaque data of a MEASUREMENTS response: a
+// list of 2-byte type, 2-byte length and value fields.
+func parseOpaqueData(raw []byte) (map[uint16][]byte, error) {
+	fields := make(map[uint16][]byte)
+	for len(raw) > 0 {
+		if len(raw) < 4 {
+			return nil, fmt.Errorf("truncated SPDM opaque data field header")
+		}
+		fieldType := binary.LittleEndian.Uint16(raw)
+		fieldLength := int(binary.LittleEndian.Uint16(raw[2:]))
+		if len(raw) < 4+fieldLength {
+			return nil, fmt.Errorf("truncated SPDM opaque data field %d", fieldType)
+		}
+		fields[fieldType] = raw[4 : 4+fieldLength]
+		raw = raw[4+fieldLength:]
+	}
+	return fields, nil
+}
+
+// driverVersion returns the NUL-terminated driver version of the opaque data.
+func (r *spdmReport) driverVersion() (string, error) {
+	field, ok := r.opaqueData[opaqueFieldDriverVersion]
+	if !ok {
+		return "", fmt.Errorf("SPDM opaque data has no driver version")
+	}
+	return string(bytes.TrimRight(field, "\x00")), nil
+}
+
+// vbiosVersion returns the VBIOS version of the opaque data, formatted the way
+// nvidia-smi does, e.g. 96.00.9F.00.01.
+func (r *spdmReport) vbiosVersion() (string, error) {
+	field, ok := r.opaqueData[opaqueFieldVbiosVersion]
+	if !ok {
+		return "", fmt.Errorf("SPDM opaque data has no VBIOS version")
+	}
+	if len(field) != 8 {
+		return "", fmt.Errorf("SPDM VBIOS version has %d bytes, want 8", len(field))
+	}
+	return fmt.Sprintf("%02X.%02X.%02X.%02X.%02X", field[3], field[2], field[1], field[0], field[4]), nil
+}
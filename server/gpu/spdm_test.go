@@ -0,0 +1,91 @@
+package gpu
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSPDMReport(t *testing.T) {
+	device := newTestDevice(t, "GPU-0")
+	raw, err := device.AttestationReport(testNonce)
+	if err != nil {
+		t.Fatalf("AttestationReport() failed: %v", err)
+	}
+
+	report, err := parseSPDMReport(raw)
+	if err != nil {
+		t.Fatalf("parseSPDMReport() failed: %v", err)
+	}
+	if string(report.requestNonce) != string(testNonce) {
+		t.Errorf("parseSPDMReport() request nonce = %x, want %x", report.requestNonce, testNonce)
+	}
+	if len(report.signature) != SignatureSize {
+		t.Errorf("parseSPDMReport() signature has %d bytes, want %d", len(report.signature), SignatureSize)
+	}
+	if len(report.signedData)+SignatureSize != len(raw) {
+		t.Errorf("parseSPDMReport() signed data has %d bytes, want %d", len(report.signedData), len(raw)-SignatureSize)
+	}
+	driverVersion, err := report.driverVersion()
+	if err != nil || driverVersion != "550.90.07" {
+		t.Errorf("driverVersion() = %q, %v, want 550.90.07", driverVersion, err)
+	}
+	vbiosVersion, err := report.vbiosVersion()
+	if err != nil || vbiosVersion != "96.00.9F.00.01" {
+		t.Errorf("vbiosVersion() = %q, %v, want 96.00.9F.00.01", vbiosVersion, err)
+	}
+}
+
+func TestParseSPDMReportErrors(t *testing.T) {
+	device := newTestDevice(t, "GPU-0")
+	raw, err := device.AttestationReport(testNonce)
+	if err != nil {
+		t.Fatalf("AttestationReport() failed: %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		modify  func([]byte) []byte
+		wantErr string
+	}{
+		{"too short", func(b []byte) []byte { return b[:RequestSize] }, "too short"},
+		{"bad request code", func(b []byte) []byte { b[1] = 0x00; return b }, "request code"},
+		{"bad response code", func(b []byte) []byte { b[RequestSize+1] = 0x00; return b }, "response code"},
+		{"huge measurement record", func(b []byte) []byte { b[RequestSize+7] = 0xff; return b }, "measurement record"},
+		{"truncated signature", func(b []byte) []byte { return b[:len(b)-1] }, "signature"},
+		{"trailing data", func(b []byte) []byte { return append(b, 0x00) }, "signature"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			modified := tc.modify(append([]byte{}, raw...))
+			_, err := parseSPDMReport(modified)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("parseSPDMReport() = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseOpaqueData(t *testing.T) {
+	fields, err := parseOpaqueData([]byte{0x03, 0x00, 0x02, 0x00, 'a', 0x00, 0x06, 0x00, 0x00, 0x00})
+	if err != nil {
+		t.Fatalf("parseOpaqueData() failed: %v", err)
+	}
+	if len(fields) != 2 || string(fields[3]) != "a\x00" || len(fields[6]) != 0 {
+		t.Errorf("parseOpaqueData() = %v, want driver and empty VBIOS fields", fields)
+	}
+
+	for _, raw := range [][]byte{{0x03, 0x00, 0x02}, {0x03, 0x00, 0x02, 0x00, 'a'}} {
+		if _, err := parseOpaqueData(raw); err == nil {
+			t.Errorf("parseOpaqueData(%x) succeeded, want error", raw)
+		}
+	}
+
+	report := &spdmReport{opaqueData: map[uint16][]byte{}}
+	if _, err := report.driverVersion(); err == nil {
+		t.Errorf("driverVersion() succeeded without a driver version field, want error")
+	}
+	report.opaqueData[opaqueFieldVbiosVersion] = []byte{0x01}
+	if _, err := report.vbiosVersion(); err == nil {
+		t.Errorf("vbiosVersion() succeeded with a short VBIOS version field, want error")
+	}
+}
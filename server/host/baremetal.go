@@ -9,16 +9,16 @@ import (
 
 	"github.com/google/go-eventlog/cel"
 	"github.com/google/go-eventlog/extract"
-	"github.com/google/go-eventlog/proto/state"
 	"github.com/google/go-eventlog/register"
 	"github.com/google/go-eventlog/tcg"
 	"github.com/google/go-tpm/tpm2"
 	"github.com/google/platform-attestation/titan/dice/titandice"
 	"github.com/google/platform-attestation/titan/measurements"
 
+	cosextract "github.com/GoogleCloudPlatform/confidential-space/server/extract"
 	hostcel "github.com/GoogleCloudPlatform/confidential-space/server/host/coscel"
+	"github.com/GoogleCloudPlatform/confidential-space/server/internal/signedquote"
 	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
-	tpmpb "github.com/google/go-tpm-tools/proto/tpm"
 	tpmquote "github.com/google/go-tpm-tools/quote"
 )
 
@@ -35,6 +35,10 @@ type VerifyOpts struct {
 	TitanValidationOpts *titandice.ValidateScribeCertificateChainOptions
 
 	Nonce []byte
+
+	// Whether to return a *extract.ReplayError with a report of each MR when the
+	// launch event log fails to replay.
+	DiagnoseReplayFailure bool
 }
 
 // VerifyAttestation verifies the attestation and returns the Google Bare Metal state.
@@ -61,18 +65,18 @@ func VerifyAttestation(attestation *attestpb.HostAttestation, opts *VerifyOpts)
 		return nil, fmt.Errorf("no quote found with matching hash algorithm: %v", opts.HashAlgo)
 	}
 
-	if err := tpmquote.Verify(toProtoQuote(quote), titanPubKey, opts.Nonce); err != nil {
+	if err := tpmquote.Verify(signedquote.ToProto(quote), titanPubKey, opts.Nonce); err != nil {
 		return nil, fmt.Errorf("failed to verify quote: %v", err)
 	}
 
-	pcrBank, err := createPCRBank(quote)
+	pcrBank, err := signedquote.PCRBank(quote)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create PCR bank: %v", err)
 	}
 
-	gmesState, err := verifyEventLogs(attestation.GetTpmQuote(), pcrBank)
+	gmesState, err := verifyEventLogs(attestation.GetTpmQuote(), pcrBank, opts.DiagnoseReplayFailure)
 	if err != nil {
-		return nil, fmt.Errorf("failed to verify and extract state: %v", err)
+		return nil, fmt.Errorf("failed to verify and extract state: %w", err)
 	}
 
 	// Verify warm reset NV certification.
@@ -92,26 +96,7 @@ func VerifyAttestation(attestation *attestpb.HostAttestation, opts *VerifyOpts)
 	return gmesState, nil
 }
 
-func createPCRBank(pcrs *attestpb.TpmQuote_SignedQuote) (register.PCRBank, error) {
-	tcgHash := state.HashAlgo(pcrs.GetHashAlgorithm())
-	cryptoHashAlg, err := tcgHash.CryptoHash()
-	if err != nil {
-		return register.PCRBank{}, err
-	}
-
-	pcrRegs := make([]register.PCR, 0)
-	for pcrIndex, digest := range pcrs.GetPcrValues() {
-		pcrRegs = append(pcrRegs, register.PCR{
-			Index:     int(pcrIndex),
-			Digest:    digest,
-			DigestAlg: cryptoHashAlg,
-		})
-	}
-
-	return register.PCRBank{TCGHashAlgo: tcgHash, PCRs: pcrRegs}, nil
-}
-
-func parseCPUPIID(rawEventLog []byte, register register.PCRBank) ([]byte, error) {
+func parseCPUPIID(rawEventLog []byte, register register.PCRBank, diagnoseReplayFailure bool) ([]byte, error) {
 	if len(rawEventLog) == 0 {
 		return nil, nil
 	}
@@ -121,8 +106,8 @@ func parseCPUPIID(rawEventLog []byte, register register.PCRBank) ([]byte, error)
 		return nil, fmt.Errorf("failed to decode CEL: %v", err)
 	}
 
-	if err := decodedCEL.Replay(register); err != nil {
-		return nil, fmt.Errorf("failed to replay CEL: %v", err)
+	if err := cosextract.ReplayCEL(decodedCEL, register, diagnoseReplayFailure); err != nil {
+		return nil, fmt.Errorf("failed to replay CEL: %w", err)
 	}
 
 	var cpupiid []byte
@@ -219,18 +204,7 @@ func parseEKCertificate(data []byte) (*titandice.EKCertificate, error) {
 	return ekc, nil
 }
 
-func toProtoQuote(quote *attestpb.TpmQuote_SignedQuote) *tpmpb.Quote {
-	return &tpmpb.Quote{
-		Quote:  quote.GetTpmsAttest(),
-		RawSig: quote.GetTpmtSignature(),
-		Pcrs: &tpmpb.PCRs{
-			Hash: tpmpb.HashAlgo(quote.GetHashAlgorithm()),
-			Pcrs: quote.GetPcrValues(),
-		},
-	}
-}
-
-func verifyEventLogs(tpmQuote *attestpb.TpmQuote, pcrBank register.PCRBank) (*attestpb.HostACOSState, error) {
+func verifyEventLogs(tpmQuote *attestpb.TpmQuote, pcrBank register.PCRBank, diagnoseReplayFailure bool) (*attestpb.HostACOSState, error) {
 	events, err := tcg.ParseAndReplay(tpmQuote.GetPcclientBootEventLog(), pcrBank.MRs(), tcg.ParseOpts{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse and replay boot event log: %v", err)
@@ -248,9 +222,9 @@ func verifyEventLogs(tpmQuote *attestpb.TpmQuote, pcrBank register.PCRBank) (*at
 	}
 
 	// Extract CPUPIID.
-	cpupiid, err := parseCPUPIID(tpmQuote.GetCelLaunchEventLog(), pcrBank)
+	cpupiid, err := parseCPUPIID(tpmQuote.GetCelLaunchEventLog(), pcrBank, diagnoseReplayFailure)
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract CPUPIID: %v", err)
+		return nil, fmt.Errorf("failed to extract CPUPIID: %w", err)
 	}
 
 	return &attestpb.HostACOSState{
@@ -5,9 +5,11 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"strings"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/confidential-space/server/extract"
 	hostcel "github.com/GoogleCloudPlatform/confidential-space/server/host/coscel"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-eventlog/cel"
@@ -119,7 +121,7 @@ func TestVerifyEventLogs(t *testing.T) {
 		Gmes: gmesExpectedState,
 	}
 
-	state, err := verifyEventLogs(tpmQuote, convertToPCRBank(t, gmesPCRBanks[0]))
+	state, err := verifyEventLogs(tpmQuote, convertToPCRBank(t, gmesPCRBanks[0]), false)
 	if err != nil {
 		t.Fatalf("verifyEventLogs failed: %v", err)
 	}
@@ -162,7 +164,7 @@ func TestVerifyEventLogsWithCEL(t *testing.T) {
 		CpuPiid: celExpectedPIID,
 	}
 
-	state, err := verifyEventLogs(tpmQuote, convertToPCRBank(t, pcrs))
+	state, err := verifyEventLogs(tpmQuote, convertToPCRBank(t, pcrs), false)
 	if err != nil {
 		t.Fatalf("verifyEventLogs failed: %v", err)
 	}
@@ -192,7 +194,7 @@ func testTPMQuote(tpmEventLog []byte, launcherEventLog []byte, pcrBanks []*tpmpb
 
 func TestParseCPUPIID(t *testing.T) {
 	pcrBank := convertToPCRBank(t, celLaunchPCRBanks[0])
-	piid, err := parseCPUPIID(celLaunchEventLogData, pcrBank)
+	piid, err := parseCPUPIID(celLaunchEventLogData, pcrBank, false)
 	if err != nil {
 		t.Fatalf("Failed to parse PIID event: %v", err)
 	}
@@ -269,7 +271,7 @@ func TestParseCPUPIIDErrors(t *testing.T) {
 				},
 			})
 
-			_, err := parseCPUPIID(testCEL, pcrBank)
+			_, err := parseCPUPIID(testCEL, pcrBank, false)
 			if err == nil {
 				t.Errorf("parseCPUPIID() succeeded, want error")
 			} else if !strings.Contains(err.Error(), tc.wantError) {
@@ -279,6 +281,32 @@ func TestParseCPUPIIDErrors(t *testing.T) {
 	}
 }
 
+func TestParseCPUPIIDReplayError(t *testing.T) {
+	pcrBank := convertToPCRBank(t, &tpmpb.PCRs{
+		Hash: tpmpb.HashAlgo_SHA256,
+		Pcrs: map[uint32][]byte{
+			hostcel.UserspacePCRIdx: make([]byte, 32),
+		},
+	})
+
+	_, err := parseCPUPIID(celLaunchEventLogData, pcrBank, true)
+	var replayErr *extract.ReplayError
+	if !errors.As(err, &replayErr) {
+		t.Fatalf("parseCPUPIID() got error %v, want *extract.ReplayError", err)
+	}
+	if len(replayErr.Report.MRs) != 1 || replayErr.Report.MRs[0].Index != hostcel.UserspacePCRIdx {
+		t.Fatalf("got MR reports %+v, want one for PCR %d", replayErr.Report.MRs, hostcel.UserspacePCRIdx)
+	}
+	if replayErr.Report.MRs[0].Consistent() {
+		t.Errorf("PCR %d is consistent, want inconsistent", hostcel.UserspacePCRIdx)
+	}
+
+	_, err = parseCPUPIID(celLaunchEventLogData, pcrBank, false)
+	if err == nil || errors.As(err, &replayErr) {
+		t.Errorf("parseCPUPIID() without diagnostics got error %v, want a plain replay error", err)
+	}
+}
+
 func convertToPCRBank(t *testing.T, pcrs *tpmpb.PCRs) register.PCRBank {
 	t.Helper()
 	pcrBank := register.PCRBank{TCGHashAlgo: state.HashAlgo(pcrs.Hash)}
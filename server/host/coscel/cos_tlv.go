@@ -25,6 +25,18 @@ const (
 	LaunchSeparatorType
 )
 
+// String returns the name of the content type, or its number if it is unknown.
+func (t ContentType) String() string {
+	switch t {
+	case CPUPIIDType:
+		return "CPUPIID"
+	case LaunchSeparatorType:
+		return "LaunchSeparator"
+	default:
+		return fmt.Sprintf("ContentType(%d)", uint8(t))
+	}
+}
+
 // COSTLV is a specific event type created for the Host COS,
 // used as a CEL content.
 type COSTLV struct {
@@ -0,0 +1,342 @@
+package image
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	rimpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/image_database"
+)
+
+const cosOptionPrefix = "cos."
+
+// dmVerityParams are the parameters holding device mapper tables: the legacy
+// ChromiumOS dm= format and the upstream dm-mod.create= format.
+var dmVerityParams = []string{"dm", "dm-mod.create"}
+
+// CmdLineParam is a kernel command line parameter.
+type CmdLineParam struct {
+	Key string
+	// Value is the unquoted value, empty for a parameter without one.
+	Value    string
+	HasValue bool
+}
+
+func (p CmdLineParam) String() string {
+	if !p.HasValue {
+		return p.Key
+	}
+	switch {
+	case !strings.ContainsAny(p.Value, " \t\n\v\f\r"):
+		return p.Key + "=" + p.Value
+	case !strings.Contains(p.Value, `"`):
+		return p.Key + `="` + p.Value + `"`
+	default:
+		return fmt.Sprintf("%v=%q", p.Key, p.Value)
+	}
+}
+
+// CmdLine is a parsed kernel command line.
+type CmdLine struct {
+	// Params are the kernel parameters, before the first "--", in command line
+	// order.
+	Params []CmdLineParam
+	// InitParams are the parameters after the first "--", which the kernel
+	// passes to init as arguments, in command line order.
+	InitParams []CmdLineParam
+	// VerityRootHashes are the root hashes of the dm-verity targets of the
+	// device mapper tables, in command line order.
+	VerityRootHashes []string
+	// COSOptions are the values of the cos.* parameters, keyed by the parameter
+	// name without the cos. prefix. A repeated option takes its last value.
+	COSOptions map[string]string
+}
+
+// ParseCmdLine splits a kernel command line into parameters as the kernel
+// does: parameters are separated by whitespace, double quotes group
+// whitespace into a parameter or its value, and the parameters after the first
+// "--" are init arguments.
+func ParseCmdLine(s string) (*CmdLine, error) {
+	cmdLine := &CmdLine{COSOptions: make(map[string]string)}
+	rest := NormalizeCmdLine(s)
+	inInit := false
+	for {
+		rest = strings.TrimLeft(rest, " \t\n\v\f\r")
+		if rest == "" {
+			break
+		}
+		var param CmdLineParam
+		var err error
+		param, rest, err = nextCmdLineParam(rest)
+		if err != nil {
+			return nil, err
+		}
+		if inInit {
+			cmdLine.InitParams = append(cmdLine.InitParams, param)
+			continue
+		}
+		if param.Key == "--" && !param.HasValue {
+			inInit = true
+			continue
+		}
+		cmdLine.Params = append(cmdLine.Params, param)
+
+		if strings.HasPrefix(param.Key, cosOptionPrefix) {
+			cmdLine.COSOptions[strings.TrimPrefix(param.Key, cosOptionPrefix)] = param.Value
+		}
+		for _, dmParam := range dmVerityParams {
+			if param.Key == dmParam {
+				cmdLine.VerityRootHashes = append(cmdLine.VerityRootHashes, verityRootHashes(param.Value)...)
+			}
+		}
+	}
+	return cmdLine, nil
+}
+
+// nextCmdLineParam returns the parameter at the start of s, following the
+// kernel's next_arg, and the rest of s. Like next_arg, it only strips the
+// quotes around a quoted parameter or value; quotes within are kept.
+func nextCmdLineParam(s string) (CmdLineParam, string, error) {
+	inQuote := false
+	equals := -1
+	end := len(s)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			inQuote = !inQuote
+		case c == '=' && equals < 0:
+			equals = i
+		case strings.IndexByte(" \t\n\v\f\r", c) >= 0 && !inQuote:
+			end = i
+		}
+		if end != len(s) {
+			break
+		}
+	}
+	if inQuote {
+		return CmdLineParam{}, "", fmt.Errorf("unterminated quote in kernel command line parameter %q", s)
+	}
+
+	token := s[:end]
+	quoted := strings.HasPrefix(token, `"`)
+	if quoted {
+		token = token[1:]
+		equals--
+	}
+	if equals < 0 {
+		if quoted {
+			token = strings.TrimSuffix(token, `"`)
+		}
+		return CmdLineParam{Key: token}, s[end:], nil
+	}
+	key, value := token[:equals], token[equals+1:]
+	if key == "" {
+		return CmdLineParam{}, "", fmt.Errorf("kernel command line parameter %q has no name", s[:end])
+	}
+	if strings.HasPrefix(value, `"`) {
+		value = value[1:]
+		quoted = true
+	}
+	if quoted {
+		value = strings.TrimSuffix(value, `"`)
+	}
+	return CmdLineParam{Key: key, Value: value, HasValue: true}, s[end:], nil
+}
+
+// verityRootHashes returns the root hashes of the verity targets of a device
+// mapper table. Targets are separated by commas in the ChromiumOS dm= format
+// and by semicolons between devices in dm-mod.create=. Both formats give the
+// root hash either as a root_hexdigest= argument or positionally, following
+// the hash algorithm of a "verity <version> ..." table.
+func verityRootHashes(table string) []string {
+	var hashes []string
+	for _, target := range strings.FieldsFunc(table, func(r rune) bool { return r == ',' || r == ';' }) {
+		fields := strings.Fields(target)
+		for i, field := range fields {
+			if hash, ok := strings.CutPrefix(field, "root_hexdigest="); ok {
+				hashes = append(hashes, hash)
+				break
+			}
+			// verity <version> <data_dev> <hash_dev> <data_block_size>
+			// <hash_block_size> <num_data_blocks> <hash_start_block>
+			// <algorithm> <digest> <salt>
+			if field == "verity" && i+9 < len(fields) && !strings.Contains(fields[i+1], "=") {
+				hashes = append(hashes, fields[i+9])
+				break
+			}
+		}
+	}
+	return hashes
+}
+
+// passedToInit reports whether the kernel passes a parameter before the "--"
+// to init as an argument: a parameter without a value that is not a module
+// parameter, unless the kernel itself handles it. The kernel parameters it
+// handles are not known here, so every such parameter is assumed to reach init.
+func passedToInit(param CmdLineParam) bool {
+	return !param.HasValue && !strings.Contains(param.Key, ".")
+}
+
+// paramSet returns the parameters of the command line that do not reach init,
+// grouped by key. The order of parameters with different keys does not matter
+// to the kernel, but a later value of a repeated key may override or follow an
+// earlier one, so the values of each key keep their command line order.
+func (c *CmdLine) paramSet() map[string][]string {
+	set := make(map[string][]string)
+	for _, param := range c.Params {
+		if passedToInit(param) {
+			continue
+		}
+		set[param.Key] = append(set[param.Key], param.String())
+	}
+	return set
+}
+
+// initArgs returns the parameters that may reach init as arguments, in command
+// line order: the parameters before the "--" that passedToInit reports, then a
+// "--" and the parameters after it. Unlike kernel parameters, init interprets
+// its arguments by position.
+func (c *CmdLine) initArgs() []string {
+	var args []string
+	for _, param := range c.Params {
+		if passedToInit(param) {
+			args = append(args, param.String())
+		}
+	}
+	if len(c.InitParams) > 0 {
+		args = append(args, "--")
+	}
+	for _, param := range c.InitParams {
+		args = append(args, param.String())
+	}
+	return args
+}
+
+// diffCmdLines returns the parameters of want that got is missing and the
+// parameters of got that want does not have. Kernel parameters are compared by
+// key, and the parameters that may reach init in order: if they differ, all of
+// them are reported.
+func diffCmdLines(want, got *CmdLine) (missing, unexpected []string) {
+	missing, unexpected = diffParams(want.paramSet(), got.paramSet())
+	wantArgs, gotArgs := want.initArgs(), got.initArgs()
+	if slices.Equal(wantArgs, gotArgs) {
+		return missing, unexpected
+	}
+	return append(missing, wantArgs...), append(unexpected, gotArgs...)
+}
+
+// diffParams returns the parameters of want that got is missing and the
+// parameters of got that want does not have, by key in sorted order.
+func diffParams(want, got map[string][]string) (missing, unexpected []string) {
+	keys := make(map[string]bool)
+	for key := range want {
+		keys[key] = true
+	}
+	for key := range got {
+		keys[key] = true
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	for _, key := range sortedKeys {
+		wantValues, gotValues := want[key], got[key]
+		if slices.Equal(wantValues, gotValues) {
+			continue
+		}
+		missing = append(missing, wantValues...)
+		unexpected = append(unexpected, gotValues...)
+	}
+	return missing, unexpected
+}
+
+// CmdLineMismatchError is returned when a kernel command line matches no
+// golden entry. It describes the nearest golden entry and the parameters that
+// differ from it. Use errors.As to get it.
+type CmdLineMismatchError struct {
+	CmdLine string
+	// NearestCmdLine is the golden command line with the fewest differing
+	// parameters, empty if there are no golden entries.
+	NearestCmdLine string
+	Nearest        *rimpb.ImageDatabase_ImageGoldenEntry
+	// Missing are the parameters of the nearest golden command line that the
+	// command line does not have.
+	Missing []string
+	// Unexpected are the parameters of the command line that the nearest golden
+	// command line does not have.
+	Unexpected []string
+	// VerityRootHashes and NearestVerityRootHashes are the dm-verity root hashes
+	// of the command line and the nearest golden command line.
+	VerityRootHashes        []string
+	NearestVerityRootHashes []string
+}
+
+func (e *CmdLineMismatchError) Error() string {
+	msg := fmt.Sprintf("kernel command line %q is not in the golden values", e.CmdLine)
+	if e.Nearest == nil {
+		return msg
+	}
+	msg += fmt.Sprintf("; nearest golden entry is image %q, missing parameters %q, unexpected parameters %q",
+		e.Nearest.GetImageReleaseName(), e.Missing, e.Unexpected)
+	if !slices.Equal(e.VerityRootHashes, e.NearestVerityRootHashes) {
+		msg += fmt.Sprintf("; dm-verity root hashes %q, want %q", e.VerityRootHashes, e.NearestVerityRootHashes)
+	}
+	return msg
+}
+
+// matchCmdLine finds the golden entry whose command line has the same kernel
+// parameters as cmdLine, in any order, and the same parameters that may reach
+// init, in order. Otherwise, it returns a *CmdLineMismatchError describing the
+// nearest golden entry.
+func matchCmdLine(cmdLine string, goldenValues map[string]*rimpb.ImageDatabase_ImageGoldenEntry) (*rimpb.ImageDatabase_ImageGoldenEntry, error) {
+	if goldens, ok := goldenValues[cmdLine]; ok {
+		return goldens, nil
+	}
+	parsed, err := ParseCmdLine(cmdLine)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kernel command line %q: %v", cmdLine, err)
+	}
+	goldenCmdLines := make([]string, 0, len(goldenValues))
+	for goldenCmdLine := range goldenValues {
+		goldenCmdLines = append(goldenCmdLines, goldenCmdLine)
+	}
+	sort.Strings(goldenCmdLines)
+
+	mismatch := &CmdLineMismatchError{CmdLine: cmdLine, VerityRootHashes: parsed.VerityRootHashes}
+	var matches []string
+	for _, goldenCmdLine := range goldenCmdLines {
+		golden, err := ParseCmdLine(goldenCmdLine)
+		if err != nil {
+			// A malformed golden command line can only match exactly.
+			continue
+		}
+		missing, unexpected := diffCmdLines(golden, parsed)
+		if len(missing) == 0 && len(unexpected) == 0 {
+			matches = append(matches, goldenCmdLine)
+			continue
+		}
+		if mismatch.Nearest == nil || len(missing)+len(unexpected) < len(mismatch.Missing)+len(mismatch.Unexpected) {
+			mismatch.NearestCmdLine = goldenCmdLine
+			mismatch.Nearest = goldenValues[goldenCmdLine]
+			mismatch.Missing = missing
+			mismatch.Unexpected = unexpected
+			mismatch.NearestVerityRootHashes = golden.VerityRootHashes
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, mismatch
+	case 1:
+		return goldenValues[matches[0]], nil
+	default:
+		images := make([]string, 0, len(matches))
+		for _, match := range matches {
+			images = append(images, goldenValues[match].GetImageReleaseName())
+		}
+		return nil, fmt.Errorf("kernel command line matches the parameters of multiple golden values: images %q", images)
+	}
+}
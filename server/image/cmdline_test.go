@@ -0,0 +1,336 @@
+package image
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	rimpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/image_database"
+	attestpb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+const (
+	testRootHash  = "6a3e3d2a0d9f0f4cde04c7c1a7c0cbb1bd1cd1fd3b5d3c44c4a1a41cb3b1b6e9"
+	testRootHash2 = "0f1e2d3c4b5a69788796a5b4c3d2e1f00f1e2d3c4b5a69788796a5b4c3d2e1f0"
+
+	testCOSCmdLine = `BOOT_IMAGE=/syslinux/vmlinuz.A init=/usr/lib/systemd/systemd boot=local rootwait ro noresume loglevel=7 ` +
+		`console=tty1 console=ttyS0 security=apparmor cos.protected_stateful_partition=e ` +
+		`dm-mod.create="vroot,,,ro,0 4077568 verity 0 PARTUUID=aa PARTUUID=aa 4096 4096 509696 509696 sha256 ` + testRootHash + ` 4e2c salt" ` +
+		`cos.launcher=confidential-space root=/dev/dm-0`
+)
+
+func TestParseCmdLine(t *testing.T) {
+	got, err := ParseCmdLine(testCOSCmdLine + "\x00")
+	if err != nil {
+		t.Fatalf("ParseCmdLine() failed: %v", err)
+	}
+
+	wantParams := []CmdLineParam{
+		{Key: "BOOT_IMAGE", Value: "/syslinux/vmlinuz.A", HasValue: true},
+		{Key: "init", Value: "/usr/lib/systemd/systemd", HasValue: true},
+		{Key: "boot", Value: "local", HasValue: true},
+		{Key: "rootwait"},
+		{Key: "ro"},
+		{Key: "noresume"},
+		{Key: "loglevel", Value: "7", HasValue: true},
+		{Key: "console", Value: "tty1", HasValue: true},
+		{Key: "console", Value: "ttyS0", HasValue: true},
+		{Key: "security", Value: "apparmor", HasValue: true},
+		{Key: "cos.protected_stateful_partition", Value: "e", HasValue: true},
+		{Key: "dm-mod.create", Value: "vroot,,,ro,0 4077568 verity 0 PARTUUID=aa PARTUUID=aa 4096 4096 509696 509696 sha256 " + testRootHash + " 4e2c salt", HasValue: true},
+		{Key: "cos.launcher", Value: "confidential-space", HasValue: true},
+		{Key: "root", Value: "/dev/dm-0", HasValue: true},
+	}
+	if diff := cmp.Diff(wantParams, got.Params); diff != "" {
+		t.Errorf("ParseCmdLine() params mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{testRootHash}, got.VerityRootHashes); diff != "" {
+		t.Errorf("ParseCmdLine() verity root hashes mismatch (-want +got):\n%s", diff)
+	}
+	wantCOSOptions := map[string]string{"protected_stateful_partition": "e", "launcher": "confidential-space"}
+	if diff := cmp.Diff(wantCOSOptions, got.COSOptions); diff != "" {
+		t.Errorf("ParseCmdLine() COS options mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseCmdLineQuoting(t *testing.T) {
+	testcases := []struct {
+		name      string
+		cmdLine   string
+		want      []CmdLineParam
+		wantInit  []CmdLineParam
+		wantRoots []string
+	}{
+		{
+			name:    "quoted parameter",
+			cmdLine: `"dm=1 vroot none ro 1,0 4077568 verity payload=PARTUUID=aa hashtree=PARTUUID=aa hashstart=4077568 alg=sha256 root_hexdigest=` + testRootHash + `" ro`,
+			want: []CmdLineParam{
+				{Key: "dm", Value: "1 vroot none ro 1,0 4077568 verity payload=PARTUUID=aa hashtree=PARTUUID=aa hashstart=4077568 alg=sha256 root_hexdigest=" + testRootHash, HasValue: true},
+				{Key: "ro"},
+			},
+			wantRoots: []string{testRootHash},
+		},
+		{
+			name:    "multiple devices",
+			cmdLine: `dm-mod.create="a,,,ro,0 8 verity 1 /dev/a /dev/a 4096 4096 1 1 sha256 ` + testRootHash + ` -;b,,,ro,0 8 verity 1 /dev/b /dev/b 4096 4096 1 1 sha256 ` + testRootHash2 + ` -"`,
+			want: []CmdLineParam{
+				{Key: "dm-mod.create", Value: "a,,,ro,0 8 verity 1 /dev/a /dev/a 4096 4096 1 1 sha256 " + testRootHash + " -;b,,,ro,0 8 verity 1 /dev/b /dev/b 4096 4096 1 1 sha256 " + testRootHash2 + " -", HasValue: true},
+			},
+			wantRoots: []string{testRootHash, testRootHash2},
+		},
+		{
+			name:    "empty value and extra whitespace",
+			cmdLine: "  quiet \t panic=  foo=bar=baz ",
+			want: []CmdLineParam{
+				{Key: "quiet"},
+				{Key: "panic", HasValue: true},
+				{Key: "foo", Value: "bar=baz", HasValue: true},
+			},
+		},
+		{
+			name:    "embedded quote",
+			cmdLine: `a="b c" a=b" "c "d=e"`,
+			want: []CmdLineParam{
+				{Key: "a", Value: "b c", HasValue: true},
+				{Key: "a", Value: `b" "c`, HasValue: true},
+				{Key: "d", Value: "e", HasValue: true},
+			},
+		},
+		{
+			name:    "init parameters",
+			cmdLine: `ro cos.launcher=confidential-space -- single "x y" --`,
+			want: []CmdLineParam{
+				{Key: "ro"},
+				{Key: "cos.launcher", Value: "confidential-space", HasValue: true},
+			},
+			wantInit: []CmdLineParam{
+				{Key: "single"},
+				{Key: "x y"},
+				{Key: "--"},
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseCmdLine(tc.cmdLine)
+			if err != nil {
+				t.Fatalf("ParseCmdLine() failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got.Params); diff != "" {
+				t.Errorf("ParseCmdLine() params mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantInit, got.InitParams); diff != "" {
+				t.Errorf("ParseCmdLine() init params mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantRoots, got.VerityRootHashes, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("ParseCmdLine() verity root hashes mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseCmdLineErrors(t *testing.T) {
+	for _, cmdLine := range []string{`ro dm="1 vroot`, "ro =foo"} {
+		if _, err := ParseCmdLine(cmdLine); err == nil {
+			t.Errorf("ParseCmdLine(%q) succeeded, want error", cmdLine)
+		}
+	}
+}
+
+func cmdLineMachineState(cmdLine string) *attestpb.MachineState {
+	return &attestpb.MachineState{
+		LinuxKernel: &attestpb.LinuxKernelState{
+			CommandLine: cmdLine,
+		},
+	}
+}
+
+func TestGetGoldenValuesReorderedCmdLine(t *testing.T) {
+	want := buildGoldenEntry("test-cos", true, 3, 1234)
+	imageDB := &rimpb.ImageDatabase{
+		GoldenValues: map[string]*rimpb.ImageDatabase_ImageGoldenEntry{
+			testCOSCmdLine:   want,
+			testGoldenKeyFoo: buildGoldenEntry("test-foo", true, 3, 1234),
+		},
+	}
+
+	// Move the cos.launcher option to the front.
+	reordered := "cos.launcher=confidential-space " + strings.Replace(testCOSCmdLine, " cos.launcher=confidential-space", "", 1)
+	got, err := GetGoldenValues(cmdLineMachineState(reordered), imageDB)
+	if err != nil {
+		t.Fatalf("GetGoldenValues() failed: %v", err)
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("GetGoldenValues() returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestGetGoldenValuesCmdLineMismatch(t *testing.T) {
+	nearest := buildGoldenEntry("test-cos", true, 3, 1234)
+	imageDB := &rimpb.ImageDatabase{
+		GoldenValues: map[string]*rimpb.ImageDatabase_ImageGoldenEntry{
+			testCOSCmdLine:   nearest,
+			testGoldenKeyFoo: buildGoldenEntry("test-foo", true, 3, 1234),
+		},
+	}
+
+	testcases := []struct {
+		name           string
+		cmdLine        string
+		wantMissing    []string
+		wantUnexpected []string
+		wantErrStrs    []string
+	}{
+		{
+			name:           "extra parameter",
+			cmdLine:        testCOSCmdLine + " cos.debug=1",
+			wantUnexpected: []string{"cos.debug=1"},
+			wantErrStrs:    []string{`nearest golden entry is image "test-cos"`, "cos.debug=1"},
+		},
+		{
+			name:           "swapped repeated parameter",
+			cmdLine:        strings.Replace(testCOSCmdLine, "console=tty1 console=ttyS0", "console=ttyS0 console=tty1", 1),
+			wantMissing:    []string{"console=tty1", "console=ttyS0"},
+			wantUnexpected: []string{"console=ttyS0", "console=tty1"},
+		},
+		{
+			name:           "different root hash",
+			cmdLine:        strings.Replace(testCOSCmdLine, testRootHash, testRootHash2, 1),
+			wantMissing:    []string{`dm-mod.create="vroot,,,ro,0 4077568 verity 0 PARTUUID=aa PARTUUID=aa 4096 4096 509696 509696 sha256 ` + testRootHash + ` 4e2c salt"`},
+			wantUnexpected: []string{`dm-mod.create="vroot,,,ro,0 4077568 verity 0 PARTUUID=aa PARTUUID=aa 4096 4096 509696 509696 sha256 ` + testRootHash2 + ` 4e2c salt"`},
+			wantErrStrs:    []string{"dm-verity root hashes", testRootHash2},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := GetGoldenValues(cmdLineMachineState(tc.cmdLine), imageDB)
+			var mismatch *CmdLineMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("GetGoldenValues() = %v, want a *CmdLineMismatchError", err)
+			}
+			if mismatch.NearestCmdLine != testCOSCmdLine {
+				t.Errorf("got nearest command line %q, want %q", mismatch.NearestCmdLine, testCOSCmdLine)
+			}
+			if diff := cmp.Diff(nearest, mismatch.Nearest, protocmp.Transform()); diff != "" {
+				t.Errorf("nearest golden entry mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantMissing, mismatch.Missing, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("missing parameters mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantUnexpected, mismatch.Unexpected, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("unexpected parameters mismatch (-want +got):\n%s", diff)
+			}
+			for _, want := range append(tc.wantErrStrs, "is not in the golden values") {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("GetGoldenValues() error %v does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetGoldenValuesAmbiguousCmdLine(t *testing.T) {
+	imageDB := &rimpb.ImageDatabase{
+		GoldenValues: map[string]*rimpb.ImageDatabase_ImageGoldenEntry{
+			"ro=1 quiet=1": buildGoldenEntry("test-foo", true, 3, 1234),
+			"quiet=1 ro=1": buildGoldenEntry("test-bar", false, 3, 5678),
+		},
+	}
+
+	_, err := GetGoldenValues(cmdLineMachineState("ro=1  quiet=1"), imageDB)
+	if err == nil || !strings.Contains(err.Error(), `multiple golden values: images ["test-bar" "test-foo"]`) {
+		t.Errorf("GetGoldenValues() = %v, want ambiguous match error naming the matched images", err)
+	}
+}
+
+func TestGetGoldenValuesInitParams(t *testing.T) {
+	const goldenCmdLine = "ro quiet cos.launcher=confidential-space -- single debug"
+	imageDB := &rimpb.ImageDatabase{
+		GoldenValues: map[string]*rimpb.ImageDatabase_ImageGoldenEntry{
+			goldenCmdLine: buildGoldenEntry("test-init", true, 3, 1234),
+		},
+	}
+
+	// Kernel parameters with a value may move, as long as they stay before the
+	// "--".
+	if _, err := GetGoldenValues(cmdLineMachineState("cos.launcher=confidential-space ro quiet -- single debug"), imageDB); err != nil {
+		t.Errorf("GetGoldenValues() with reordered kernel parameters failed: %v", err)
+	}
+
+	testcases := []struct {
+		name           string
+		cmdLine        string
+		wantMissing    []string
+		wantUnexpected []string
+	}{
+		{
+			name:           "kernel parameter moved to init",
+			cmdLine:        "ro cos.launcher=confidential-space -- quiet single debug",
+			wantMissing:    []string{"ro", "quiet", "--", "single", "debug"},
+			wantUnexpected: []string{"ro", "--", "quiet", "single", "debug"},
+		},
+		{
+			name:           "init parameter moved to kernel",
+			cmdLine:        "ro quiet single cos.launcher=confidential-space -- debug",
+			wantMissing:    []string{"ro", "quiet", "--", "single", "debug"},
+			wantUnexpected: []string{"ro", "quiet", "single", "--", "debug"},
+		},
+		{
+			name:           "reordered init parameters",
+			cmdLine:        "ro quiet cos.launcher=confidential-space -- debug single",
+			wantMissing:    []string{"ro", "quiet", "--", "single", "debug"},
+			wantUnexpected: []string{"ro", "quiet", "--", "debug", "single"},
+		},
+		{
+			// Bare parameters before the "--" reach init as arguments too.
+			name:           "swapped bare parameters",
+			cmdLine:        "quiet ro cos.launcher=confidential-space -- single debug",
+			wantMissing:    []string{"ro", "quiet", "--", "single", "debug"},
+			wantUnexpected: []string{"quiet", "ro", "--", "single", "debug"},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := GetGoldenValues(cmdLineMachineState(tc.cmdLine), imageDB)
+			var mismatch *CmdLineMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("GetGoldenValues() = %v, want a *CmdLineMismatchError", err)
+			}
+			if diff := cmp.Diff(tc.wantMissing, mismatch.Missing, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("missing parameters mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantUnexpected, mismatch.Unexpected, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("unexpected parameters mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetGoldenValuesEmbeddedQuote(t *testing.T) {
+	imageDB := &rimpb.ImageDatabase{
+		GoldenValues: map[string]*rimpb.ImageDatabase_ImageGoldenEntry{
+			`ro a="b c"`: buildGoldenEntry("test-quote", true, 3, 1234),
+		},
+	}
+
+	if _, err := GetGoldenValues(cmdLineMachineState(`a="b c"   ro`), imageDB); err != nil {
+		t.Errorf("GetGoldenValues() with the quoted value failed: %v", err)
+	}
+	_, err := GetGoldenValues(cmdLineMachineState(`ro a=b" "c`), imageDB)
+	var mismatch *CmdLineMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("GetGoldenValues() with an embedded quote = %v, want a *CmdLineMismatchError", err)
+	}
+	if diff := cmp.Diff([]string{`a="b c"`}, mismatch.Missing); diff != "" {
+		t.Errorf("missing parameters mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{`a="b\" \"c"`}, mismatch.Unexpected); diff != "" {
+		t.Errorf("unexpected parameters mismatch (-want +got):\n%s", diff)
+	}
+}
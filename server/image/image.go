@@ -2,33 +2,48 @@
 package image
 
 import (
-	"bytes"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/confidential-space/server/image/data"
+	"github.com/google/go-tpm-tools/server"
 
 	rimpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/image_database"
 	attestpb "github.com/google/go-tpm-tools/proto/attest"
 )
 
-// Validate validates the machinestate against image RIMs. If successful, returns the associated golden values.
-func Validate(machineState *attestpb.MachineState, imageDb *rimpb.ImageDatabase) (*rimpb.ImageDatabase_ImageGoldenEntry, error) {
+// Validate validates the machinestate against image RIMs, including the firmware policy of the Confidential Space base
+// policy, and checks the matching golden values are accepted by the image policy. If successful, returns the
+// associated golden values.
+func Validate(machineState *attestpb.MachineState, imageDb *rimpb.ImageDatabase, policy Policy) (*rimpb.ImageDatabase_ImageGoldenEntry, error) {
 	goldens, err := GetGoldenValues(machineState, imageDb)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get golden values: %v", err)
+		return nil, fmt.Errorf("failed to get golden values: %w", err)
 	}
 
 	if err := validateBaseValues(machineState.GetSecureBoot(), goldens.GetImageBaseVersion(), imageDb); err != nil {
 		return nil, fmt.Errorf("image base values validation failed: %v", err)
 	}
 
+	if err := validateFirmwarePolicy(machineState, imageDb); err != nil {
+		return nil, fmt.Errorf("firmware policy validation failed: %v", err)
+	}
+
+	if err := EvaluatePolicy(goldens, policy); err != nil {
+		return nil, fmt.Errorf("image %q is not accepted by the image policy: %v", goldens.GetImageReleaseName(), err)
+	}
+
 	return goldens, nil
 }
 
-// GetGoldenValues returns the golden values for the associated MachineState.
+// GetGoldenValues returns the golden values for the associated MachineState. The kernel command line matches a
+// golden command line with the same parameters, in any order. If there is none, it returns a *CmdLineMismatchError
+// describing the nearest golden entry.
 func GetGoldenValues(ms *attestpb.MachineState, imageDb *rimpb.ImageDatabase) (*rimpb.ImageDatabase_ImageGoldenEntry, error) {
 	if ms == nil {
 		return nil, errors.New("MachineState is nil")
@@ -41,12 +56,19 @@ func GetGoldenValues(ms *attestpb.MachineState, imageDb *rimpb.ImageDatabase) (*
 		return nil, errors.New("No LinuxKernel state in MachineState")
 	}
 	cmdLine := NormalizeCmdLine(kernelState.GetCommandLine())
-	goldens, ok := imageDb.GetGoldenValues()[cmdLine]
-	if !ok {
-		return nil, fmt.Errorf("kernel command line %q is not in the golden values", cmdLine)
-	}
+	return matchCmdLine(cmdLine, imageDb.GetGoldenValues())
+}
 
-	return goldens, nil
+// validateFirmwarePolicy evaluates the firmware policy of the image database
+// Confidential Space base policy against the MachineState, e.g. requiring a
+// minimum SCRTM version or confidential technology. There is no firmware
+// policy to evaluate if it is unset.
+func validateFirmwarePolicy(ms *attestpb.MachineState, imageDb *rimpb.ImageDatabase) error {
+	firmwarePolicy := imageDb.GetCsBasePolicy().GetFirmwarePolicy()
+	if firmwarePolicy == nil {
+		return nil
+	}
+	return server.EvaluatePolicy(ms, firmwarePolicy)
 }
 
 // validateBaseValues checks the SecureBootState against its expected
@@ -56,6 +78,8 @@ func GetGoldenValues(ms *attestpb.MachineState, imageDb *rimpb.ImageDatabase) (*
 // - SecureBoot is enabled.
 // - The Secure Boot db has no hashes.
 // - The Secure Boot db has exactly one certificate, which exactly matches the one expected known cert given by the image database.
+// - The Secure Boot dbx contains every revocation expected by the image database.
+// - Every Secure Boot authority is one expected by the image database.
 // Original: http://google3/cloud/hosted/confidentialcomputing/clh/service/claims/helper.go;l=166;rcl=705972732.
 func validateBaseValues(sb *attestpb.SecureBootState, imageBaseVersion uint32, imageDb *rimpb.ImageDatabase) error {
 	imageBaseValues, ok := imageDb.GetImageBaseValues()[imageBaseVersion]
@@ -77,16 +101,18 @@ func validateBaseValues(sb *attestpb.SecureBootState, imageBaseVersion uint32, i
 	if len(certs) != 1 {
 		return fmt.Errorf("machineState DB had %v certs, expected one", len(certs))
 	}
-	if len(imageBaseValues.GetDb().GetKnownCertificates()) != 1 {
-		return fmt.Errorf("db should only have one known cert")
+	knownCerts, err := KnownCertificates(imageDb)
+	if err != nil {
+		return err
 	}
-	dbCert := imageBaseValues.GetDb().GetKnownCertificates()[0]
-
-	// Get the known cert by DER corresponding to the image db cert.
-	knownCert := KnownCertificate(dbCert)
-	if knownCert == nil {
-		return errors.New("image DB does not have a known certificate")
+	dbCerts, err := expectedCerts(imageBaseValues.GetDb(), knownCerts)
+	if err != nil {
+		return fmt.Errorf("image DB does not have a known certificate: %v", err)
 	}
+	if len(dbCerts) != 1 {
+		return fmt.Errorf("db should only have one known cert, got %v", len(dbCerts))
+	}
+	dbCert := dbCerts[0]
 
 	// Assert the Secure Boot cert is a DER since the COS cert is not a well-known cert.
 	if _, ok := certs[0].Representation.(*attestpb.Certificate_Der); !ok {
@@ -94,15 +120,208 @@ func validateBaseValues(sb *attestpb.SecureBootState, imageBaseVersion uint32, i
 	}
 
 	// Assert the Secure Boot cert is equal to the image db known cert (for CS, the COS cert).
-	if !bytes.Equal(certs[0].GetDer(), knownCert.Raw) {
+	if certFingerprint(certs[0].GetDer()) != dbCert.fingerprint {
 		return fmt.Errorf("machineState DB certificate did not match the DER of the expected known cert %v for base version %v",
-			dbCert.String(), imageBaseVersion)
+			dbCert.name, imageBaseVersion)
+	}
+
+	if err := validateDbx(sb.GetDbx(), imageBaseValues.GetDbx(), knownCerts); err != nil {
+		return fmt.Errorf("dbx validation failed for base version %v: %v", imageBaseVersion, err)
+	}
+	if err := validateAuthority(sb.GetAuthority(), imageBaseValues.GetAuthority(), knownCerts); err != nil {
+		return fmt.Errorf("authority validation failed for base version %v: %v", imageBaseVersion, err)
 	}
 
 	return nil
 }
 
-// KnownCertificate returns the *x509.Certificate for a given rimpb.ImageDatabase_CCKnownCertificates enum value.
+// validateDbx checks that the Secure Boot dbx contains every expected
+// revocation: the expected known certs and cert fingerprints must be among the
+// dbx certs, and the expected digests among the dbx hashes. A dbx missing any
+// of them is stale.
+func validateDbx(dbx *attestpb.Database, expected *rimpb.ImageDatabase_CCDatabase, knownCerts map[string]*x509.Certificate) error {
+	revoked, err := expectedCerts(expected, knownCerts)
+	if err != nil {
+		return err
+	}
+	got := make(map[string]bool)
+	for _, cert := range dbx.GetCerts() {
+		// A dbx entry that cannot be resolved to a certificate revokes nothing
+		// expected.
+		if fingerprint, err := secureBootCertFingerprint(cert); err == nil {
+			got[fingerprint] = true
+		}
+	}
+	for _, cert := range revoked {
+		if !got[cert.fingerprint] {
+			return fmt.Errorf("machineState dbx is missing revoked certificate %v", cert.name)
+		}
+	}
+
+	gotHashes := make(map[string]bool)
+	for _, hash := range dbx.GetHashes() {
+		gotHashes[hex.EncodeToString(hash)] = true
+	}
+	for _, digest := range expected.GetDigests() {
+		if !gotHashes[strings.ToLower(digest)] {
+			return fmt.Errorf("machineState dbx is missing revoked digest %v", digest)
+		}
+	}
+	return nil
+}
+
+// validateAuthority checks that every Secure Boot authority, the db entries
+// that verified the boot components, is an expected known cert, cert
+// fingerprint or digest. No authorities are checked if none are expected.
+func validateAuthority(authority *attestpb.Database, expected *rimpb.ImageDatabase_CCDatabase, knownCerts map[string]*x509.Certificate) error {
+	allowedCerts, err := expectedCerts(expected, knownCerts)
+	if err != nil {
+		return err
+	}
+	if len(allowedCerts) == 0 && len(expected.GetDigests()) == 0 {
+		return nil
+	}
+	if len(authority.GetCerts()) == 0 && len(authority.GetHashes()) == 0 {
+		return errors.New("machineState has no Secure Boot authority")
+	}
+
+	allowed := make(map[string]bool)
+	for _, cert := range allowedCerts {
+		allowed[cert.fingerprint] = true
+	}
+	for _, cert := range authority.GetCerts() {
+		fingerprint, err := secureBootCertFingerprint(cert)
+		if err != nil {
+			return fmt.Errorf("invalid Secure Boot authority: %v", err)
+		}
+		if !allowed[fingerprint] {
+			return fmt.Errorf("Secure Boot authority certificate with SHA-256 fingerprint %v is not expected", fingerprint)
+		}
+	}
+
+	allowedHashes := make(map[string]bool)
+	for _, digest := range expected.GetDigests() {
+		allowedHashes[strings.ToLower(digest)] = true
+	}
+	for _, hash := range authority.GetHashes() {
+		if digest := hex.EncodeToString(hash); !allowedHashes[digest] {
+			return fmt.Errorf("Secure Boot authority digest %v is not expected", digest)
+		}
+	}
+	return nil
+}
+
+// expectedCert is a certificate expected by a CCDatabase.
+type expectedCert struct {
+	// name is the known cert name, or the fingerprint of an unnamed cert.
+	name string
+	// fingerprint is the lowercase hex SHA-256 digest of the DER certificate.
+	fingerprint string
+}
+
+// expectedCerts resolves the known certs and cert fingerprints of a
+// CCDatabase against the known certs of the image database. A certificate
+// expected both as a known cert and by fingerprint, or under several names, is
+// returned once, under the first name it is expected by.
+func expectedCerts(ccDb *rimpb.ImageDatabase_CCDatabase, knownCerts map[string]*x509.Certificate) ([]expectedCert, error) {
+	var expected []expectedCert
+	seen := make(map[string]bool)
+	for _, known := range ccDb.GetKnownCertificates() {
+		cert, ok := knownCerts[known.String()]
+		if !ok {
+			return nil, fmt.Errorf("image DB has unknown certificate %v", known.String())
+		}
+		fingerprint := certFingerprint(cert.Raw)
+		if seen[fingerprint] {
+			continue
+		}
+		seen[fingerprint] = true
+		expected = append(expected, expectedCert{name: known.String(), fingerprint: fingerprint})
+	}
+
+	// Name fingerprints by the first known cert name in sorted order, so a cert
+	// known under several names is reported consistently.
+	sortedNames := make([]string, 0, len(knownCerts))
+	for name := range knownCerts {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+	names := make(map[string]string)
+	for _, name := range sortedNames {
+		fingerprint := certFingerprint(knownCerts[name].Raw)
+		if _, ok := names[fingerprint]; !ok {
+			names[fingerprint] = name
+		}
+	}
+	for _, fingerprint := range ccDb.GetKnownCertFingerprints() {
+		fingerprint = strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+		if len(fingerprint) != 2*sha256.Size {
+			return nil, fmt.Errorf("image DB has malformed SHA-256 certificate fingerprint %q", fingerprint)
+		}
+		if seen[fingerprint] {
+			continue
+		}
+		seen[fingerprint] = true
+		name, ok := names[fingerprint]
+		if !ok {
+			name = "with SHA-256 fingerprint " + fingerprint
+		}
+		expected = append(expected, expectedCert{name: name, fingerprint: fingerprint})
+	}
+	return expected, nil
+}
+
+// wellKnownCerts are the DER certificates that the go-tpm-tools event log parser
+// reports as well-known certificates rather than by their DER.
+var wellKnownCerts = map[attestpb.WellKnownCertificate][]byte{
+	attestpb.WellKnownCertificate_MS_WINDOWS_PROD_PCA_2011:    server.WindowsProductionPCA2011Cert,
+	attestpb.WellKnownCertificate_MS_THIRD_PARTY_UEFI_CA_2011: server.MicrosoftUEFICA2011Cert,
+	attestpb.WellKnownCertificate_MS_THIRD_PARTY_KEK_CA_2011:  server.MicrosoftKEKCA2011Cert,
+	attestpb.WellKnownCertificate_GCE_DEFAULT_PK:              server.GceDefaultPKCert,
+}
+
+// secureBootCertFingerprint returns the lowercase hex SHA-256 digest of a Secure
+// Boot certificate given either as DER or as a well-known certificate, so both
+// compare against the known certs and fingerprints of the image database.
+func secureBootCertFingerprint(cert *attestpb.Certificate) (string, error) {
+	if der := cert.GetDer(); der != nil {
+		return certFingerprint(der), nil
+	}
+	der, ok := wellKnownCerts[cert.GetWellKnown()]
+	if !ok {
+		return "", fmt.Errorf("unknown well-known certificate %v", cert.GetWellKnown())
+	}
+	return certFingerprint(der), nil
+}
+
+// certFingerprint returns the lowercase hex SHA-256 digest of a DER certificate.
+func certFingerprint(der []byte) string {
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:])
+}
+
+// KnownCertificates returns the known certificates of the image database by
+// name. These are the compiled-in certificates of KnownCertificate, named by
+// their rimpb.ImageDatabase_CCKnownCertificates enum value, overridden and
+// extended by the DER certificates of the image database known_certs.
+func KnownCertificates(imageDb *rimpb.ImageDatabase) (map[string]*x509.Certificate, error) {
+	knownCerts := make(map[string]*x509.Certificate)
+	for value, name := range rimpb.ImageDatabase_CCKnownCertificates_name {
+		if cert := KnownCertificate(rimpb.ImageDatabase_CCKnownCertificates(value)); cert != nil {
+			knownCerts[name] = cert
+		}
+	}
+	for name, der := range imageDb.GetKnownCerts() {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse image DB known cert %q: %v", name, err)
+		}
+		knownCerts[name] = cert
+	}
+	return knownCerts, nil
+}
+
+// KnownCertificate returns the compiled-in *x509.Certificate for a given rimpb.ImageDatabase_CCKnownCertificates enum value.
 func KnownCertificate(known rimpb.ImageDatabase_CCKnownCertificates) *x509.Certificate {
 	switch known {
 	case rimpb.ImageDatabase_COS_DB_V10:
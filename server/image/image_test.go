@@ -9,6 +9,7 @@ import (
 	tpb "google.golang.org/protobuf/types/known/timestamppb"
 	"github.com/GoogleCloudPlatform/confidential-space/server/image/data"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-tpm-tools/server"
 
 	"google.golang.org/protobuf/testing/protocmp"
 	attestpb "github.com/google/go-tpm-tools/proto/attest"
@@ -57,6 +58,40 @@ func TestKnownCertificate(t *testing.T) {
 	}
 }
 
+func TestKnownCertificates(t *testing.T) {
+	imageDB := &rimpb.ImageDatabase{
+		KnownCerts: map[string][]byte{
+			// Override a compiled-in cert.
+			"COS_DB_V10": data.COSDBv20250203Cert.Raw,
+			"COS_DB_NEW": data.COSDBv20251004Cert.Raw,
+		},
+	}
+
+	got, err := KnownCertificates(imageDB)
+	if err != nil {
+		t.Fatalf("KnownCertificates() failed: %v", err)
+	}
+	want := map[string]*x509.Certificate{
+		"COS_DB_V10":       data.COSDBv20250203Cert,
+		"COS_DB_V20250203": data.COSDBv20250203Cert,
+		"COS_DB_V20251004": data.COSDBv20251004Cert,
+		"COS_DB_NEW":       data.COSDBv20251004Cert,
+	}
+	if len(got) != len(want) {
+		t.Errorf("KnownCertificates() returned %v certs, want %v", len(got), len(want))
+	}
+	for name, wantCert := range want {
+		if gotCert, ok := got[name]; !ok || !gotCert.Equal(wantCert) {
+			t.Errorf("KnownCertificates()[%q] did not match the expected cert", name)
+		}
+	}
+
+	imageDB.KnownCerts["COS_DB_BAD"] = []byte("not a cert")
+	if _, err := KnownCertificates(imageDB); err == nil || !strings.Contains(err.Error(), "COS_DB_BAD") {
+		t.Errorf("KnownCertificates() = %v, want parse error for COS_DB_BAD", err)
+	}
+}
+
 func TestGetGoldenValues(t *testing.T) {
 	db := testDatabase(t)
 	ms := &attestpb.MachineState{
@@ -329,6 +364,302 @@ func TestValidateImageBaseValuesErrors(t *testing.T) {
 	}
 }
 
+func TestValidateImageBaseValuesRuntimeKnownCerts(t *testing.T) {
+	sb := &attestpb.SecureBootState{
+		Enabled: true,
+		Db: &attestpb.Database{
+			Certs: []*attestpb.Certificate{
+				&attestpb.Certificate{
+					Representation: &attestpb.Certificate_Der{
+						Der: data.COSDBv10Cert.Raw,
+					},
+				},
+			},
+		},
+	}
+
+	testcases := []struct {
+		name       string
+		knownCerts map[string][]byte
+		db         *rimpb.ImageDatabase_CCDatabase
+		wantErrStr string
+	}{
+		{
+			name:       "known cert overridden by the image database",
+			knownCerts: map[string][]byte{"COS_DB_V20251004": data.COSDBv10Cert.Raw},
+			db: &rimpb.ImageDatabase_CCDatabase{
+				KnownCertificates: []rimpb.ImageDatabase_CCKnownCertificates{rimpb.ImageDatabase_COS_DB_V20251004},
+			},
+		},
+		{
+			name:       "fingerprint of an image database known cert",
+			knownCerts: map[string][]byte{"COS_DB_NEW": data.COSDBv10Cert.Raw},
+			db: &rimpb.ImageDatabase_CCDatabase{
+				KnownCertFingerprints: []string{certFingerprint(data.COSDBv10Cert.Raw)},
+			},
+		},
+		{
+			name: "uppercase colon-separated fingerprint",
+			db: &rimpb.ImageDatabase_CCDatabase{
+				KnownCertFingerprints: []string{colonFingerprint(certFingerprint(data.COSDBv10Cert.Raw))},
+			},
+		},
+		{
+			name:       "mismatched fingerprint",
+			knownCerts: map[string][]byte{"COS_DB_NEW": data.COSDBv20251004Cert.Raw},
+			db: &rimpb.ImageDatabase_CCDatabase{
+				KnownCertFingerprints: []string{certFingerprint(data.COSDBv20251004Cert.Raw)},
+			},
+			wantErrStr: "expected known cert COS_DB_NEW",
+		},
+		{
+			name: "malformed fingerprint",
+			db: &rimpb.ImageDatabase_CCDatabase{
+				KnownCertFingerprints: []string{"abcd"},
+			},
+			wantErrStr: "malformed SHA-256 certificate fingerprint",
+		},
+		{
+			name: "same cert as known cert and fingerprint",
+			db: &rimpb.ImageDatabase_CCDatabase{
+				KnownCertificates:     []rimpb.ImageDatabase_CCKnownCertificates{rimpb.ImageDatabase_COS_DB_V10},
+				KnownCertFingerprints: []string{colonFingerprint(certFingerprint(data.COSDBv10Cert.Raw))},
+			},
+		},
+		{
+			name: "different known cert and fingerprint",
+			db: &rimpb.ImageDatabase_CCDatabase{
+				KnownCertificates:     []rimpb.ImageDatabase_CCKnownCertificates{rimpb.ImageDatabase_COS_DB_V10},
+				KnownCertFingerprints: []string{certFingerprint(data.COSDBv20251004Cert.Raw)},
+			},
+			wantErrStr: "only have one known cert, got 2",
+		},
+		{
+			name:       "malformed known cert",
+			knownCerts: map[string][]byte{"COS_DB_V10": []byte("not a cert")},
+			db: &rimpb.ImageDatabase_CCDatabase{
+				KnownCertificates: []rimpb.ImageDatabase_CCKnownCertificates{rimpb.ImageDatabase_COS_DB_V10},
+			},
+			wantErrStr: "failed to parse image DB known cert",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			imageDB := testDatabase(t)
+			imageDB.KnownCerts = tc.knownCerts
+			imageDB.GetImageBaseValues()[3].Db = tc.db
+
+			err := validateBaseValues(sb, 3, imageDB)
+			if tc.wantErrStr == "" {
+				if err != nil {
+					t.Errorf("validateBaseValues() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErrStr) {
+				t.Errorf("validateBaseValues() = %v, want error containing %q", err, tc.wantErrStr)
+			}
+		})
+	}
+}
+
+func colonFingerprint(fingerprint string) string {
+	var parts []string
+	for i := 0; i < len(fingerprint); i += 2 {
+		parts = append(parts, strings.ToUpper(fingerprint[i:i+2]))
+	}
+	return strings.Join(parts, ":")
+}
+
+func TestValidateImageBaseValuesDbxAuthority(t *testing.T) {
+	revokedDigest := []byte{0xde, 0xad, 0xbe, 0xef}
+	dbxImageDB := func() *rimpb.ImageDatabase {
+		imageDB := testDatabase(t)
+		imageDB.GetImageBaseValues()[3].Dbx = &rimpb.ImageDatabase_CCDatabase{
+			KnownCertificates:     []rimpb.ImageDatabase_CCKnownCertificates{rimpb.ImageDatabase_COS_DB_V10},
+			KnownCertFingerprints: []string{strings.ToUpper(certFingerprint(data.COSDBv20250203Cert.Raw))},
+			Digests:               []string{"DEADBEEF"},
+		}
+		imageDB.GetImageBaseValues()[3].Authority = &rimpb.ImageDatabase_CCDatabase{
+			KnownCertificates: []rimpb.ImageDatabase_CCKnownCertificates{rimpb.ImageDatabase_COS_DB_V20251004},
+		}
+		return imageDB
+	}
+	derCert := func(cert *x509.Certificate) *attestpb.Certificate {
+		return &attestpb.Certificate{Representation: &attestpb.Certificate_Der{Der: cert.Raw}}
+	}
+	validSB := func() *attestpb.SecureBootState {
+		return &attestpb.SecureBootState{
+			Enabled: true,
+			Db:      &attestpb.Database{Certs: []*attestpb.Certificate{derCert(data.COSDBv20251004Cert)}},
+			Dbx: &attestpb.Database{
+				Certs:  []*attestpb.Certificate{derCert(data.COSDBv10Cert), derCert(data.COSDBv20250203Cert)},
+				Hashes: [][]byte{[]byte("other hash"), revokedDigest},
+			},
+			Authority: &attestpb.Database{Certs: []*attestpb.Certificate{derCert(data.COSDBv20251004Cert)}},
+		}
+	}
+
+	if err := validateBaseValues(validSB(), 3, dbxImageDB()); err != nil {
+		t.Fatalf("validateBaseValues() failed: %v", err)
+	}
+
+	testcases := []struct {
+		name       string
+		sb         func() *attestpb.SecureBootState
+		db         func() *rimpb.ImageDatabase
+		wantErrStr string
+	}{
+		{
+			name: "dbx missing known cert",
+			sb: func() *attestpb.SecureBootState {
+				sb := validSB()
+				sb.Dbx.Certs = sb.Dbx.Certs[1:]
+				return sb
+			},
+			db:         dbxImageDB,
+			wantErrStr: "dbx is missing revoked certificate",
+		},
+		{
+			name: "dbx missing fingerprint",
+			sb: func() *attestpb.SecureBootState {
+				sb := validSB()
+				sb.Dbx.Certs = sb.Dbx.Certs[:1]
+				return sb
+			},
+			db:         dbxImageDB,
+			wantErrStr: "dbx is missing revoked certificate",
+		},
+		{
+			name: "dbx missing digest",
+			sb: func() *attestpb.SecureBootState {
+				sb := validSB()
+				sb.Dbx.Hashes = sb.Dbx.Hashes[:1]
+				return sb
+			},
+			db:         dbxImageDB,
+			wantErrStr: "dbx is missing revoked digest",
+		},
+		{
+			name: "empty dbx",
+			sb: func() *attestpb.SecureBootState {
+				sb := validSB()
+				sb.Dbx = nil
+				return sb
+			},
+			db:         dbxImageDB,
+			wantErrStr: "dbx is missing",
+		},
+		{
+			name: "unknown dbx cert",
+			sb:   validSB,
+			db: func() *rimpb.ImageDatabase {
+				imageDB := dbxImageDB()
+				imageDB.GetImageBaseValues()[3].Dbx.KnownCertificates = []rimpb.ImageDatabase_CCKnownCertificates{rimpb.ImageDatabase_UNSPECIFIED_CERT}
+				return imageDB
+			},
+			wantErrStr: "unknown certificate",
+		},
+		{
+			name: "no authority",
+			sb: func() *attestpb.SecureBootState {
+				sb := validSB()
+				sb.Authority = nil
+				return sb
+			},
+			db:         dbxImageDB,
+			wantErrStr: "no Secure Boot authority",
+		},
+		{
+			name: "unexpected authority cert",
+			sb: func() *attestpb.SecureBootState {
+				sb := validSB()
+				sb.Authority.Certs = append(sb.Authority.Certs, derCert(data.COSDBv10Cert))
+				return sb
+			},
+			db:         dbxImageDB,
+			wantErrStr: "authority certificate with SHA-256 fingerprint " + certFingerprint(data.COSDBv10Cert.Raw) + " is not expected",
+		},
+		{
+			name: "unexpected authority digest",
+			sb: func() *attestpb.SecureBootState {
+				sb := validSB()
+				sb.Authority.Hashes = [][]byte{revokedDigest}
+				return sb
+			},
+			db:         dbxImageDB,
+			wantErrStr: "authority digest deadbeef is not expected",
+		},
+		{
+			name: "unexpected well-known authority cert",
+			sb: func() *attestpb.SecureBootState {
+				sb := validSB()
+				sb.Authority.Certs = []*attestpb.Certificate{wellKnownCert(attestpb.WellKnownCertificate_MS_WINDOWS_PROD_PCA_2011)}
+				return sb
+			},
+			db:         dbxImageDB,
+			wantErrStr: "authority certificate with SHA-256 fingerprint " + certFingerprint(server.WindowsProductionPCA2011Cert) + " is not expected",
+		},
+		{
+			name: "unknown well-known authority cert",
+			sb: func() *attestpb.SecureBootState {
+				sb := validSB()
+				sb.Authority.Certs = []*attestpb.Certificate{wellKnownCert(attestpb.WellKnownCertificate_UNKNOWN)}
+				return sb
+			},
+			db:         dbxImageDB,
+			wantErrStr: "unknown well-known certificate UNKNOWN",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateBaseValues(tc.sb(), 3, tc.db())
+			if err == nil {
+				t.Fatalf("Expected error from validateBaseValues(), got nil")
+			}
+
+			if !strings.Contains(err.Error(), tc.wantErrStr) {
+				t.Errorf("validateBaseValues() did not contain expected error string: %v, want %q", err, tc.wantErrStr)
+			}
+		})
+	}
+}
+
+func wellKnownCert(wellKnown attestpb.WellKnownCertificate) *attestpb.Certificate {
+	return &attestpb.Certificate{Representation: &attestpb.Certificate_WellKnown{WellKnown: wellKnown}}
+}
+
+func TestValidateImageBaseValuesWellKnown(t *testing.T) {
+	imageDB := testDatabase(t)
+	imageDB.GetImageBaseValues()[3].Dbx = &rimpb.ImageDatabase_CCDatabase{
+		KnownCertFingerprints: []string{certFingerprint(server.MicrosoftUEFICA2011Cert)},
+	}
+	imageDB.GetImageBaseValues()[3].Authority = &rimpb.ImageDatabase_CCDatabase{
+		KnownCertificates:     []rimpb.ImageDatabase_CCKnownCertificates{rimpb.ImageDatabase_COS_DB_V20251004},
+		KnownCertFingerprints: []string{certFingerprint(server.GceDefaultPKCert)},
+	}
+	sb := &attestpb.SecureBootState{
+		Enabled: true,
+		Db:      &attestpb.Database{Certs: []*attestpb.Certificate{{Representation: &attestpb.Certificate_Der{Der: data.COSDBv20251004Cert.Raw}}}},
+		Dbx:     &attestpb.Database{Certs: []*attestpb.Certificate{wellKnownCert(attestpb.WellKnownCertificate_MS_THIRD_PARTY_UEFI_CA_2011)}},
+		Authority: &attestpb.Database{Certs: []*attestpb.Certificate{
+			{Representation: &attestpb.Certificate_Der{Der: data.COSDBv20251004Cert.Raw}},
+			wellKnownCert(attestpb.WellKnownCertificate_GCE_DEFAULT_PK),
+		}},
+	}
+
+	if err := validateBaseValues(sb, 3, imageDB); err != nil {
+		t.Errorf("validateBaseValues() with well-known dbx and authority certs failed: %v", err)
+	}
+
+	sb.Dbx.Certs = []*attestpb.Certificate{wellKnownCert(attestpb.WellKnownCertificate_MS_THIRD_PARTY_KEK_CA_2011)}
+	if err := validateBaseValues(sb, 3, imageDB); err == nil || !strings.Contains(err.Error(), "dbx is missing revoked certificate") {
+		t.Errorf("validateBaseValues() with another well-known dbx cert = %v, want missing revoked certificate error", err)
+	}
+}
+
 func TestValidate(t *testing.T) {
 	validMs := &attestpb.MachineState{
 		LinuxKernel: &attestpb.LinuxKernelState{
@@ -356,13 +687,115 @@ func TestValidate(t *testing.T) {
 		rimpb.ImageDatabase_USABLE,
 	)
 
-	got, err := Validate(validMs, imageDB)
+	policy := Policy{
+		RequireHardened: true,
+		RequiredLabels:  []rimpb.ImageDatabase_AttributeLabel{rimpb.ImageDatabase_STABLE},
+		ForbiddenLabels: []rimpb.ImageDatabase_AttributeLabel{rimpb.ImageDatabase_TEST, rimpb.ImageDatabase_EXPERIMENTAL},
+		MinSwVersion:    1234,
+	}
+
+	got, err := Validate(validMs, imageDB, policy)
 	if err != nil {
 		t.Fatalf("Validate() failed: %v", err)
 	}
 	if diff := cmp.Diff(wantEntry, got, protocmp.Transform()); diff != "" {
 		t.Errorf("Validate() returned unexpected diff (-want +got):\n%s", diff)
 	}
+
+	policy.MinSwVersion = 1235
+	if _, err := Validate(validMs, imageDB, policy); err == nil || !strings.Contains(err.Error(), "not accepted by the image policy") {
+		t.Errorf("Validate() = %v, want image policy error", err)
+	}
+
+	// The zero Policy accepts deprecated images.
+	imageDB.GetGoldenValues()[testGoldenKeyFoo].Deprecated = true
+	if _, err := Validate(validMs, imageDB, Policy{}); err != nil {
+		t.Errorf("Validate() of a deprecated image with the zero Policy failed: %v", err)
+	}
+	if _, err := Validate(validMs, imageDB, Policy{RejectDeprecated: true}); err == nil || !strings.Contains(err.Error(), "deprecated") {
+		t.Errorf("Validate() of a deprecated image with RejectDeprecated = %v, want deprecated error", err)
+	}
+}
+
+func TestValidateFirmwarePolicy(t *testing.T) {
+	ms := &attestpb.MachineState{
+		Platform: &attestpb.PlatformState{
+			Firmware:   &attestpb.PlatformState_GceVersion{GceVersion: 1},
+			Technology: attestpb.GCEConfidentialTechnology_AMD_SEV,
+		},
+		LinuxKernel: &attestpb.LinuxKernelState{
+			CommandLine: testGoldenKeyFoo,
+		},
+		SecureBoot: &attestpb.SecureBootState{
+			Enabled: true,
+			Db: &attestpb.Database{
+				Certs: []*attestpb.Certificate{
+					&attestpb.Certificate{
+						Representation: &attestpb.Certificate_Der{
+							Der: data.COSDBv20251004Cert.Raw,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	testcases := []struct {
+		name       string
+		policy     *attestpb.Policy
+		wantErrStr string
+	}{
+		{
+			name: "no firmware policy",
+		},
+		{
+			name: "compliant",
+			policy: &attestpb.Policy{
+				Platform: &attestpb.PlatformPolicy{
+					MinimumGceFirmwareVersion: 1,
+					MinimumTechnology:         attestpb.GCEConfidentialTechnology_AMD_SEV,
+				},
+			},
+		},
+		{
+			name: "minimum technology",
+			policy: &attestpb.Policy{
+				Platform: &attestpb.PlatformPolicy{
+					MinimumTechnology: attestpb.GCEConfidentialTechnology_AMD_SEV_ES,
+				},
+			},
+			wantErrStr: "GCE Confidential Technology",
+		},
+		{
+			name: "disallowed SCRTM version",
+			policy: &attestpb.Policy{
+				Platform: &attestpb.PlatformPolicy{
+					AllowedScrtmVersionIds: [][]byte{[]byte("other version")},
+				},
+			},
+			wantErrStr: "SCRTM version",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			imageDB := testDatabase(t)
+			if tc.policy != nil {
+				imageDB.CsBasePolicy = &rimpb.ImageDatabase_ConfidentialSpaceBasePolicy{FirmwarePolicy: tc.policy}
+			}
+
+			_, err := Validate(ms, imageDB, Policy{})
+			if tc.wantErrStr == "" {
+				if err != nil {
+					t.Errorf("Validate() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "firmware policy") || !strings.Contains(err.Error(), tc.wantErrStr) {
+				t.Errorf("Validate() = %v, want firmware policy error containing %q", err, tc.wantErrStr)
+			}
+		})
+	}
 }
 
 func testDatabase(t *testing.T) *rimpb.ImageDatabase {
@@ -0,0 +1,63 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	rimpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/image_database"
+)
+
+// Policy restricts the Confidential Space images accepted by Validate, as
+// described by their golden entry in the image database.
+type Policy struct {
+	// RequireHardened is whether the image must be a hardened (production) image.
+	RequireHardened bool
+	// RequiredLabels are the attribute labels the image must all have, e.g.
+	// STABLE.
+	RequiredLabels []rimpb.ImageDatabase_AttributeLabel
+	// ForbiddenLabels are the attribute labels the image must not have, e.g.
+	// TEST and EXPERIMENTAL.
+	ForbiddenLabels []rimpb.ImageDatabase_AttributeLabel
+	// MinSwVersion is the minimum swversion of the image.
+	MinSwVersion uint32
+	// RejectDeprecated is whether a deprecated image is rejected, as
+	// image_database.proto requires of attestation validation.
+	RejectDeprecated bool
+}
+
+// EvaluatePolicy checks the golden entry of an image against the image policy.
+// It returns nil if the image is accepted, or an error joining the reason for
+// every failure.
+func EvaluatePolicy(golden *rimpb.ImageDatabase_ImageGoldenEntry, policy Policy) error {
+	if golden == nil {
+		return errors.New("golden entry is nil")
+	}
+
+	var failures []error
+	if policy.RejectDeprecated && golden.GetDeprecated() {
+		failures = append(failures, errors.New("image is deprecated"))
+	}
+
+	if policy.RequireHardened && !golden.GetIsHardened() {
+		failures = append(failures, errors.New("image is not hardened, but the image policy requires it"))
+	}
+
+	labels := golden.GetAttributeLabels()
+	for _, label := range policy.RequiredLabels {
+		if !slices.Contains(labels, label) {
+			failures = append(failures, fmt.Errorf("image does not have the required label %v", label))
+		}
+	}
+	for _, label := range policy.ForbiddenLabels {
+		if slices.Contains(labels, label) {
+			failures = append(failures, fmt.Errorf("image has the forbidden label %v", label))
+		}
+	}
+
+	if golden.GetSwversion() < policy.MinSwVersion {
+		failures = append(failures, fmt.Errorf("image swversion %v is below the minimum swversion %v", golden.GetSwversion(), policy.MinSwVersion))
+	}
+
+	return errors.Join(failures...)
+}
@@ -0,0 +1,96 @@
+package image
+
+import (
+	"strings"
+	"testing"
+
+	rimpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/image_database"
+)
+
+func TestEvaluatePolicy(t *testing.T) {
+	stablePolicy := Policy{
+		RequireHardened:  true,
+		RequiredLabels:   []rimpb.ImageDatabase_AttributeLabel{rimpb.ImageDatabase_STABLE},
+		ForbiddenLabels:  []rimpb.ImageDatabase_AttributeLabel{rimpb.ImageDatabase_TEST, rimpb.ImageDatabase_EXPERIMENTAL},
+		MinSwVersion:     1000,
+		RejectDeprecated: true,
+	}
+	deprecated := func(golden *rimpb.ImageDatabase_ImageGoldenEntry) *rimpb.ImageDatabase_ImageGoldenEntry {
+		golden.Deprecated = true
+		return golden
+	}
+
+	testCases := []struct {
+		name     string
+		golden   *rimpb.ImageDatabase_ImageGoldenEntry
+		policy   Policy
+		wantErrs []string
+	}{
+		{
+			name:   "accepted",
+			golden: buildGoldenEntry("test-foo", true, 3, 1234, rimpb.ImageDatabase_LATEST, rimpb.ImageDatabase_STABLE),
+			policy: stablePolicy,
+		},
+		{
+			name:   "empty policy accepts debug image",
+			golden: buildGoldenEntry("test-bar", false, 3, 5, rimpb.ImageDatabase_TEST),
+		},
+		{
+			name:   "empty policy accepts deprecated image",
+			golden: deprecated(buildGoldenEntry("test-foo", true, 3, 1234)),
+		},
+		{
+			name:     "deprecated rejected",
+			golden:   deprecated(buildGoldenEntry("test-foo", true, 3, 1234)),
+			policy:   Policy{RejectDeprecated: true},
+			wantErrs: []string{"deprecated"},
+		},
+		{
+			name:   "every failure",
+			golden: deprecated(buildGoldenEntry("test-bar", false, 3, 999, rimpb.ImageDatabase_TEST, rimpb.ImageDatabase_EXPERIMENTAL)),
+			policy: stablePolicy,
+			wantErrs: []string{
+				"deprecated",
+				"not hardened",
+				"required label STABLE",
+				"forbidden label TEST",
+				"forbidden label EXPERIMENTAL",
+				"swversion 999 is below the minimum swversion 1000",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := EvaluatePolicy(tc.golden, tc.policy)
+			if len(tc.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("EvaluatePolicy() failed: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("EvaluatePolicy() succeeded, want %d failures", len(tc.wantErrs))
+			}
+			joined, ok := err.(interface{ Unwrap() []error })
+			if !ok {
+				t.Fatalf("EvaluatePolicy() returned %T, want a joined error", err)
+			}
+			failures := joined.Unwrap()
+			if len(failures) != len(tc.wantErrs) {
+				t.Fatalf("EvaluatePolicy() returned %d failures, want %d: %v", len(failures), len(tc.wantErrs), err)
+			}
+			for i, want := range tc.wantErrs {
+				if !strings.Contains(failures[i].Error(), want) {
+					t.Errorf("failure %d = %q, want it to contain %q", i, failures[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluatePolicyNilGolden(t *testing.T) {
+	if err := EvaluatePolicy(nil, Policy{}); err == nil {
+		t.Error("EvaluatePolicy(nil) succeeded, want error")
+	}
+}
@@ -0,0 +1,471 @@
+// Package main prints the records of a COS CEL, a Host CEL or a TCG PC Client
+// event log, and optionally replays the log against a PCR or RTMR bank.
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/GoogleCloudPlatform/confidential-space/server/extract"
+	"github.com/google/go-eventlog/cel"
+	"github.com/google/go-eventlog/proto/state"
+	"github.com/google/go-eventlog/register"
+	"github.com/google/go-eventlog/tcg"
+	"google.golang.org/protobuf/proto"
+
+	hostcel "github.com/GoogleCloudPlatform/confidential-space/server/host/coscel"
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+)
+
+/*
+Usage:
+$ go run ./inspect_eventlog -type cos [-json] [-bank bank.json] cel_launch_event_log.bin
+
+-type is one of:
+  cos   COS CEL (cel_launch_event_log of a VmAttestation)
+  host  Host CEL (cel_launch_event_log of a HostAttestation)
+  tcg   TCG PC Client event log (pcclient_boot_event_log)
+
+The optional bank file holds the PCR or RTMR values to replay the log against,
+as hex strings keyed by register index:
+{"hash": "SHA256", "pcrs": {"13": "<hex>"}}
+{"rtmrs": {"3": "<hex>"}}
+*/
+
+const (
+	cosLogType  = "cos"
+	hostLogType = "host"
+	tcgLogType  = "tcg"
+)
+
+var (
+	logType    = flag.String("type", "", "event log type: cos, host or tcg")
+	jsonOutput = flag.Bool("json", false, "print the records as JSON")
+	bankPath   = flag.String("bank", "", "optional JSON file of PCR or RTMR values to replay the event log against")
+)
+
+type record struct {
+	RecNum    uint64            `json:"rec_num"`
+	IndexType string            `json:"index_type"`
+	Index     uint32            `json:"index"`
+	EventType string            `json:"event_type"`
+	Digests   map[string]string `json:"digests"`
+	Content   string            `json:"content"`
+}
+
+type mrReplay struct {
+	Index                uint8   `json:"index"`
+	Quoted               string  `json:"quoted"`
+	Replayed             string  `json:"replayed"`
+	Consistent           bool    `json:"consistent"`
+	LastConsistentRecNum *uint64 `json:"last_consistent_rec_num"`
+}
+
+type digestMismatch struct {
+	RecNum uint64 `json:"rec_num"`
+	Index  uint8  `json:"index"`
+	Error  string `json:"error"`
+}
+
+type replayResult struct {
+	OK               bool             `json:"ok"`
+	Error            string           `json:"error,omitempty"`
+	MRs              []mrReplay       `json:"mrs,omitempty"`
+	DigestMismatches []digestMismatch `json:"digest_mismatches,omitempty"`
+}
+
+type output struct {
+	Type    string        `json:"type"`
+	Records []record      `json:"records"`
+	Replay  *replayResult `json:"replay,omitempty"`
+}
+
+type bankFile struct {
+	// Hash is the PCR bank hash algorithm, e.g. SHA256. RTMRs are always SHA384.
+	Hash  string         `json:"hash"`
+	PCRs  map[int]string `json:"pcrs"`
+	RTMRs map[int]string `json:"rtmrs"`
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Unexpected number of arguments %v, expect 1\n", flag.NArg())
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	rawLog, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read event log: %v\n", err)
+		os.Exit(1)
+	}
+
+	var bank register.MRBank
+	if *bankPath != "" {
+		rawBank, err := os.ReadFile(*bankPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read bank file: %v\n", err)
+			os.Exit(1)
+		}
+		if bank, err = parseBank(rawBank); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse bank file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	out, err := inspect(*logType, rawLog, bank)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to inspect event log: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		err = printJSON(os.Stdout, out)
+	} else {
+		err = printText(os.Stdout, out)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to print event log: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// parseBank parses a bank file into a PCRBank or an RTMRBank.
+func parseBank(rawBank []byte) (register.MRBank, error) {
+	bf := bankFile{}
+	if err := json.Unmarshal(rawBank, &bf); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(bf.PCRs) != 0 && len(bf.RTMRs) != 0:
+		return nil, fmt.Errorf("bank file must hold either PCRs or RTMRs, not both")
+	case len(bf.PCRs) != 0:
+		hashAlgo, ok := state.HashAlgo_value[bf.Hash]
+		if !ok {
+			return nil, fmt.Errorf("unknown PCR bank hash %q", bf.Hash)
+		}
+		bank := register.PCRBank{TCGHashAlgo: state.HashAlgo(hashAlgo)}
+		cryptoHash, err := bank.TCGHashAlgo.CryptoHash()
+		if err != nil {
+			return nil, err
+		}
+		for index, value := range bf.PCRs {
+			digest, err := hex.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode PCR %d: %v", index, err)
+			}
+			bank.PCRs = append(bank.PCRs, register.PCR{Index: index, Digest: digest, DigestAlg: cryptoHash})
+		}
+		return bank, nil
+	case len(bf.RTMRs) != 0:
+		bank := register.RTMRBank{}
+		for index, value := range bf.RTMRs {
+			digest, err := hex.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode RTMR %d: %v", index, err)
+			}
+			bank.RTMRs = append(bank.RTMRs, register.RTMR{Index: index, Digest: digest})
+		}
+		return bank, nil
+	default:
+		return nil, fmt.Errorf("bank file holds no PCRs or RTMRs")
+	}
+}
+
+// inspect decodes the records of the event log and, if bank is set, replays
+// the event log against it.
+func inspect(logType string, rawLog []byte, bank register.MRBank) (*output, error) {
+	switch logType {
+	case cosLogType, hostLogType:
+		return inspectCEL(logType, rawLog, bank)
+	case tcgLogType:
+		return inspectTCG(rawLog, bank)
+	default:
+		return nil, fmt.Errorf("unknown event log type %q, expect one of %s, %s or %s", logType, cosLogType, hostLogType, tcgLogType)
+	}
+}
+
+func inspectCEL(logType string, rawLog []byte, bank register.MRBank) (*output, error) {
+	eventLog, err := cel.DecodeToCEL(bytes.NewBuffer(rawLog))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode CEL: %v", err)
+	}
+
+	out := &output{Type: logType, Records: []record{}}
+	for _, r := range eventLog.Records() {
+		rec := record{
+			RecNum:    r.RecNum,
+			IndexType: celIndexType(r.IndexType),
+			Index:     uint32(r.Index),
+			Digests:   celDigests(r.Digests),
+		}
+		if logType == cosLogType {
+			rec.EventType, rec.Content = cosEvent(r.Content)
+		} else {
+			rec.EventType, rec.Content = hostEvent(r.Content)
+		}
+		out.Records = append(out.Records, rec)
+	}
+
+	if bank != nil {
+		out.Replay = replayCEL(eventLog, bank)
+	}
+	return out, nil
+}
+
+func celIndexType(indexType cel.MRType) string {
+	switch indexType {
+	case cel.PCRType:
+		return "PCR"
+	case cel.CCMRType:
+		return "CCMR"
+	default:
+		return fmt.Sprintf("MRType(%d)", indexType)
+	}
+}
+
+func celDigests(digests map[crypto.Hash][]byte) map[string]string {
+	out := make(map[string]string)
+	for hashAlgo, digest := range digests {
+		out[hashAlgo.String()] = hex.EncodeToString(digest)
+	}
+	return out
+}
+
+func cosEvent(content cel.TLV) (string, string) {
+	if !coscel.IsCOSTLV(content) {
+		return fmt.Sprintf("CELContentType(%d)", content.Type), hex.EncodeToString(content.Value)
+	}
+	cosTLV, err := coscel.ParseToCOSTLV(content)
+	if err != nil {
+		return "MalformedCOSTLV", hex.EncodeToString(content.Value)
+	}
+
+	switch cosTLV.EventType {
+	case coscel.LaunchSeparatorType:
+		return cosTLV.EventType.String(), ""
+	case coscel.MemoryMonitorType:
+		if len(cosTLV.EventContent) == 1 && cosTLV.EventContent[0] == 1 {
+			return cosTLV.EventType.String(), "enabled"
+		}
+		return cosTLV.EventType.String(), "disabled"
+	case coscel.GPUDeviceAttestationBindingType:
+		return cosTLV.EventType.String(), gpuReportSummary(cosTLV.EventContent)
+	case coscel.ImageRefType, coscel.ImageDigestType, coscel.RestartPolicyType, coscel.ImageIDType,
+		coscel.ArgType, coscel.EnvVarType, coscel.OverrideArgType, coscel.OverrideEnvType, coscel.GpuCCModeType,
+		coscel.ContainerRestartCountType, coscel.ContainerExitStatusType, coscel.RuntimeMountType:
+		return cosTLV.EventType.String(), string(cosTLV.EventContent)
+	default:
+		return cosTLV.EventType.String(), hex.EncodeToString(cosTLV.EventContent)
+	}
+}
+
+func hostEvent(content cel.TLV) (string, string) {
+	if !hostcel.IsCOSTLV(content) {
+		return fmt.Sprintf("CELContentType(%d)", content.Type), hex.EncodeToString(content.Value)
+	}
+	hostTLV, err := hostcel.ParseToCOSTLV(content)
+	if err != nil {
+		return "MalformedHostCOSTLV", hex.EncodeToString(content.Value)
+	}
+	return hostTLV.EventType.String(), hex.EncodeToString(hostTLV.EventContent)
+}
+
+func gpuReportSummary(content []byte) string {
+	report := &attestpb.NvidiaAttestationReport{}
+	if err := proto.Unmarshal(content, report); err != nil {
+		return fmt.Sprintf("malformed GPU attestation report: %v", err)
+	}
+
+	var mode string
+	var gpus []*attestpb.GpuInfo
+	switch {
+	case report.GetSpt() != nil:
+		mode = "SPT"
+		gpus = []*attestpb.GpuInfo{report.GetSpt().GetGpuQuote()}
+	case report.GetMpt() != nil:
+		mode = "MPT"
+		gpus = report.GetMpt().GetGpuQuotes()
+	default:
+		mode = "unknown CC feature"
+	}
+
+	var gpuSummaries []string
+	for _, gpu := range gpus {
+		gpuSummaries = append(gpuSummaries, fmt.Sprintf("{uuid=%s architecture=%v driver=%s vbios=%s}",
+			gpu.GetUuid(), gpu.GetGpuArchitectureType(), gpu.GetDriverVersion(), gpu.GetVbiosVersion()))
+	}
+	return fmt.Sprintf("%s nonce=%x gpus=[%s]", mode, report.GetNonce(), strings.Join(gpuSummaries, " "))
+}
+
+func replayCEL(eventLog cel.CEL, bank register.MRBank) *replayResult {
+	if err := eventLog.Replay(bank); err != nil {
+		report, diagErr := extract.DiagnoseReplay(eventLog, bank)
+		return replayFailure(err, report, diagErr)
+	}
+	return &replayResult{OK: true}
+}
+
+// replayFailure converts a failed replay and its diagnostics report to a
+// replayResult.
+func replayFailure(replayErr error, report *extract.ReplayReport, diagErr error) *replayResult {
+	result := &replayResult{Error: replayErr.Error()}
+	if diagErr != nil {
+		result.Error = fmt.Sprintf("%s (failed to diagnose replay: %v)", result.Error, diagErr)
+		return result
+	}
+	for _, mr := range report.MRs {
+		result.MRs = append(result.MRs, mrReplay{
+			Index:                mr.Index,
+			Quoted:               hex.EncodeToString(mr.Quoted),
+			Replayed:             hex.EncodeToString(mr.Replayed),
+			Consistent:           mr.Consistent(),
+			LastConsistentRecNum: mr.LastConsistentRecNum,
+		})
+	}
+	for _, mismatch := range report.DigestMismatches {
+		result.DigestMismatches = append(result.DigestMismatches, digestMismatch{
+			RecNum: mismatch.RecNum,
+			Index:  mismatch.Index,
+			Error:  mismatch.Err.Error(),
+		})
+	}
+	return result
+}
+
+func inspectTCG(rawLog []byte, bank register.MRBank) (*output, error) {
+	eventLog, err := tcg.ParseEventLog(rawLog, tcg.ParseOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse TCG event log: %v", err)
+	}
+	if len(eventLog.Algs) == 0 {
+		return nil, fmt.Errorf("TCG event log has no digest algorithms")
+	}
+
+	// Every digest algorithm must describe the same events, so that the digests
+	// of a record all belong to the same event.
+	eventsByAlg := make(map[register.HashAlg][]tcg.Event)
+	events := eventLog.Events(eventLog.Algs[0])
+	for _, alg := range eventLog.Algs {
+		algEvents := eventLog.Events(alg)
+		if len(algEvents) != len(events) {
+			return nil, fmt.Errorf("TCG event log has %d %v events, but %d %v events", len(algEvents), alg, len(events), eventLog.Algs[0])
+		}
+		for i, event := range algEvents {
+			if event.Index != events[i].Index || event.Type != events[i].Type {
+				return nil, fmt.Errorf("TCG event %d differs between %v and %v", i, alg, eventLog.Algs[0])
+			}
+		}
+		eventsByAlg[alg] = algEvents
+	}
+
+	out := &output{Type: tcgLogType, Records: []record{}}
+	for i, event := range events {
+		rec := record{
+			RecNum:    uint64(i),
+			IndexType: "PCR",
+			Index:     event.MRIndex(),
+			EventType: event.Type.String(),
+			Digests:   make(map[string]string),
+			Content:   eventData(event.Data),
+		}
+		for _, alg := range eventLog.Algs {
+			if digest := eventsByAlg[alg][i].Digest; digest != nil {
+				rec.Digests[alg.CryptoHash().String()] = hex.EncodeToString(digest)
+			}
+		}
+		out.Records = append(out.Records, rec)
+	}
+
+	if bank != nil {
+		out.Replay = replayTCG(rawLog, eventLog, bank)
+	}
+	return out, nil
+}
+
+func replayTCG(rawLog []byte, eventLog *tcg.EventLog, bank register.MRBank) *replayResult {
+	_, err := tcg.ParseAndReplay(rawLog, bank.MRs(), tcg.ParseOpts{})
+	if err == nil {
+		return &replayResult{OK: true}
+	}
+	cryptoHash, diagErr := bank.CryptoHash()
+	if diagErr != nil {
+		return replayFailure(err, nil, diagErr)
+	}
+	for _, alg := range eventLog.Algs {
+		if alg.CryptoHash() == cryptoHash {
+			report, diagErr := extract.DiagnoseTCGReplay(eventLog.Events(alg), bank)
+			return replayFailure(err, report, diagErr)
+		}
+	}
+	return replayFailure(err, nil, fmt.Errorf("TCG event log has no %v digests", cryptoHash))
+}
+
+// eventData returns printable event data as a string, and hex otherwise.
+func eventData(data []byte) string {
+	text := strings.TrimRight(string(data), "\x00")
+	for _, r := range text {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return hex.EncodeToString(data)
+		}
+	}
+	return text
+}
+
+func printJSON(w io.Writer, out *output) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+func printText(w io.Writer, out *output) error {
+	for _, rec := range out.Records {
+		if _, err := fmt.Fprintf(w, "[%d] %s %d %s\n", rec.RecNum, rec.IndexType, rec.Index, rec.EventType); err != nil {
+			return err
+		}
+		var hashes []string
+		for hashAlgo := range rec.Digests {
+			hashes = append(hashes, hashAlgo)
+		}
+		sort.Strings(hashes)
+		for _, hashAlgo := range hashes {
+			fmt.Fprintf(w, "    %s: %s\n", hashAlgo, rec.Digests[hashAlgo])
+		}
+		if rec.Content != "" {
+			fmt.Fprintf(w, "    content: %s\n", rec.Content)
+		}
+	}
+
+	if out.Replay == nil {
+		return nil
+	}
+	if out.Replay.OK {
+		_, err := fmt.Fprintln(w, "Replay: OK")
+		return err
+	}
+	fmt.Fprintf(w, "Replay: FAILED: %s\n", out.Replay.Error)
+	for _, mr := range out.Replay.MRs {
+		lastConsistent := "none"
+		if mr.LastConsistentRecNum != nil {
+			lastConsistent = fmt.Sprint(*mr.LastConsistentRecNum)
+		}
+		fmt.Fprintf(w, "    MR %d: consistent=%v last consistent record=%s\n        quoted:   %s\n        replayed: %s\n",
+			mr.Index, mr.Consistent, lastConsistent, mr.Quoted, mr.Replayed)
+	}
+	for _, mismatch := range out.Replay.DigestMismatches {
+		fmt.Fprintf(w, "    record %d (MR %d): %s\n", mismatch.RecNum, mismatch.Index, mismatch.Error)
+	}
+	return nil
+}
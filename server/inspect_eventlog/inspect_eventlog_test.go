@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-eventlog/cel"
+	"github.com/google/go-eventlog/proto/state"
+	"github.com/google/go-eventlog/register"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+)
+
+func buildCOSCEL(t *testing.T) ([]byte, register.MRBank) {
+	t.Helper()
+	b, err := coscel.NewBuilder(cel.PCRType)
+	if err != nil {
+		t.Fatalf("NewBuilder() failed: %v", err)
+	}
+	if err := b.AppendImageRef("docker.io/library/hello-world:latest"); err != nil {
+		t.Fatalf("AppendImageRef() failed: %v", err)
+	}
+	if err := b.AppendEnvVar("FOO", "bar"); err != nil {
+		t.Fatalf("AppendEnvVar() failed: %v", err)
+	}
+	if err := b.AppendMemoryMonitor(true); err != nil {
+		t.Fatalf("AppendMemoryMonitor() failed: %v", err)
+	}
+	report := &attestpb.NvidiaAttestationReport{
+		CcFeature: &attestpb.NvidiaAttestationReport_Spt{
+			Spt: &attestpb.NvidiaAttestationReport_SinglePassthroughAttestation{
+				GpuQuote: &attestpb.GpuInfo{Uuid: "GPU-1234", DriverVersion: "550.90.07", VbiosVersion: "96.00.9F.00.01"},
+			},
+		},
+		Nonce: []byte{0xab, 0xcd},
+	}
+	if err := b.AppendGPUDeviceAttestationBinding(report); err != nil {
+		t.Fatalf("AppendGPUDeviceAttestationBinding() failed: %v", err)
+	}
+	if err := b.AppendSeparator(); err != nil {
+		t.Fatalf("AppendSeparator() failed: %v", err)
+	}
+	rawCEL, err := b.EncodeCEL()
+	if err != nil {
+		t.Fatalf("EncodeCEL() failed: %v", err)
+	}
+	bank, err := b.MRBank(crypto.SHA256)
+	if err != nil {
+		t.Fatalf("MRBank() failed: %v", err)
+	}
+	return rawCEL, bank
+}
+
+func TestInspectCOSCEL(t *testing.T) {
+	rawCEL, bank := buildCOSCEL(t)
+
+	out, err := inspect(cosLogType, rawCEL, bank)
+	if err != nil {
+		t.Fatalf("inspect() failed: %v", err)
+	}
+
+	wantEvents := []struct {
+		eventType string
+		content   string
+	}{
+		{"ImageRef", "docker.io/library/hello-world:latest"},
+		{"EnvVar", "FOO=bar"},
+		{"MemoryMonitor", "enabled"},
+		{"GPUDeviceAttestationBinding", "SPT nonce=abcd gpus=[{uuid=GPU-1234"},
+		{"LaunchSeparator", ""},
+	}
+	if len(out.Records) != len(wantEvents) {
+		t.Fatalf("inspect() returned %d records, want %d", len(out.Records), len(wantEvents))
+	}
+	for i, want := range wantEvents {
+		rec := out.Records[i]
+		if rec.EventType != want.eventType {
+			t.Errorf("record %d event type = %q, want %q", i, rec.EventType, want.eventType)
+		}
+		if !strings.HasPrefix(rec.Content, want.content) {
+			t.Errorf("record %d content = %q, want prefix %q", i, rec.Content, want.content)
+		}
+		if rec.IndexType != "PCR" || rec.Index != coscel.EventPCRIndex {
+			t.Errorf("record %d index = %s %d, want PCR %d", i, rec.IndexType, rec.Index, coscel.EventPCRIndex)
+		}
+		if _, ok := rec.Digests[crypto.SHA256.String()]; !ok {
+			t.Errorf("record %d is missing its SHA-256 digest", i)
+		}
+	}
+	if out.Replay == nil || !out.Replay.OK {
+		t.Errorf("inspect() replay = %+v, want OK", out.Replay)
+	}
+}
+
+func TestInspectCOSCELReplayFailure(t *testing.T) {
+	rawCEL, _ := buildCOSCEL(t)
+	badBank := register.PCRBank{
+		TCGHashAlgo: state.HashAlgo_SHA256,
+		PCRs:        []register.PCR{{Index: coscel.EventPCRIndex, Digest: make([]byte, 32), DigestAlg: crypto.SHA256}},
+	}
+
+	out, err := inspect(cosLogType, rawCEL, badBank)
+	if err != nil {
+		t.Fatalf("inspect() failed: %v", err)
+	}
+	if out.Replay == nil || out.Replay.OK {
+		t.Fatalf("inspect() replay = %+v, want failure", out.Replay)
+	}
+	if len(out.Replay.MRs) != 1 || out.Replay.MRs[0].Consistent {
+		t.Errorf("inspect() replay MRs = %+v, want one inconsistent MR", out.Replay.MRs)
+	}
+
+	var buf bytes.Buffer
+	if err := printText(&buf, out); err != nil {
+		t.Fatalf("printText() failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Replay: FAILED") {
+		t.Errorf("printText() = %q, want a replay failure", buf.String())
+	}
+}
+
+func TestInspectHostCEL(t *testing.T) {
+	rawCEL, err := os.ReadFile("../host/testdata/cel_launch_event_log.bin")
+	if err != nil {
+		t.Fatalf("failed to read host CEL: %v", err)
+	}
+
+	out, err := inspect(hostLogType, rawCEL, nil)
+	if err != nil {
+		t.Fatalf("inspect() failed: %v", err)
+	}
+	if len(out.Records) == 0 {
+		t.Fatalf("inspect() returned no records")
+	}
+	if out.Records[0].EventType != "CPUPIID" {
+		t.Errorf("record 0 event type = %q, want CPUPIID", out.Records[0].EventType)
+	}
+	if _, err := hex.DecodeString(out.Records[0].Content); err != nil {
+		t.Errorf("record 0 content %q is not hex: %v", out.Records[0].Content, err)
+	}
+	if out.Replay != nil {
+		t.Errorf("inspect() replay = %+v, want nil without a bank", out.Replay)
+	}
+}
+
+func TestInspectTCG(t *testing.T) {
+	rawLog, err := os.ReadFile("../vm/testdata/cos_101_amd_sev_eventlog.bin")
+	if err != nil {
+		t.Fatalf("failed to read TCG event log: %v", err)
+	}
+
+	bank := register.PCRBank{
+		TCGHashAlgo: state.HashAlgo_SHA256,
+		PCRs:        []register.PCR{{Index: 0, Digest: make([]byte, 32), DigestAlg: crypto.SHA256}},
+	}
+	out, err := inspect(tcgLogType, rawLog, bank)
+	if err != nil {
+		t.Fatalf("inspect() failed: %v", err)
+	}
+	if len(out.Records) == 0 {
+		t.Fatalf("inspect() returned no records")
+	}
+	if out.Records[0].EventType != "S-CRTM Version" {
+		t.Errorf("record 0 event type = %q, want S-CRTM Version", out.Records[0].EventType)
+	}
+	for _, hashAlgo := range []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384} {
+		if _, ok := out.Records[0].Digests[hashAlgo.String()]; !ok {
+			t.Errorf("record 0 is missing its %v digest", hashAlgo)
+		}
+	}
+	if out.Replay == nil || out.Replay.OK {
+		t.Fatalf("inspect() replay = %+v, want failure against a zero PCR0", out.Replay)
+	}
+	if len(out.Replay.MRs) == 0 {
+		t.Fatalf("inspect() replay has no MR diagnostics")
+	}
+	if mr := out.Replay.MRs[0]; mr.Index != 0 || mr.Consistent || mr.LastConsistentRecNum != nil {
+		t.Errorf("inspect() replay MR = %+v, want PCR0 inconsistent with no consistent record", mr)
+	}
+
+	var buf bytes.Buffer
+	if err := printJSON(&buf, out); err != nil {
+		t.Fatalf("printJSON() failed: %v", err)
+	}
+	var decoded output
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("printJSON() output is not valid JSON: %v", err)
+	}
+	if len(decoded.Records) != len(out.Records) {
+		t.Errorf("printJSON() has %d records, want %d", len(decoded.Records), len(out.Records))
+	}
+}
+
+func TestInspectUnknownType(t *testing.T) {
+	if _, err := inspect("acpi", nil, nil); err == nil {
+		t.Errorf("inspect() succeeded on an unknown event log type, want error")
+	}
+}
+
+func TestParseBank(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+	bank, err := parseBank([]byte(`{"hash": "SHA256", "pcrs": {"13": "` + digest + `"}}`))
+	if err != nil {
+		t.Fatalf("parseBank() failed: %v", err)
+	}
+	pcrBank, ok := bank.(register.PCRBank)
+	if !ok {
+		t.Fatalf("parseBank() = %T, want register.PCRBank", bank)
+	}
+	if pcrBank.TCGHashAlgo != state.HashAlgo_SHA256 || len(pcrBank.PCRs) != 1 || pcrBank.PCRs[0].Index != 13 {
+		t.Errorf("parseBank() = %+v, want SHA256 bank with PCR13", pcrBank)
+	}
+
+	bank, err = parseBank([]byte(`{"rtmrs": {"3": "` + strings.Repeat("cd", 48) + `"}}`))
+	if err != nil {
+		t.Fatalf("parseBank() failed: %v", err)
+	}
+	rtmrBank, ok := bank.(register.RTMRBank)
+	if !ok || len(rtmrBank.RTMRs) != 1 || rtmrBank.RTMRs[0].Index != 3 {
+		t.Errorf("parseBank() = %+v, want RTMR bank with RTMR3", bank)
+	}
+
+	for _, tc := range []struct {
+		name string
+		raw  string
+	}{
+		{"empty", `{}`},
+		{"both", `{"hash": "SHA256", "pcrs": {"13": "00"}, "rtmrs": {"3": "00"}}`},
+		{"unknown hash", `{"hash": "MD5", "pcrs": {"13": "00"}}`},
+		{"bad hex", `{"hash": "SHA256", "pcrs": {"13": "zz"}}`},
+		{"bad json", `{`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := parseBank([]byte(tc.raw)); err == nil {
+				t.Errorf("parseBank(%s) succeeded, want error", tc.raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+// Package certtest creates certificate authorities and the certificates they
+// issue, for building fake certificate chains in tests.
+package certtest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+)
+
+// CA is a certificate authority with an ECDSA key.
+type CA struct {
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+}
+
+// NewCA returns a CA with a freshly generated key on the curve, issued by
+// parent from the template, or self-signed if parent is nil. The template's
+// key usage and basic constraints are set for a CA.
+func NewCA(template *x509.Certificate, curve elliptic.Curve, parent *CA) (*CA, error) {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil {
+		parent = &CA{Cert: template, Key: key}
+	}
+	template.KeyUsage = x509.KeyUsageCertSign
+	template.BasicConstraintsValid = true
+	template.IsCA = true
+	cert, err := parent.Issue(template, key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &CA{Cert: cert, Key: key}, nil
+}
+
+// Issue returns a certificate for pub, issued by the CA from the template.
+func (ca *CA) Issue(template *x509.Certificate, pub crypto.PublicKey) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, pub, ca.Key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
@@ -0,0 +1,44 @@
+// Package signedquote converts the signed TPM quotes of attestations for
+// verification, shared by the vm and host attestation paths.
+package signedquote
+
+import (
+	"github.com/google/go-eventlog/proto/state"
+	"github.com/google/go-eventlog/register"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+	tpmpb "github.com/google/go-tpm-tools/proto/tpm"
+)
+
+// PCRBank returns the quoted PCR values as a PCR bank to replay event logs
+// against. The quote signature must be verified first.
+func PCRBank(quote *attestpb.TpmQuote_SignedQuote) (register.PCRBank, error) {
+	tcgHash := state.HashAlgo(quote.GetHashAlgorithm())
+	cryptoHashAlg, err := tcgHash.CryptoHash()
+	if err != nil {
+		return register.PCRBank{}, err
+	}
+
+	pcrRegs := make([]register.PCR, 0)
+	for pcrIndex, digest := range quote.GetPcrValues() {
+		pcrRegs = append(pcrRegs, register.PCR{
+			Index:     int(pcrIndex),
+			Digest:    digest,
+			DigestAlg: cryptoHashAlg,
+		})
+	}
+
+	return register.PCRBank{TCGHashAlgo: tcgHash, PCRs: pcrRegs}, nil
+}
+
+// ToProto returns the quote in the form go-tpm-tools verifies.
+func ToProto(quote *attestpb.TpmQuote_SignedQuote) *tpmpb.Quote {
+	return &tpmpb.Quote{
+		Quote:  quote.GetTpmsAttest(),
+		RawSig: quote.GetTpmtSignature(),
+		Pcrs: &tpmpb.PCRs{
+			Hash: tpmpb.HashAlgo(quote.GetHashAlgorithm()),
+			Pcrs: quote.GetPcrValues(),
+		},
+	}
+}
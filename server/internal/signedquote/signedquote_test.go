@@ -0,0 +1,59 @@
+package signedquote
+
+import (
+	"crypto"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-eventlog/proto/state"
+	"github.com/google/go-tpm/tpm2"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+	tpmpb "github.com/google/go-tpm-tools/proto/tpm"
+)
+
+func TestPCRBank(t *testing.T) {
+	quote := &attestpb.TpmQuote_SignedQuote{
+		HashAlgorithm: uint32(tpm2.TPMAlgSHA256),
+		PcrValues:     map[uint32][]byte{0: {0x01}, 13: {0x0d}},
+	}
+	got, err := PCRBank(quote)
+	if err != nil {
+		t.Fatalf("PCRBank() failed: %v", err)
+	}
+	if got.TCGHashAlgo != state.HashAlgo_SHA256 {
+		t.Errorf("PCRBank() hash algorithm = %v, want SHA256", got.TCGHashAlgo)
+	}
+	gotPCRs := make(map[int][]byte)
+	for _, pcr := range got.PCRs {
+		if pcr.DigestAlg != crypto.SHA256 {
+			t.Errorf("PCR %d digest algorithm = %v, want SHA-256", pcr.Index, pcr.DigestAlg)
+		}
+		gotPCRs[pcr.Index] = pcr.Digest
+	}
+	if diff := cmp.Diff(map[int][]byte{0: {0x01}, 13: {0x0d}}, gotPCRs); diff != "" {
+		t.Errorf("PCRBank() PCRs mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := PCRBank(&attestpb.TpmQuote_SignedQuote{HashAlgorithm: 0xFFFF}); err == nil {
+		t.Errorf("PCRBank() with an unknown hash algorithm succeeded, want error")
+	}
+}
+
+func TestToProto(t *testing.T) {
+	quote := &attestpb.TpmQuote_SignedQuote{
+		HashAlgorithm: uint32(tpm2.TPMAlgSHA1),
+		PcrValues:     map[uint32][]byte{7: {0x07}},
+		TpmsAttest:    []byte("attest"),
+		TpmtSignature: []byte("signature"),
+	}
+	want := &tpmpb.Quote{
+		Quote:  []byte("attest"),
+		RawSig: []byte("signature"),
+		Pcrs:   &tpmpb.PCRs{Hash: tpmpb.HashAlgo_SHA1, Pcrs: map[uint32][]byte{7: {0x07}}},
+	}
+	if diff := cmp.Diff(want, ToProto(quote), protocmp.Transform()); diff != "" {
+		t.Errorf("ToProto() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -153,6 +153,8 @@ type ImageDatabase struct {
 	CsBasePolicy *ImageDatabase_ConfidentialSpaceBasePolicy `protobuf:"bytes,6,opt,name=cs_base_policy,json=csBasePolicy,proto3" json:"cs_base_policy,omitempty"`
 	// Map of known certificates to their DER encoded form.
 	KnownCerts map[string][]byte `protobuf:"bytes,7,rep,name=known_certs,json=knownCerts,proto3" json:"known_certs,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// ACPI reference values of the supported machine shapes.
+	AcpiReferenceValues []*ImageDatabase_AcpiReferenceEntry `protobuf:"bytes,8,rep,name=acpi_reference_values,json=acpiReferenceValues,proto3" json:"acpi_reference_values,omitempty"`
 }
 
 func (x *ImageDatabase) Reset() {
@@ -222,6 +224,13 @@ func (x *ImageDatabase) GetKnownCerts() map[string][]byte {
 	return nil
 }
 
+func (x *ImageDatabase) GetAcpiReferenceValues() []*ImageDatabase_AcpiReferenceEntry {
+	if x != nil {
+		return x.AcpiReferenceValues
+	}
+	return nil
+}
+
 // Represents values associated with a Confidential Space Image
 type ImageDatabase_ImageGoldenEntry struct {
 	state         protoimpl.MessageState
@@ -535,6 +544,150 @@ func (x *ImageDatabase_ConfidentialSpaceBasePolicy) GetFirmwarePolicy() *attest.
 	return nil
 }
 
+// A set of ACPI tables a host supplies to a VM.
+type ImageDatabase_AcpiTableSet struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Hex-encoded SHA-384 digests of the tables of the AcpiData tables blob,
+	// in blob order.
+	TableDigests []string `protobuf:"bytes,1,rep,name=table_digests,json=tableDigests,proto3" json:"table_digests,omitempty"`
+}
+
+func (x *ImageDatabase_AcpiTableSet) Reset() {
+	*x = ImageDatabase_AcpiTableSet{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_image_database_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ImageDatabase_AcpiTableSet) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImageDatabase_AcpiTableSet) ProtoMessage() {}
+
+func (x *ImageDatabase_AcpiTableSet) ProtoReflect() protoreflect.Message {
+	mi := &file_image_database_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImageDatabase_AcpiTableSet.ProtoReflect.Descriptor instead.
+func (*ImageDatabase_AcpiTableSet) Descriptor() ([]byte, []int) {
+	return file_image_database_proto_rawDescGZIP(), []int{0, 5}
+}
+
+func (x *ImageDatabase_AcpiTableSet) GetTableDigests() []string {
+	if x != nil {
+		return x.TableDigests
+	}
+	return nil
+}
+
+// Represents the ACPI data a host supplies to VMs of a machine shape.
+type ImageDatabase_AcpiReferenceEntry struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The GCE machine type, e.g. c3-standard-4.
+	MachineType string `protobuf:"bytes,1,opt,name=machine_type,json=machineType,proto3" json:"machine_type,omitempty"`
+	VcpuCount   uint32 `protobuf:"varint,2,opt,name=vcpu_count,json=vcpuCount,proto3" json:"vcpu_count,omitempty"`
+	MemoryMb    uint64 `protobuf:"varint,3,opt,name=memory_mb,json=memoryMb,proto3" json:"memory_mb,omitempty"`
+	// Hex-encoded SHA-384 digests of the tables a host may supply. If not
+	// empty, every table of the AcpiData tables blob must be listed.
+	AllowedTableDigests []string `protobuf:"bytes,4,rep,name=allowed_table_digests,json=allowedTableDigests,proto3" json:"allowed_table_digests,omitempty"`
+	// If not empty, the AcpiData tables must exactly match one of the sets.
+	AllowedTableSets []*ImageDatabase_AcpiTableSet `protobuf:"bytes,5,rep,name=allowed_table_sets,json=allowedTableSets,proto3" json:"allowed_table_sets,omitempty"`
+	// Hex-encoded SHA-384 digests of the table loader scripts a host may
+	// supply. If empty, any table loader is allowed.
+	AllowedTableLoaderDigests []string `protobuf:"bytes,6,rep,name=allowed_table_loader_digests,json=allowedTableLoaderDigests,proto3" json:"allowed_table_loader_digests,omitempty"`
+}
+
+func (x *ImageDatabase_AcpiReferenceEntry) Reset() {
+	*x = ImageDatabase_AcpiReferenceEntry{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_image_database_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ImageDatabase_AcpiReferenceEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImageDatabase_AcpiReferenceEntry) ProtoMessage() {}
+
+func (x *ImageDatabase_AcpiReferenceEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_image_database_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImageDatabase_AcpiReferenceEntry.ProtoReflect.Descriptor instead.
+func (*ImageDatabase_AcpiReferenceEntry) Descriptor() ([]byte, []int) {
+	return file_image_database_proto_rawDescGZIP(), []int{0, 6}
+}
+
+func (x *ImageDatabase_AcpiReferenceEntry) GetMachineType() string {
+	if x != nil {
+		return x.MachineType
+	}
+	return ""
+}
+
+func (x *ImageDatabase_AcpiReferenceEntry) GetVcpuCount() uint32 {
+	if x != nil {
+		return x.VcpuCount
+	}
+	return 0
+}
+
+func (x *ImageDatabase_AcpiReferenceEntry) GetMemoryMb() uint64 {
+	if x != nil {
+		return x.MemoryMb
+	}
+	return 0
+}
+
+func (x *ImageDatabase_AcpiReferenceEntry) GetAllowedTableDigests() []string {
+	if x != nil {
+		return x.AllowedTableDigests
+	}
+	return nil
+}
+
+func (x *ImageDatabase_AcpiReferenceEntry) GetAllowedTableSets() []*ImageDatabase_AcpiTableSet {
+	if x != nil {
+		return x.AllowedTableSets
+	}
+	return nil
+}
+
+func (x *ImageDatabase_AcpiReferenceEntry) GetAllowedTableLoaderDigests() []string {
+	if x != nil {
+		return x.AllowedTableLoaderDigests
+	}
+	return nil
+}
+
 var File_image_database_proto protoreflect.FileDescriptor
 
 var file_image_database_proto_rawDesc = []byte{
@@ -543,7 +696,7 @@ var file_image_database_proto_rawDesc = []byte{
 	0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70,
 	0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d,
 	0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x12, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x61,
-	0x74, 0x74, 0x65, 0x73, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xdc, 0x0f, 0x0a, 0x0d,
+	0x74, 0x74, 0x65, 0x73, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xbc, 0x13, 0x0a, 0x0d,
 	0x49, 0x6d, 0x61, 0x67, 0x65, 0x44, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x12, 0x54, 0x0a,
 	0x0d, 0x67, 0x6f, 0x6c, 0x64, 0x65, 0x6e, 0x5f, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x18, 0x01,
 	0x20, 0x03, 0x28, 0x0b, 0x32, 0x2f, 0x2e, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x64, 0x61, 0x74,
@@ -573,67 +726,97 @@ var file_image_database_proto_rawDesc = []byte{
 	0x67, 0x65, 0x5f, 0x64, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x49, 0x6d, 0x61, 0x67,
 	0x65, 0x44, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x4b, 0x6e, 0x6f, 0x77, 0x6e, 0x43,
 	0x65, 0x72, 0x74, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x0a, 0x6b, 0x6e, 0x6f, 0x77, 0x6e,
-	0x43, 0x65, 0x72, 0x74, 0x73, 0x1a, 0xcd, 0x02, 0x0a, 0x10, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x47,
-	0x6f, 0x6c, 0x64, 0x65, 0x6e, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x2c, 0x0a, 0x12, 0x69, 0x6d,
-	0x61, 0x67, 0x65, 0x5f, 0x72, 0x65, 0x6c, 0x65, 0x61, 0x73, 0x65, 0x5f, 0x6e, 0x61, 0x6d, 0x65,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x52, 0x65, 0x6c,
-	0x65, 0x61, 0x73, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x69, 0x73, 0x5f, 0x68,
-	0x61, 0x72, 0x64, 0x65, 0x6e, 0x65, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x69,
-	0x73, 0x48, 0x61, 0x72, 0x64, 0x65, 0x6e, 0x65, 0x64, 0x12, 0x2c, 0x0a, 0x12, 0x69, 0x6d, 0x61,
-	0x67, 0x65, 0x5f, 0x62, 0x61, 0x73, 0x65, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18,
-	0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x10, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x42, 0x61, 0x73, 0x65,
-	0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x1c, 0x0a, 0x09, 0x73, 0x77, 0x76, 0x65, 0x72,
-	0x73, 0x69, 0x6f, 0x6e, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x09, 0x73, 0x77, 0x76, 0x65,
-	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x57, 0x0a, 0x10, 0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75,
-	0x74, 0x65, 0x5f, 0x6c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x18, 0x09, 0x20, 0x03, 0x28, 0x0e, 0x32,
-	0x2c, 0x2e, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x64, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65,
-	0x2e, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x44, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x41,
-	0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x65, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x52, 0x0f, 0x61,
-	0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x65, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x12, 0x1e,
-	0x0a, 0x0a, 0x64, 0x65, 0x70, 0x72, 0x65, 0x63, 0x61, 0x74, 0x65, 0x64, 0x18, 0x07, 0x20, 0x01,
-	0x28, 0x08, 0x52, 0x0a, 0x64, 0x65, 0x70, 0x72, 0x65, 0x63, 0x61, 0x74, 0x65, 0x64, 0x4a, 0x04,
-	0x08, 0x03, 0x10, 0x04, 0x4a, 0x04, 0x08, 0x04, 0x10, 0x05, 0x52, 0x0c, 0x67, 0x72, 0x75, 0x62,
-	0x5f, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74, 0x73, 0x52, 0x0b, 0x65, 0x66, 0x69, 0x5f, 0x64, 0x69,
-	0x67, 0x65, 0x73, 0x74, 0x73, 0x1a, 0xc8, 0x01, 0x0a, 0x0a, 0x43, 0x43, 0x44, 0x61, 0x74, 0x61,
-	0x62, 0x61, 0x73, 0x65, 0x12, 0x64, 0x0a, 0x12, 0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x5f, 0x63, 0x65,
-	0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0e,
-	0x32, 0x31, 0x2e, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x64, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73,
+	0x43, 0x65, 0x72, 0x74, 0x73, 0x12, 0x64, 0x0a, 0x15, 0x61, 0x63, 0x70, 0x69, 0x5f, 0x72, 0x65,
+	0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x5f, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x18, 0x08,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x30, 0x2e, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x64, 0x61, 0x74,
+	0x61, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x44, 0x61, 0x74, 0x61, 0x62,
+	0x61, 0x73, 0x65, 0x2e, 0x41, 0x63, 0x70, 0x69, 0x52, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63,
+	0x65, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x13, 0x61, 0x63, 0x70, 0x69, 0x52, 0x65, 0x66, 0x65,
+	0x72, 0x65, 0x6e, 0x63, 0x65, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x1a, 0xcd, 0x02, 0x0a, 0x10,
+	0x49, 0x6d, 0x61, 0x67, 0x65, 0x47, 0x6f, 0x6c, 0x64, 0x65, 0x6e, 0x45, 0x6e, 0x74, 0x72, 0x79,
+	0x12, 0x2c, 0x0a, 0x12, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x72, 0x65, 0x6c, 0x65, 0x61, 0x73,
+	0x65, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x69, 0x6d,
+	0x61, 0x67, 0x65, 0x52, 0x65, 0x6c, 0x65, 0x61, 0x73, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x1f,
+	0x0a, 0x0b, 0x69, 0x73, 0x5f, 0x68, 0x61, 0x72, 0x64, 0x65, 0x6e, 0x65, 0x64, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x08, 0x52, 0x0a, 0x69, 0x73, 0x48, 0x61, 0x72, 0x64, 0x65, 0x6e, 0x65, 0x64, 0x12,
+	0x2c, 0x0a, 0x12, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x62, 0x61, 0x73, 0x65, 0x5f, 0x76, 0x65,
+	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x10, 0x69, 0x6d, 0x61,
+	0x67, 0x65, 0x42, 0x61, 0x73, 0x65, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x1c, 0x0a,
+	0x09, 0x73, 0x77, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x09, 0x73, 0x77, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x57, 0x0a, 0x10, 0x61,
+	0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x65, 0x5f, 0x6c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x18,
+	0x09, 0x20, 0x03, 0x28, 0x0e, 0x32, 0x2c, 0x2e, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x64, 0x61,
+	0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x44, 0x61, 0x74, 0x61,
+	0x62, 0x61, 0x73, 0x65, 0x2e, 0x41, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x65, 0x4c, 0x61,
+	0x62, 0x65, 0x6c, 0x52, 0x0f, 0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x65, 0x4c, 0x61,
+	0x62, 0x65, 0x6c, 0x73, 0x12, 0x1e, 0x0a, 0x0a, 0x64, 0x65, 0x70, 0x72, 0x65, 0x63, 0x61, 0x74,
+	0x65, 0x64, 0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x64, 0x65, 0x70, 0x72, 0x65, 0x63,
+	0x61, 0x74, 0x65, 0x64, 0x4a, 0x04, 0x08, 0x03, 0x10, 0x04, 0x4a, 0x04, 0x08, 0x04, 0x10, 0x05,
+	0x52, 0x0c, 0x67, 0x72, 0x75, 0x62, 0x5f, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74, 0x73, 0x52, 0x0b,
+	0x65, 0x66, 0x69, 0x5f, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74, 0x73, 0x1a, 0xc8, 0x01, 0x0a, 0x0a,
+	0x43, 0x43, 0x44, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x12, 0x64, 0x0a, 0x12, 0x6b, 0x6e,
+	0x6f, 0x77, 0x6e, 0x5f, 0x63, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x65, 0x73,
+	0x18, 0x01, 0x20, 0x03, 0x28, 0x0e, 0x32, 0x31, 0x2e, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x64,
+	0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x44, 0x61, 0x74,
+	0x61, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x43, 0x43, 0x4b, 0x6e, 0x6f, 0x77, 0x6e, 0x43, 0x65, 0x72,
+	0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x65, 0x73, 0x42, 0x02, 0x10, 0x00, 0x52, 0x11, 0x6b,
+	0x6e, 0x6f, 0x77, 0x6e, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x65, 0x73,
+	0x12, 0x3a, 0x0a, 0x17, 0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x5f, 0x63, 0x65, 0x72, 0x74, 0x5f, 0x66,
+	0x69, 0x6e, 0x67, 0x65, 0x72, 0x70, 0x72, 0x69, 0x6e, 0x74, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28,
+	0x09, 0x42, 0x02, 0x10, 0x00, 0x52, 0x15, 0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x43, 0x65, 0x72, 0x74,
+	0x46, 0x69, 0x6e, 0x67, 0x65, 0x72, 0x70, 0x72, 0x69, 0x6e, 0x74, 0x73, 0x12, 0x18, 0x0a, 0x07,
+	0x64, 0x69, 0x67, 0x65, 0x73, 0x74, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x64,
+	0x69, 0x67, 0x65, 0x73, 0x74, 0x73, 0x1a, 0xce, 0x01, 0x0a, 0x0e, 0x49, 0x6d, 0x61, 0x67, 0x65,
+	0x42, 0x61, 0x73, 0x65, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x38, 0x0a, 0x02, 0x64, 0x62, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x28, 0x2e, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x64, 0x61,
+	0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x44, 0x61, 0x74, 0x61,
+	0x62, 0x61, 0x73, 0x65, 0x2e, 0x43, 0x43, 0x44, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x52,
+	0x02, 0x64, 0x62, 0x12, 0x3a, 0x0a, 0x03, 0x64, 0x62, 0x78, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x28, 0x2e, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x64, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73,
 	0x65, 0x2e, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x44, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x2e,
-	0x43, 0x43, 0x4b, 0x6e, 0x6f, 0x77, 0x6e, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61,
-	0x74, 0x65, 0x73, 0x42, 0x02, 0x10, 0x00, 0x52, 0x11, 0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x43, 0x65,
-	0x72, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x65, 0x73, 0x12, 0x3a, 0x0a, 0x17, 0x6b, 0x6e,
-	0x6f, 0x77, 0x6e, 0x5f, 0x63, 0x65, 0x72, 0x74, 0x5f, 0x66, 0x69, 0x6e, 0x67, 0x65, 0x72, 0x70,
-	0x72, 0x69, 0x6e, 0x74, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x42, 0x02, 0x10, 0x00, 0x52,
-	0x15, 0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x43, 0x65, 0x72, 0x74, 0x46, 0x69, 0x6e, 0x67, 0x65, 0x72,
-	0x70, 0x72, 0x69, 0x6e, 0x74, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74,
-	0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74, 0x73,
-	0x1a, 0xce, 0x01, 0x0a, 0x0e, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x42, 0x61, 0x73, 0x65, 0x45, 0x6e,
-	0x74, 0x72, 0x79, 0x12, 0x38, 0x0a, 0x02, 0x64, 0x62, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32,
-	0x28, 0x2e, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x64, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65,
-	0x2e, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x44, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x43,
-	0x43, 0x44, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x52, 0x02, 0x64, 0x62, 0x12, 0x3a, 0x0a,
-	0x03, 0x64, 0x62, 0x78, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x28, 0x2e, 0x69, 0x6d, 0x61,
-	0x67, 0x65, 0x5f, 0x64, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x49, 0x6d, 0x61, 0x67,
-	0x65, 0x44, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x43, 0x43, 0x44, 0x61, 0x74, 0x61,
-	0x62, 0x61, 0x73, 0x65, 0x52, 0x03, 0x64, 0x62, 0x78, 0x12, 0x46, 0x0a, 0x09, 0x61, 0x75, 0x74,
-	0x68, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x28, 0x2e, 0x69,
-	0x6d, 0x61, 0x67, 0x65, 0x5f, 0x64, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x49, 0x6d,
-	0x61, 0x67, 0x65, 0x44, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x43, 0x43, 0x44, 0x61,
-	0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x52, 0x09, 0x61, 0x75, 0x74, 0x68, 0x6f, 0x72, 0x69, 0x74,
-	0x79, 0x1a, 0x7f, 0x0a, 0x11, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x42, 0x61, 0x73, 0x65,
-	0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x53, 0x0a, 0x18, 0x65, 0x61, 0x72, 0x6c, 0x69, 0x65,
-	0x73, 0x74, 0x5f, 0x63, 0x65, 0x72, 0x74, 0x5f, 0x69, 0x73, 0x73, 0x75, 0x65, 0x5f, 0x74, 0x69,
-	0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
-	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73,
-	0x74, 0x61, 0x6d, 0x70, 0x52, 0x15, 0x65, 0x61, 0x72, 0x6c, 0x69, 0x65, 0x73, 0x74, 0x43, 0x65,
-	0x72, 0x74, 0x49, 0x73, 0x73, 0x75, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x4a, 0x04, 0x08, 0x02, 0x10,
-	0x03, 0x52, 0x0f, 0x66, 0x69, 0x72, 0x6d, 0x77, 0x61, 0x72, 0x65, 0x5f, 0x70, 0x6f, 0x6c, 0x69,
-	0x63, 0x79, 0x1a, 0x56, 0x0a, 0x1b, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x64, 0x65, 0x6e, 0x74, 0x69,
-	0x61, 0x6c, 0x53, 0x70, 0x61, 0x63, 0x65, 0x42, 0x61, 0x73, 0x65, 0x50, 0x6f, 0x6c, 0x69, 0x63,
-	0x79, 0x12, 0x37, 0x0a, 0x0f, 0x66, 0x69, 0x72, 0x6d, 0x77, 0x61, 0x72, 0x65, 0x5f, 0x70, 0x6f,
-	0x6c, 0x69, 0x63, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x61, 0x74, 0x74,
-	0x65, 0x73, 0x74, 0x2e, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x52, 0x0e, 0x66, 0x69, 0x72, 0x6d,
-	0x77, 0x61, 0x72, 0x65, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x1a, 0x6f, 0x0a, 0x11, 0x47, 0x6f,
+	0x43, 0x43, 0x44, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x52, 0x03, 0x64, 0x62, 0x78, 0x12,
+	0x46, 0x0a, 0x09, 0x61, 0x75, 0x74, 0x68, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x28, 0x2e, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x64, 0x61, 0x74, 0x61, 0x62,
+	0x61, 0x73, 0x65, 0x2e, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x44, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73,
+	0x65, 0x2e, 0x43, 0x43, 0x44, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x52, 0x09, 0x61, 0x75,
+	0x74, 0x68, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x1a, 0x7f, 0x0a, 0x11, 0x53, 0x65, 0x72, 0x76, 0x69,
+	0x63, 0x65, 0x42, 0x61, 0x73, 0x65, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x53, 0x0a, 0x18,
+	0x65, 0x61, 0x72, 0x6c, 0x69, 0x65, 0x73, 0x74, 0x5f, 0x63, 0x65, 0x72, 0x74, 0x5f, 0x69, 0x73,
+	0x73, 0x75, 0x65, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a,
+	0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x15, 0x65, 0x61, 0x72, 0x6c,
+	0x69, 0x65, 0x73, 0x74, 0x43, 0x65, 0x72, 0x74, 0x49, 0x73, 0x73, 0x75, 0x65, 0x54, 0x69, 0x6d,
+	0x65, 0x4a, 0x04, 0x08, 0x02, 0x10, 0x03, 0x52, 0x0f, 0x66, 0x69, 0x72, 0x6d, 0x77, 0x61, 0x72,
+	0x65, 0x5f, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x1a, 0x56, 0x0a, 0x1b, 0x43, 0x6f, 0x6e, 0x66,
+	0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x61, 0x6c, 0x53, 0x70, 0x61, 0x63, 0x65, 0x42, 0x61, 0x73,
+	0x65, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x37, 0x0a, 0x0f, 0x66, 0x69, 0x72, 0x6d, 0x77,
+	0x61, 0x72, 0x65, 0x5f, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x0e, 0x2e, 0x61, 0x74, 0x74, 0x65, 0x73, 0x74, 0x2e, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79,
+	0x52, 0x0e, 0x66, 0x69, 0x72, 0x6d, 0x77, 0x61, 0x72, 0x65, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79,
+	0x1a, 0x33, 0x0a, 0x0c, 0x41, 0x63, 0x70, 0x69, 0x54, 0x61, 0x62, 0x6c, 0x65, 0x53, 0x65, 0x74,
+	0x12, 0x23, 0x0a, 0x0d, 0x74, 0x61, 0x62, 0x6c, 0x65, 0x5f, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74,
+	0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0c, 0x74, 0x61, 0x62, 0x6c, 0x65, 0x44, 0x69,
+	0x67, 0x65, 0x73, 0x74, 0x73, 0x1a, 0xc2, 0x02, 0x0a, 0x12, 0x41, 0x63, 0x70, 0x69, 0x52, 0x65,
+	0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x21, 0x0a, 0x0c,
+	0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e, 0x65, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0b, 0x6d, 0x61, 0x63, 0x68, 0x69, 0x6e, 0x65, 0x54, 0x79, 0x70, 0x65, 0x12,
+	0x1d, 0x0a, 0x0a, 0x76, 0x63, 0x70, 0x75, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x09, 0x76, 0x63, 0x70, 0x75, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x1b,
+	0x0a, 0x09, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x5f, 0x6d, 0x62, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x08, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x4d, 0x62, 0x12, 0x32, 0x0a, 0x15, 0x61,
+	0x6c, 0x6c, 0x6f, 0x77, 0x65, 0x64, 0x5f, 0x74, 0x61, 0x62, 0x6c, 0x65, 0x5f, 0x64, 0x69, 0x67,
+	0x65, 0x73, 0x74, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x09, 0x52, 0x13, 0x61, 0x6c, 0x6c, 0x6f,
+	0x77, 0x65, 0x64, 0x54, 0x61, 0x62, 0x6c, 0x65, 0x44, 0x69, 0x67, 0x65, 0x73, 0x74, 0x73, 0x12,
+	0x58, 0x0a, 0x12, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x65, 0x64, 0x5f, 0x74, 0x61, 0x62, 0x6c, 0x65,
+	0x5f, 0x73, 0x65, 0x74, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x2a, 0x2e, 0x69, 0x6d,
+	0x61, 0x67, 0x65, 0x5f, 0x64, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x49, 0x6d, 0x61,
+	0x67, 0x65, 0x44, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x41, 0x63, 0x70, 0x69, 0x54,
+	0x61, 0x62, 0x6c, 0x65, 0x53, 0x65, 0x74, 0x52, 0x10, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x65, 0x64,
+	0x54, 0x61, 0x62, 0x6c, 0x65, 0x53, 0x65, 0x74, 0x73, 0x12, 0x3f, 0x0a, 0x1c, 0x61, 0x6c, 0x6c,
+	0x6f, 0x77, 0x65, 0x64, 0x5f, 0x74, 0x61, 0x62, 0x6c, 0x65, 0x5f, 0x6c, 0x6f, 0x61, 0x64, 0x65,
+	0x72, 0x5f, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x09, 0x52,
+	0x19, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x65, 0x64, 0x54, 0x61, 0x62, 0x6c, 0x65, 0x4c, 0x6f, 0x61,
+	0x64, 0x65, 0x72, 0x44, 0x69, 0x67, 0x65, 0x73, 0x74, 0x73, 0x1a, 0x6f, 0x0a, 0x11, 0x47, 0x6f,
 	0x6c, 0x64, 0x65, 0x6e, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12,
 	0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65,
 	0x79, 0x12, 0x44, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b,
@@ -691,7 +874,7 @@ func file_image_database_proto_rawDescGZIP() []byte {
 }
 
 var file_image_database_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
-var file_image_database_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_image_database_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
 var file_image_database_proto_goTypes = []interface{}{
 	(ImageDatabase_AttributeLabel)(0),                 // 0: image_database.ImageDatabase.AttributeLabel
 	(ImageDatabase_CCKnownCertificates)(0),            // 1: image_database.ImageDatabase.CCKnownCertificates
@@ -701,32 +884,36 @@ var file_image_database_proto_goTypes = []interface{}{
 	(*ImageDatabase_ImageBaseEntry)(nil),              // 5: image_database.ImageDatabase.ImageBaseEntry
 	(*ImageDatabase_ServiceBasePolicy)(nil),           // 6: image_database.ImageDatabase.ServiceBasePolicy
 	(*ImageDatabase_ConfidentialSpaceBasePolicy)(nil), // 7: image_database.ImageDatabase.ConfidentialSpaceBasePolicy
-	nil,                           // 8: image_database.ImageDatabase.GoldenValuesEntry
-	nil,                           // 9: image_database.ImageDatabase.ImageBaseValuesEntry
-	nil,                           // 10: image_database.ImageDatabase.KnownCertsEntry
-	(*timestamppb.Timestamp)(nil), // 11: google.protobuf.Timestamp
-	(*attest.Policy)(nil),         // 12: attest.Policy
+	(*ImageDatabase_AcpiTableSet)(nil),                // 8: image_database.ImageDatabase.AcpiTableSet
+	(*ImageDatabase_AcpiReferenceEntry)(nil),          // 9: image_database.ImageDatabase.AcpiReferenceEntry
+	nil,                                               // 10: image_database.ImageDatabase.GoldenValuesEntry
+	nil,                                               // 11: image_database.ImageDatabase.ImageBaseValuesEntry
+	nil,                                               // 12: image_database.ImageDatabase.KnownCertsEntry
+	(*timestamppb.Timestamp)(nil),                     // 13: google.protobuf.Timestamp
+	(*attest.Policy)(nil),                             // 14: attest.Policy
 }
 var file_image_database_proto_depIdxs = []int32{
-	8,  // 0: image_database.ImageDatabase.golden_values:type_name -> image_database.ImageDatabase.GoldenValuesEntry
-	9,  // 1: image_database.ImageDatabase.image_base_values:type_name -> image_database.ImageDatabase.ImageBaseValuesEntry
+	10, // 0: image_database.ImageDatabase.golden_values:type_name -> image_database.ImageDatabase.GoldenValuesEntry
+	11, // 1: image_database.ImageDatabase.image_base_values:type_name -> image_database.ImageDatabase.ImageBaseValuesEntry
 	6,  // 2: image_database.ImageDatabase.service_base_policy:type_name -> image_database.ImageDatabase.ServiceBasePolicy
 	7,  // 3: image_database.ImageDatabase.cs_base_policy:type_name -> image_database.ImageDatabase.ConfidentialSpaceBasePolicy
-	10, // 4: image_database.ImageDatabase.known_certs:type_name -> image_database.ImageDatabase.KnownCertsEntry
-	0,  // 5: image_database.ImageDatabase.ImageGoldenEntry.attribute_labels:type_name -> image_database.ImageDatabase.AttributeLabel
-	1,  // 6: image_database.ImageDatabase.CCDatabase.known_certificates:type_name -> image_database.ImageDatabase.CCKnownCertificates
-	4,  // 7: image_database.ImageDatabase.ImageBaseEntry.db:type_name -> image_database.ImageDatabase.CCDatabase
-	4,  // 8: image_database.ImageDatabase.ImageBaseEntry.dbx:type_name -> image_database.ImageDatabase.CCDatabase
-	4,  // 9: image_database.ImageDatabase.ImageBaseEntry.authority:type_name -> image_database.ImageDatabase.CCDatabase
-	11, // 10: image_database.ImageDatabase.ServiceBasePolicy.earliest_cert_issue_time:type_name -> google.protobuf.Timestamp
-	12, // 11: image_database.ImageDatabase.ConfidentialSpaceBasePolicy.firmware_policy:type_name -> attest.Policy
-	3,  // 12: image_database.ImageDatabase.GoldenValuesEntry.value:type_name -> image_database.ImageDatabase.ImageGoldenEntry
-	5,  // 13: image_database.ImageDatabase.ImageBaseValuesEntry.value:type_name -> image_database.ImageDatabase.ImageBaseEntry
-	14, // [14:14] is the sub-list for method output_type
-	14, // [14:14] is the sub-list for method input_type
-	14, // [14:14] is the sub-list for extension type_name
-	14, // [14:14] is the sub-list for extension extendee
-	0,  // [0:14] is the sub-list for field type_name
+	12, // 4: image_database.ImageDatabase.known_certs:type_name -> image_database.ImageDatabase.KnownCertsEntry
+	9,  // 5: image_database.ImageDatabase.acpi_reference_values:type_name -> image_database.ImageDatabase.AcpiReferenceEntry
+	0,  // 6: image_database.ImageDatabase.ImageGoldenEntry.attribute_labels:type_name -> image_database.ImageDatabase.AttributeLabel
+	1,  // 7: image_database.ImageDatabase.CCDatabase.known_certificates:type_name -> image_database.ImageDatabase.CCKnownCertificates
+	4,  // 8: image_database.ImageDatabase.ImageBaseEntry.db:type_name -> image_database.ImageDatabase.CCDatabase
+	4,  // 9: image_database.ImageDatabase.ImageBaseEntry.dbx:type_name -> image_database.ImageDatabase.CCDatabase
+	4,  // 10: image_database.ImageDatabase.ImageBaseEntry.authority:type_name -> image_database.ImageDatabase.CCDatabase
+	13, // 11: image_database.ImageDatabase.ServiceBasePolicy.earliest_cert_issue_time:type_name -> google.protobuf.Timestamp
+	14, // 12: image_database.ImageDatabase.ConfidentialSpaceBasePolicy.firmware_policy:type_name -> attest.Policy
+	8,  // 13: image_database.ImageDatabase.AcpiReferenceEntry.allowed_table_sets:type_name -> image_database.ImageDatabase.AcpiTableSet
+	3,  // 14: image_database.ImageDatabase.GoldenValuesEntry.value:type_name -> image_database.ImageDatabase.ImageGoldenEntry
+	5,  // 15: image_database.ImageDatabase.ImageBaseValuesEntry.value:type_name -> image_database.ImageDatabase.ImageBaseEntry
+	16, // [16:16] is the sub-list for method output_type
+	16, // [16:16] is the sub-list for method input_type
+	16, // [16:16] is the sub-list for extension type_name
+	16, // [16:16] is the sub-list for extension extendee
+	0,  // [0:16] is the sub-list for field type_name
 }
 
 func init() { file_image_database_proto_init() }
@@ -807,6 +994,30 @@ func file_image_database_proto_init() {
 				return nil
 			}
 		}
+		file_image_database_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ImageDatabase_AcpiTableSet); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_image_database_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ImageDatabase_AcpiReferenceEntry); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -814,7 +1025,7 @@ func file_image_database_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_image_database_proto_rawDesc,
 			NumEnums:      2,
-			NumMessages:   9,
+			NumMessages:   11,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,179 @@
+// Package rims verifies signed reference integrity manifests (RIMs), such as
+// the PlatformRims GoldenMeasurement carrying the image database.
+package rims
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	commonpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/common"
+	rimpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/image_database"
+	platformpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/platform_rims"
+)
+
+// Options contains the options for verifying a signed RIM.
+type Options struct {
+	// Roots are the pinned roots the RIM signing certificate must chain to.
+	Roots *x509.CertPool
+	// CurrentTime is the time to check the RIM expiration and the certificate
+	// chain at. Defaults to the current time.
+	CurrentTime time.Time
+}
+
+// Now returns CurrentTime, or the current time if it is not set.
+func (o Options) Now() time.Time {
+	if o.CurrentTime.IsZero() {
+		return time.Now()
+	}
+	return o.CurrentTime
+}
+
+// LoadImageDatabase parses a serialized PlatformRims GoldenMeasurement, verifies
+// it as VerifyPlatformRims does, and returns the embedded ImageDatabase, ready
+// for image.Validate.
+func LoadImageDatabase(golden []byte, opts Options) (*rimpb.ImageDatabase, error) {
+	gm := &platformpb.GoldenMeasurement{}
+	if err := proto.Unmarshal(golden, gm); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal GoldenMeasurement: %v", err)
+	}
+	platformRims, err := VerifyPlatformRims(gm, opts)
+	if err != nil {
+		return nil, err
+	}
+	if platformRims.GetImageDatabase() == nil {
+		return nil, errors.New("PlatformRims has no image database")
+	}
+	return platformRims.GetImageDatabase(), nil
+}
+
+// EarliestCertIssueTime returns the earliest issue time of endorsement
+// certificates required by the service base policy of the image database, for
+// vm.VerifyOpts. Returns the zero time if the policy does not set one.
+func EarliestCertIssueTime(imageDb *rimpb.ImageDatabase) time.Time {
+	earliest := imageDb.GetServiceBasePolicy().GetEarliestCertIssueTime()
+	if earliest == nil {
+		return time.Time{}
+	}
+	return earliest.AsTime()
+}
+
+// VerifyPlatformRims verifies the signature of the serialized PlatformRims of
+// the GoldenMeasurement and returns the PlatformRims. The signature must be
+// made by the PlatformRims cert, which must chain through the ca_bundle to
+// opts.Roots, and the PlatformRims must not have expired.
+func VerifyPlatformRims(gm *platformpb.GoldenMeasurement, opts Options) (*platformpb.PlatformRims, error) {
+	if gm == nil {
+		return nil, errors.New("GoldenMeasurement is nil")
+	}
+	// The signing certificate is part of the signed payload, so the payload is
+	// parsed before it is authenticated, but not used until it is.
+	platformRims := &platformpb.PlatformRims{}
+	if err := proto.Unmarshal(gm.GetPlatformRims(), platformRims); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal PlatformRims: %v", err)
+	}
+
+	cert, err := VerifyCertificate(platformRims.GetCert(), platformRims.GetCaBundle(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify PlatformRims signing certificate: %v", err)
+	}
+	if err := VerifySignature(gm.GetPlatformRims(), gm.GetSignature(), gm.GetSignatureAlgorithm(), cert); err != nil {
+		return nil, fmt.Errorf("failed to verify PlatformRims signature: %v", err)
+	}
+	if err := CheckValidity(platformRims.GetTimestamp(), platformRims.GetExp(), opts.Now()); err != nil {
+		return nil, fmt.Errorf("invalid PlatformRims: %v", err)
+	}
+	return platformRims, nil
+}
+
+// VerifyCertificate parses the DER signing certificate of a RIM and verifies it
+// chains through the PEM certificates of the CA bundle to opts.Roots.
+func VerifyCertificate(certDER, caBundle []byte, opts Options) (*x509.Certificate, error) {
+	if opts.Roots == nil {
+		return nil, errors.New("no roots to verify the certificate against")
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
+	}
+
+	intermediates := x509.NewCertPool()
+	for rest := caBundle; len(rest) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM type %q in the CA bundle", block.Type)
+		}
+		ca, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CA bundle certificate: %v", err)
+		}
+		intermediates.AddCert(ca)
+	}
+
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         opts.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   opts.Now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to verify certificate chain: %v", err)
+	}
+	return cert, nil
+}
+
+// VerifySignature verifies the RIM signature over data with the public key of
+// the signing certificate. ECDSA signatures are ASN.1 DER encoded, and RSA-PSS
+// signatures may use any salt length, e.g. as long as the hash or the maximum.
+func VerifySignature(data, signature []byte, alg commonpb.SignatureAlgorithm, cert *x509.Certificate) error {
+	digest := sha256.Sum256(data)
+	switch alg {
+	case commonpb.SignatureAlgorithm_ECDSA_P256_SHA256:
+		pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return fmt.Errorf("signing certificate key is not an ECDSA P-256 key for %v", alg)
+		}
+		if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+			return errors.New("invalid ECDSA signature")
+		}
+	case commonpb.SignatureAlgorithm_RSASSA_PSS_SHA256:
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("signing certificate key is not an RSA key for %v", alg)
+		}
+		if err := rsa.VerifyPSS(pub, crypto.SHA256, digest[:], signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}); err != nil {
+			return fmt.Errorf("invalid RSA-PSS signature: %v", err)
+		}
+	default:
+		return fmt.Errorf("unsupported signature algorithm %v", alg)
+	}
+	return nil
+}
+
+// CheckValidity checks that a RIM published at timestamp with expiration exp is
+// valid at now. The expiration is required.
+func CheckValidity(timestamp, exp *timestamppb.Timestamp, now time.Time) error {
+	if exp == nil {
+		return errors.New("no expiration time")
+	}
+	if !now.Before(exp.AsTime()) {
+		return fmt.Errorf("expired at %v", exp.AsTime())
+	}
+	if timestamp != nil && now.Before(timestamp.AsTime()) {
+		return fmt.Errorf("published in the future at %v", timestamp.AsTime())
+	}
+	return nil
+}
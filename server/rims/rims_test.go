@@ -0,0 +1,263 @@
+package rims
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/rims/rimstest"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	commonpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/common"
+	rimpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/image_database"
+	platformpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/platform_rims"
+)
+
+var testNow = time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestSigner(t *testing.T, alg commonpb.SignatureAlgorithm) *rimstest.Signer {
+	t.Helper()
+	signer, err := rimstest.NewSigner(alg, testNow.Add(-24*time.Hour), testNow.Add(365*24*time.Hour))
+	if err != nil {
+		t.Fatalf("rimstest.NewSigner() failed: %v", err)
+	}
+	return signer
+}
+
+func testImageDatabase() *rimpb.ImageDatabase {
+	return &rimpb.ImageDatabase{
+		GoldenValues: map[string]*rimpb.ImageDatabase_ImageGoldenEntry{
+			"cmdline": {ImageReleaseName: "confidential-space-250100", ImageBaseVersion: 1, Swversion: 250100},
+		},
+	}
+}
+
+func testPlatformRims(signer *rimstest.Signer) *platformpb.PlatformRims {
+	return &platformpb.PlatformRims{
+		ImageDatabase: testImageDatabase(),
+		Timestamp:     timestamppb.New(testNow.Add(-time.Hour)),
+		Exp:           timestamppb.New(testNow.Add(30 * 24 * time.Hour)),
+		Cert:          signer.Cert,
+		CaBundle:      signer.CABundle,
+	}
+}
+
+func signPlatformRims(t *testing.T, signer *rimstest.Signer, platformRims *platformpb.PlatformRims) *platformpb.GoldenMeasurement {
+	t.Helper()
+	raw, err := proto.Marshal(platformRims)
+	if err != nil {
+		t.Fatalf("proto.Marshal() failed: %v", err)
+	}
+	signature, err := signer.Sign(raw)
+	if err != nil {
+		t.Fatalf("Sign() failed: %v", err)
+	}
+	return &platformpb.GoldenMeasurement{PlatformRims: raw, Signature: signature, SignatureAlgorithm: signer.Algorithm}
+}
+
+func TestLoadImageDatabase(t *testing.T) {
+	for _, alg := range []commonpb.SignatureAlgorithm{commonpb.SignatureAlgorithm_ECDSA_P256_SHA256, commonpb.SignatureAlgorithm_RSASSA_PSS_SHA256} {
+		t.Run(alg.String(), func(t *testing.T) {
+			signer := newTestSigner(t, alg)
+			raw, err := proto.Marshal(signPlatformRims(t, signer, testPlatformRims(signer)))
+			if err != nil {
+				t.Fatalf("proto.Marshal() failed: %v", err)
+			}
+
+			imageDb, err := LoadImageDatabase(raw, Options{Roots: signer.Roots(), CurrentTime: testNow})
+			if err != nil {
+				t.Fatalf("LoadImageDatabase() failed: %v", err)
+			}
+			if diff := cmp.Diff(testImageDatabase(), imageDb, protocmp.Transform()); diff != "" {
+				t.Errorf("LoadImageDatabase() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestVerifyPlatformRimsErrors(t *testing.T) {
+	signer := newTestSigner(t, commonpb.SignatureAlgorithm_ECDSA_P256_SHA256)
+	otherSigner := newTestSigner(t, commonpb.SignatureAlgorithm_ECDSA_P256_SHA256)
+	rsaSigner := newTestSigner(t, commonpb.SignatureAlgorithm_RSASSA_PSS_SHA256)
+
+	testCases := []struct {
+		name    string
+		gm      func(t *testing.T) *platformpb.GoldenMeasurement
+		opts    Options
+		wantErr string
+	}{
+		{
+			name: "tampered payload",
+			gm: func(t *testing.T) *platformpb.GoldenMeasurement {
+				gm := signPlatformRims(t, signer, testPlatformRims(signer))
+				platformRims := testPlatformRims(signer)
+				platformRims.ImageDatabase.GoldenValues["cmdline"].Deprecated = true
+				gm.PlatformRims, _ = proto.Marshal(platformRims)
+				return gm
+			},
+			opts:    Options{Roots: signer.Roots(), CurrentTime: testNow},
+			wantErr: "signature",
+		},
+		{
+			name: "untrusted root",
+			gm: func(t *testing.T) *platformpb.GoldenMeasurement {
+				return signPlatformRims(t, otherSigner, testPlatformRims(otherSigner))
+			},
+			opts:    Options{Roots: signer.Roots(), CurrentTime: testNow},
+			wantErr: "certificate chain",
+		},
+		{
+			name: "no roots",
+			gm: func(t *testing.T) *platformpb.GoldenMeasurement {
+				return signPlatformRims(t, signer, testPlatformRims(signer))
+			},
+			opts:    Options{CurrentTime: testNow},
+			wantErr: "no roots",
+		},
+		{
+			name: "missing CA bundle",
+			gm: func(t *testing.T) *platformpb.GoldenMeasurement {
+				platformRims := testPlatformRims(signer)
+				platformRims.CaBundle = nil
+				return signPlatformRims(t, signer, platformRims)
+			},
+			opts:    Options{Roots: signer.Roots(), CurrentTime: testNow},
+			wantErr: "certificate chain",
+		},
+		{
+			name: "signed by another key",
+			gm: func(t *testing.T) *platformpb.GoldenMeasurement {
+				platformRims := testPlatformRims(signer)
+				return signPlatformRims(t, otherSigner, platformRims)
+			},
+			opts:    Options{Roots: signer.Roots(), CurrentTime: testNow},
+			wantErr: "invalid ECDSA signature",
+		},
+		{
+			name: "algorithm mismatch",
+			gm: func(t *testing.T) *platformpb.GoldenMeasurement {
+				gm := signPlatformRims(t, rsaSigner, testPlatformRims(rsaSigner))
+				gm.SignatureAlgorithm = commonpb.SignatureAlgorithm_ECDSA_P256_SHA256
+				return gm
+			},
+			opts:    Options{Roots: rsaSigner.Roots(), CurrentTime: testNow},
+			wantErr: "not an ECDSA P-256 key",
+		},
+		{
+			name: "unspecified algorithm",
+			gm: func(t *testing.T) *platformpb.GoldenMeasurement {
+				gm := signPlatformRims(t, signer, testPlatformRims(signer))
+				gm.SignatureAlgorithm = commonpb.SignatureAlgorithm_SIGNATURE_ALGORITHM_UNSPECIFIED
+				return gm
+			},
+			opts:    Options{Roots: signer.Roots(), CurrentTime: testNow},
+			wantErr: "unsupported signature algorithm",
+		},
+		{
+			name: "expired",
+			gm: func(t *testing.T) *platformpb.GoldenMeasurement {
+				return signPlatformRims(t, signer, testPlatformRims(signer))
+			},
+			opts:    Options{Roots: signer.Roots(), CurrentTime: testNow.Add(31 * 24 * time.Hour)},
+			wantErr: "expired",
+		},
+		{
+			name: "no expiration",
+			gm: func(t *testing.T) *platformpb.GoldenMeasurement {
+				platformRims := testPlatformRims(signer)
+				platformRims.Exp = nil
+				return signPlatformRims(t, signer, platformRims)
+			},
+			opts:    Options{Roots: signer.Roots(), CurrentTime: testNow},
+			wantErr: "no expiration",
+		},
+		{
+			name: "published in the future",
+			gm: func(t *testing.T) *platformpb.GoldenMeasurement {
+				platformRims := testPlatformRims(signer)
+				platformRims.Timestamp = timestamppb.New(testNow.Add(time.Hour))
+				return signPlatformRims(t, signer, platformRims)
+			},
+			opts:    Options{Roots: signer.Roots(), CurrentTime: testNow},
+			wantErr: "future",
+		},
+		{
+			name: "nil",
+			gm: func(t *testing.T) *platformpb.GoldenMeasurement {
+				return nil
+			},
+			opts:    Options{Roots: signer.Roots(), CurrentTime: testNow},
+			wantErr: "nil",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := VerifyPlatformRims(tc.gm(t), tc.opts)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("VerifyPlatformRims() = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifySignatureRSAPSSSaltLength(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() failed: %v", err)
+	}
+	cert := &x509.Certificate{PublicKey: &key.PublicKey}
+	data := []byte("platform rims")
+	digest := sha256.Sum256(data)
+
+	// When signing, PSSSaltLengthAuto uses the maximum salt length, as Go and
+	// OpenSSL signers do by default.
+	for _, saltLength := range []int{rsa.PSSSaltLengthEqualsHash, rsa.PSSSaltLengthAuto} {
+		signature, err := rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: saltLength})
+		if err != nil {
+			t.Fatalf("rsa.SignPSS() failed: %v", err)
+		}
+		if err := VerifySignature(data, signature, commonpb.SignatureAlgorithm_RSASSA_PSS_SHA256, cert); err != nil {
+			t.Errorf("VerifySignature() with salt length %d failed: %v", saltLength, err)
+		}
+	}
+}
+
+func TestLoadImageDatabaseErrors(t *testing.T) {
+	signer := newTestSigner(t, commonpb.SignatureAlgorithm_ECDSA_P256_SHA256)
+	opts := Options{Roots: signer.Roots(), CurrentTime: testNow}
+
+	if _, err := LoadImageDatabase([]byte{0xff}, opts); err == nil || !strings.Contains(err.Error(), "unmarshal") {
+		t.Errorf("LoadImageDatabase() = %v, want unmarshal error", err)
+	}
+
+	platformRims := testPlatformRims(signer)
+	platformRims.ImageDatabase = nil
+	raw, err := proto.Marshal(signPlatformRims(t, signer, platformRims))
+	if err != nil {
+		t.Fatalf("proto.Marshal() failed: %v", err)
+	}
+	if _, err := LoadImageDatabase(raw, opts); err == nil || !strings.Contains(err.Error(), "no image database") {
+		t.Errorf("LoadImageDatabase() = %v, want missing image database error", err)
+	}
+}
+
+func TestEarliestCertIssueTime(t *testing.T) {
+	imageDb := testImageDatabase()
+	if got := EarliestCertIssueTime(imageDb); !got.IsZero() {
+		t.Errorf("EarliestCertIssueTime() = %v, want zero time without a service base policy", got)
+	}
+
+	imageDb.ServiceBasePolicy = &rimpb.ImageDatabase_ServiceBasePolicy{EarliestCertIssueTime: timestamppb.New(testNow)}
+	if got := EarliestCertIssueTime(imageDb); !got.Equal(testNow) {
+		t.Errorf("EarliestCertIssueTime() = %v, want %v", got, testNow)
+	}
+}
@@ -0,0 +1,113 @@
+// Package rimstest creates fake RIM signers with their own certificate chain,
+// for testing signed RIM verification.
+package rimstest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/internal/certtest"
+
+	commonpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/common"
+)
+
+// Signer is a fake RIM signer with a root, an intermediate and a signing key
+// of the signature algorithm.
+type Signer struct {
+	Algorithm commonpb.SignatureAlgorithm
+	Root      *x509.Certificate
+	// Cert is the DER signing certificate.
+	Cert []byte
+	// CABundle is the PEM intermediate and root, in least intermediate…root
+	// order.
+	CABundle []byte
+	// Key is the signing key, whose public key is in Cert.
+	Key crypto.Signer
+}
+
+// NewSigner returns a Signer with a freshly generated certificate chain valid
+// from notBefore to notAfter.
+func NewSigner(alg commonpb.SignatureAlgorithm, notBefore, notAfter time.Time) (*Signer, error) {
+	var key crypto.Signer
+	var err error
+	switch alg {
+	case commonpb.SignatureAlgorithm_ECDSA_P256_SHA256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case commonpb.SignatureAlgorithm_RSASSA_PSS_SHA256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		return nil, fmt.Errorf("unsupported signature algorithm %v", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := certtest.NewCA(&x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Fake RIM Root CA"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}, elliptic.P256(), nil)
+	if err != nil {
+		return nil, err
+	}
+	intermediate, err := certtest.NewCA(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Fake RIM Intermediate CA"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}, elliptic.P256(), root)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := intermediate.Issue(&x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "Fake RIM Signer"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	var bundle []byte
+	for _, cert := range []*x509.Certificate{intermediate.Cert, root.Cert} {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+
+	return &Signer{
+		Algorithm: alg,
+		Root:      root.Cert,
+		Cert:      leaf.Raw,
+		CABundle:  bundle,
+		Key:       key,
+	}, nil
+}
+
+// Roots returns a pool holding the signer's root.
+func (s *Signer) Roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.Root)
+	return pool
+}
+
+// Sign signs the data with the signer's algorithm.
+func (s *Signer) Sign(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	var opts crypto.SignerOpts = crypto.SHA256
+	if s.Algorithm == commonpb.SignatureAlgorithm_RSASSA_PSS_SHA256 {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+	}
+	return s.Key.Sign(rand.Reader, digest[:], opts)
+}
@@ -0,0 +1,240 @@
+// Package tdxtcb verifies IntelRim documents and appraises the TCB of Intel TDX
+// platforms offline against the Intel TDX TCB info they carry.
+package tdxtcb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/rims"
+	"github.com/google/go-tdx-guest/pcs"
+	"github.com/google/go-tdx-guest/verify"
+	"google.golang.org/protobuf/proto"
+
+	tcbpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/google_tdx_tcb"
+	tdxpb "github.com/google/go-tdx-guest/proto/tdx"
+)
+
+const (
+	tcbInfoID = "TDX"
+	svnCount  = 16
+)
+
+// RIM is a verified IntelRim with its decoded TDX TCB info.
+type RIM struct {
+	IntelRim *tcbpb.IntelRim
+	// TCBInfo is the TDX TCB info of each FMSPC, keyed by lowercase hex FMSPC.
+	TCBInfo map[string]*pcs.TcbInfo
+}
+
+// TCBSVNs are the security version numbers of a TDX platform.
+type TCBSVNs struct {
+	// CPUSVNComponents are the SGX TCB component SVNs of the PCK certificate.
+	CPUSVNComponents []byte
+	// PCESVN is the PCE SVN of the PCK certificate.
+	PCESVN uint16
+	// TEETCBSVN is the TEE_TCB_SVN of the TD quote body.
+	TEETCBSVN []byte
+}
+
+// TCBResult is the TCB status of a TDX platform.
+type TCBResult struct {
+	// Status is the platform TCB status, converged with the TDX module status.
+	Status pcs.TcbComponentStatus
+	// TCBDate is the date of the matching TCB level.
+	TCBDate string
+	// AdvisoryIDs are the Intel security advisories of the matching TCB level
+	// and TDX module TCB level.
+	AdvisoryIDs []string
+}
+
+// Verify verifies the signature of the serialized IntelRim of the
+// GoldenMeasurement, as rims.VerifyPlatformRims does for PlatformRims, and
+// decodes the TDX TCB info JSON of every FMSPC.
+func Verify(gm *tcbpb.GoldenMeasurement, opts rims.Options) (*RIM, error) {
+	if gm == nil {
+		return nil, errors.New("GoldenMeasurement is nil")
+	}
+	intelRim := &tcbpb.IntelRim{}
+	if err := proto.Unmarshal(gm.GetGcpTcbInfo(), intelRim); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal IntelRim: %v", err)
+	}
+
+	cert, err := rims.VerifyCertificate(intelRim.GetCert(), intelRim.GetCaBundle(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify IntelRim signing certificate: %v", err)
+	}
+	if err := rims.VerifySignature(gm.GetGcpTcbInfo(), gm.GetSignature(), gm.GetSignatureAlgorithm(), cert); err != nil {
+		return nil, fmt.Errorf("failed to verify IntelRim signature: %v", err)
+	}
+	if err := rims.CheckValidity(intelRim.GetTimestamp(), intelRim.GetExp(), opts.Now()); err != nil {
+		return nil, fmt.Errorf("invalid IntelRim: %v", err)
+	}
+
+	rim := &RIM{IntelRim: intelRim, TCBInfo: make(map[string]*pcs.TcbInfo)}
+	for fmspc, raw := range intelRim.GetTdxTcbs() {
+		info, err := parseTCBInfo(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse TDX TCB info of FMSPC %q: %v", fmspc, err)
+		}
+		if !strings.EqualFold(info.Fmspc, fmspc) {
+			return nil, fmt.Errorf("TDX TCB info of FMSPC %q is for FMSPC %q", fmspc, info.Fmspc)
+		}
+		rim.TCBInfo[strings.ToLower(fmspc)] = info
+	}
+	return rim, nil
+}
+
+// parseTCBInfo decodes TDX TCB info JSON, either the Intel PCS response with
+// its tcbInfo and signature, or the bare tcbInfo.
+func parseTCBInfo(raw []byte) (*pcs.TcbInfo, error) {
+	var response struct {
+		TcbInfo *pcs.TcbInfo `json:"tcbInfo"`
+	}
+	if err := json.Unmarshal(raw, &response); err != nil {
+		return nil, err
+	}
+	info := response.TcbInfo
+	if info == nil {
+		info = &pcs.TcbInfo{}
+		if err := json.Unmarshal(raw, info); err != nil {
+			return nil, err
+		}
+	}
+	if info.ID != tcbInfoID {
+		return nil, fmt.Errorf("TCB info id is %q, want %q", info.ID, tcbInfoID)
+	}
+	if len(info.TcbLevels) == 0 {
+		return nil, errors.New("TCB info has no TCB levels")
+	}
+	return info, nil
+}
+
+// QuoteTCB returns the FMSPC and TCB SVNs of a verified TD quote, taken from
+// its PCK certificate and quote body.
+func QuoteTCB(quote *tdxpb.QuoteV4) (string, TCBSVNs, error) {
+	chain, err := verify.ExtractChainFromQuote(quote)
+	if err != nil {
+		return "", TCBSVNs{}, fmt.Errorf("failed to extract PCK certificate chain: %v", err)
+	}
+	ext, err := pcs.PckCertificateExtensions(chain.PCKCertificate)
+	if err != nil {
+		return "", TCBSVNs{}, fmt.Errorf("failed to parse PCK certificate extensions: %v", err)
+	}
+	return ext.FMSPC, TCBSVNs{
+		CPUSVNComponents: ext.TCB.CPUSvnComponents,
+		PCESVN:           ext.TCB.PCESvn,
+		TEETCBSVN:        quote.GetTdQuoteBody().GetTeeTcbSvn(),
+	}, nil
+}
+
+// TCBStatus returns the TCB status of a platform with the FMSPC and SVNs, and
+// the advisories that apply to it, following Intel's TDX TCB status
+// evaluation: the first TCB level whose SGX and TDX component SVNs and PCE SVN
+// are all at most the platform's determines the platform status. For TDX
+// module major versions above 0, the TDX module identity TCB levels determine
+// the module status, which is converged into the platform status.
+func (r *RIM) TCBStatus(fmspc string, svns TCBSVNs) (*TCBResult, error) {
+	info, ok := r.TCBInfo[strings.ToLower(fmspc)]
+	if !ok {
+		return nil, fmt.Errorf("no TDX TCB info for FMSPC %q", fmspc)
+	}
+	if len(svns.CPUSVNComponents) != svnCount {
+		return nil, fmt.Errorf("got %d CPU SVN components, want %d", len(svns.CPUSVNComponents), svnCount)
+	}
+	if len(svns.TEETCBSVN) != svnCount {
+		return nil, fmt.Errorf("got %d TEE TCB SVN bytes, want %d", len(svns.TEETCBSVN), svnCount)
+	}
+
+	// With a TDX module major version above 0, the first two TEE TCB SVN bytes
+	// are the module's minor and major version, appraised by module identity.
+	moduleMajor := svns.TEETCBSVN[1]
+	firstTDXComponent := 0
+	if moduleMajor > 0 {
+		firstTDXComponent = 2
+	}
+
+	var level *pcs.TcbLevel
+	for i := range info.TcbLevels {
+		if matchesTCBLevel(info.TcbLevels[i].Tcb, svns, firstTDXComponent) {
+			level = &info.TcbLevels[i]
+			break
+		}
+	}
+	if level == nil {
+		return nil, fmt.Errorf("no TCB level of FMSPC %q matches the platform SVNs", fmspc)
+	}
+	result := &TCBResult{
+		Status:      level.TcbStatus,
+		TCBDate:     level.TcbDate,
+		AdvisoryIDs: append([]string{}, level.AdvisoryIDs...),
+	}
+
+	if moduleMajor > 0 {
+		moduleLevel, err := moduleTCBLevel(info, moduleMajor, svns.TEETCBSVN[0])
+		if err != nil {
+			return nil, err
+		}
+		result.Status = convergeModuleStatus(result.Status, moduleLevel.TcbStatus)
+		result.AdvisoryIDs = append(result.AdvisoryIDs, moduleLevel.AdvisoryIDs...)
+	}
+	return result, nil
+}
+
+func matchesTCBLevel(tcb pcs.Tcb, svns TCBSVNs, firstTDXComponent int) bool {
+	if len(tcb.SgxTcbcomponents) != svnCount || len(tcb.TdxTcbcomponents) != svnCount {
+		return false
+	}
+	for i, component := range tcb.SgxTcbcomponents {
+		if svns.CPUSVNComponents[i] < component.Svn {
+			return false
+		}
+	}
+	if svns.PCESVN < tcb.Pcesvn {
+		return false
+	}
+	for i := firstTDXComponent; i < svnCount; i++ {
+		if svns.TEETCBSVN[i] < tcb.TdxTcbcomponents[i].Svn {
+			return false
+		}
+	}
+	return true
+}
+
+// moduleTCBLevel returns the first TCB level of the TDX module identity of the
+// major version whose ISV SVN is at most the module's minor version.
+func moduleTCBLevel(info *pcs.TcbInfo, major, minor byte) (*pcs.TcbLevel, error) {
+	id := fmt.Sprintf("TDX_%02X", major)
+	for _, identity := range info.TdxModuleIdentities {
+		if !strings.EqualFold(identity.ID, id) {
+			continue
+		}
+		for i := range identity.TcbLevels {
+			if uint32(minor) >= identity.TcbLevels[i].Tcb.Isvsvn {
+				return &identity.TcbLevels[i], nil
+			}
+		}
+		return nil, fmt.Errorf("no TCB level of TDX module %s matches ISV SVN %d", id, minor)
+	}
+	return nil, fmt.Errorf("no TDX module identity %s", id)
+}
+
+// convergeModuleStatus merges the TDX module TCB status into the platform TCB
+// status: an out of date module makes the platform out of date, and a revoked
+// module revokes it.
+func convergeModuleStatus(status, moduleStatus pcs.TcbComponentStatus) pcs.TcbComponentStatus {
+	switch moduleStatus {
+	case pcs.TcbComponentStatusRevoked:
+		return pcs.TcbComponentStatusRevoked
+	case pcs.TcbComponentStatusOutOfDate:
+		switch status {
+		case pcs.TcbComponentStatusUpToDate, pcs.TcbComponentStatusSwHardeningNeeded:
+			return pcs.TcbComponentStatusOutOfDate
+		case pcs.TcbComponentStatusConfigurationNeeded, pcs.TcbComponentStatusConfigurationAndSWHardeningNeeded:
+			return pcs.TcbComponentStatusOutOfDateConfigurationNeeded
+		}
+	}
+	return status
+}
@@ -0,0 +1,368 @@
+package tdxtcb
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/rims"
+	"github.com/GoogleCloudPlatform/confidential-space/server/rims/rimstest"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-tdx-guest/abi"
+	"github.com/google/go-tdx-guest/pcs"
+	"github.com/google/go-tdx-guest/testing/testdata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	commonpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/common"
+	tcbpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/google_tdx_tcb"
+	tdxpb "github.com/google/go-tdx-guest/proto/tdx"
+)
+
+const (
+	testFMSPC       = "00806F050000"
+	testSampleFMSPC = "50806f000000"
+)
+
+var testNow = time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+func components(svns ...byte) []map[string]any {
+	out := make([]map[string]any, svnCount)
+	for i := range out {
+		var svn byte
+		if i < len(svns) {
+			svn = svns[i]
+		}
+		out[i] = map[string]any{"svn": svn}
+	}
+	return out
+}
+
+func tcbLevel(sgx byte, pcesvn uint16, tdx []byte, status string, advisories ...string) map[string]any {
+	sgxSVNs := make([]byte, 8)
+	for i := range sgxSVNs {
+		sgxSVNs[i] = sgx
+	}
+	level := map[string]any{
+		"tcb": map[string]any{
+			"sgxtcbcomponents": components(sgxSVNs...),
+			"pcesvn":           pcesvn,
+			"tdxtcbcomponents": components(tdx...),
+		},
+		"tcbDate":   "2025-01-01T00:00:00Z",
+		"tcbStatus": status,
+	}
+	if len(advisories) > 0 {
+		level["advisoryIDs"] = advisories
+	}
+	return level
+}
+
+func moduleLevel(isvsvn uint32, status string, advisories ...string) map[string]any {
+	level := map[string]any{
+		"tcb":       map[string]any{"isvsvn": isvsvn},
+		"tcbDate":   "2025-01-01T00:00:00Z",
+		"tcbStatus": status,
+	}
+	if len(advisories) > 0 {
+		level["advisoryIDs"] = advisories
+	}
+	return level
+}
+
+// testTCBInfo returns the PCS TDX TCB info response of testFMSPC.
+func testTCBInfo(t *testing.T) []byte {
+	t.Helper()
+	tcbInfo := map[string]any{
+		"id":                      "TDX",
+		"version":                 3,
+		"issueDate":               "2026-02-01T00:00:00Z",
+		"nextUpdate":              "2026-03-03T00:00:00Z",
+		"fmspc":                   strings.ToLower(testFMSPC),
+		"pceId":                   "0000",
+		"tcbType":                 0,
+		"tcbEvaluationDataNumber": 17,
+		"tdxModule":               map[string]any{"mrsigner": "00", "attributes": "0000000000000000", "attributesMask": "FFFFFFFFFFFFFFFF"},
+		"tdxModuleIdentities": []map[string]any{{
+			"id":             "TDX_01",
+			"mrsigner":       "00",
+			"attributes":     "0000000000000000",
+			"attributesMask": "FFFFFFFFFFFFFFFF",
+			"tcbLevels": []map[string]any{
+				moduleLevel(4, "UpToDate"),
+				moduleLevel(2, "OutOfDate", "INTEL-SA-01036"),
+				moduleLevel(0, "Revoked", "INTEL-SA-00960"),
+			},
+		}},
+		"tcbLevels": []map[string]any{
+			tcbLevel(7, 13, []byte{0, 0, 7}, "UpToDate"),
+			tcbLevel(7, 13, []byte{0, 0, 5}, "SWHardeningNeeded", "INTEL-SA-00837"),
+			tcbLevel(5, 11, []byte{0, 0, 3}, "OutOfDate", "INTEL-SA-00837", "INTEL-SA-00960"),
+			tcbLevel(2, 5, []byte{0, 0, 2}, "Revoked", "INTEL-SA-00106"),
+		},
+	}
+	raw, err := json.Marshal(map[string]any{"tcbInfo": tcbInfo, "signature": "00"})
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	return raw
+}
+
+func signIntelRim(t *testing.T, signer *rimstest.Signer, intelRim *tcbpb.IntelRim) *tcbpb.GoldenMeasurement {
+	t.Helper()
+	raw, err := proto.Marshal(intelRim)
+	if err != nil {
+		t.Fatalf("proto.Marshal() failed: %v", err)
+	}
+	signature, err := signer.Sign(raw)
+	if err != nil {
+		t.Fatalf("Sign() failed: %v", err)
+	}
+	return &tcbpb.GoldenMeasurement{GcpTcbInfo: raw, Signature: signature, SignatureAlgorithm: signer.Algorithm}
+}
+
+func newTestRim(t *testing.T, tcbs map[string][]byte) (*tcbpb.GoldenMeasurement, rims.Options) {
+	t.Helper()
+	signer, err := rimstest.NewSigner(commonpb.SignatureAlgorithm_ECDSA_P256_SHA256, testNow.Add(-24*time.Hour), testNow.Add(365*24*time.Hour))
+	if err != nil {
+		t.Fatalf("rimstest.NewSigner() failed: %v", err)
+	}
+	gm := signIntelRim(t, signer, &tcbpb.IntelRim{
+		TdxTcbs:   tcbs,
+		Timestamp: timestamppb.New(testNow.Add(-time.Hour)),
+		Exp:       timestamppb.New(testNow.Add(30 * 24 * time.Hour)),
+		Cert:      signer.Cert,
+		CaBundle:  signer.CABundle,
+	})
+	return gm, rims.Options{Roots: signer.Roots(), CurrentTime: testNow}
+}
+
+func svns(sgx byte, pcesvn uint16, tdx ...byte) TCBSVNs {
+	s := TCBSVNs{CPUSVNComponents: make([]byte, svnCount), PCESVN: pcesvn, TEETCBSVN: make([]byte, svnCount)}
+	for i := 0; i < 8; i++ {
+		s.CPUSVNComponents[i] = sgx
+	}
+	copy(s.TEETCBSVN, tdx)
+	return s
+}
+
+func TestTCBStatus(t *testing.T) {
+	gm, opts := newTestRim(t, map[string][]byte{testFMSPC: testTCBInfo(t)})
+	rim, err := Verify(gm, opts)
+	if err != nil {
+		t.Fatalf("Verify() failed: %v", err)
+	}
+
+	testCases := []struct {
+		name  string
+		fmspc string
+		svns  TCBSVNs
+		want  *TCBResult
+	}{
+		{
+			name:  "up to date",
+			fmspc: testFMSPC,
+			svns:  svns(7, 13, 0, 0, 7),
+			want:  &TCBResult{Status: pcs.TcbComponentStatusUpToDate, TCBDate: "2025-01-01T00:00:00Z", AdvisoryIDs: []string{}},
+		},
+		{
+			name:  "lowercase FMSPC",
+			fmspc: strings.ToLower(testFMSPC),
+			svns:  svns(8, 14, 0, 0, 9),
+			want:  &TCBResult{Status: pcs.TcbComponentStatusUpToDate, TCBDate: "2025-01-01T00:00:00Z", AdvisoryIDs: []string{}},
+		},
+		{
+			name:  "TDX component behind",
+			fmspc: testFMSPC,
+			svns:  svns(7, 13, 0, 0, 6),
+			want:  &TCBResult{Status: pcs.TcbComponentStatusSwHardeningNeeded, TCBDate: "2025-01-01T00:00:00Z", AdvisoryIDs: []string{"INTEL-SA-00837"}},
+		},
+		{
+			name:  "PCE SVN behind",
+			fmspc: testFMSPC,
+			svns:  svns(7, 12, 0, 0, 7),
+			want:  &TCBResult{Status: pcs.TcbComponentStatusOutOfDate, TCBDate: "2025-01-01T00:00:00Z", AdvisoryIDs: []string{"INTEL-SA-00837", "INTEL-SA-00960"}},
+		},
+		{
+			name:  "revoked",
+			fmspc: testFMSPC,
+			svns:  svns(4, 13, 0, 0, 7),
+			want:  &TCBResult{Status: pcs.TcbComponentStatusRevoked, TCBDate: "2025-01-01T00:00:00Z", AdvisoryIDs: []string{"INTEL-SA-00106"}},
+		},
+		{
+			name:  "TDX module up to date",
+			fmspc: testFMSPC,
+			svns:  svns(7, 13, 5, 1, 7),
+			want:  &TCBResult{Status: pcs.TcbComponentStatusUpToDate, TCBDate: "2025-01-01T00:00:00Z", AdvisoryIDs: []string{}},
+		},
+		{
+			name:  "TDX module out of date",
+			fmspc: testFMSPC,
+			svns:  svns(7, 13, 3, 1, 5),
+			want:  &TCBResult{Status: pcs.TcbComponentStatusOutOfDate, TCBDate: "2025-01-01T00:00:00Z", AdvisoryIDs: []string{"INTEL-SA-00837", "INTEL-SA-01036"}},
+		},
+		{
+			name:  "TDX module revoked",
+			fmspc: testFMSPC,
+			svns:  svns(7, 13, 1, 1, 7),
+			want:  &TCBResult{Status: pcs.TcbComponentStatusRevoked, TCBDate: "2025-01-01T00:00:00Z", AdvisoryIDs: []string{"INTEL-SA-00960"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := rim.TCBStatus(tc.fmspc, tc.svns)
+			if err != nil {
+				t.Fatalf("TCBStatus() failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("TCBStatus() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	errorCases := []struct {
+		name    string
+		fmspc   string
+		svns    TCBSVNs
+		wantErr string
+	}{
+		{"unknown FMSPC", "00906ED50000", svns(7, 13, 0, 0, 7), "no TDX TCB info"},
+		{"below every level", testFMSPC, svns(1, 13, 0, 0, 7), "no TCB level"},
+		{"unknown TDX module", testFMSPC, svns(7, 13, 5, 2, 7), "no TDX module identity TDX_02"},
+		{"short CPU SVN", testFMSPC, TCBSVNs{CPUSVNComponents: make([]byte, 8), TEETCBSVN: make([]byte, svnCount)}, "CPU SVN components"},
+		{"short TEE TCB SVN", testFMSPC, TCBSVNs{CPUSVNComponents: make([]byte, svnCount)}, "TEE TCB SVN"},
+	}
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := rim.TCBStatus(tc.fmspc, tc.svns)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("TCBStatus() = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	bareTCBInfo := func(t *testing.T, mutate func(map[string]any)) []byte {
+		var response map[string]any
+		if err := json.Unmarshal(testTCBInfo(t), &response); err != nil {
+			t.Fatal(err)
+		}
+		tcbInfo := response["tcbInfo"].(map[string]any)
+		mutate(tcbInfo)
+		raw, err := json.Marshal(tcbInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	// The bare tcbInfo, without the PCS response wrapper, is accepted too.
+	gm, opts := newTestRim(t, map[string][]byte{testFMSPC: bareTCBInfo(t, func(map[string]any) {})})
+	if _, err := Verify(gm, opts); err != nil {
+		t.Errorf("Verify() with a bare tcbInfo failed: %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		tcbs    map[string][]byte
+		mutate  func(gm *tcbpb.GoldenMeasurement, opts *rims.Options)
+		wantErr string
+	}{
+		{
+			name:    "FMSPC mismatch",
+			tcbs:    map[string][]byte{"00906ED50000": testTCBInfo(t)},
+			wantErr: "is for FMSPC",
+		},
+		{
+			name:    "SGX TCB info",
+			tcbs:    map[string][]byte{testFMSPC: bareTCBInfo(t, func(info map[string]any) { info["id"] = "SGX" })},
+			wantErr: "TCB info id",
+		},
+		{
+			name:    "no TCB levels",
+			tcbs:    map[string][]byte{testFMSPC: bareTCBInfo(t, func(info map[string]any) { delete(info, "tcbLevels") })},
+			wantErr: "no TCB levels",
+		},
+		{
+			name:    "invalid JSON",
+			tcbs:    map[string][]byte{testFMSPC: []byte("{")},
+			wantErr: "failed to parse",
+		},
+		{
+			name: "invalid signature",
+			tcbs: map[string][]byte{testFMSPC: testTCBInfo(t)},
+			mutate: func(gm *tcbpb.GoldenMeasurement, opts *rims.Options) {
+				gm.Signature[len(gm.Signature)-1] ^= 0x01
+			},
+			wantErr: "signature",
+		},
+		{
+			name: "expired",
+			tcbs: map[string][]byte{testFMSPC: testTCBInfo(t)},
+			mutate: func(gm *tcbpb.GoldenMeasurement, opts *rims.Options) {
+				opts.CurrentTime = testNow.Add(31 * 24 * time.Hour)
+			},
+			wantErr: "expired",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gm, opts := newTestRim(t, tc.tcbs)
+			if tc.mutate != nil {
+				tc.mutate(gm, &opts)
+			}
+			_, err := Verify(gm, opts)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Verify() = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestQuoteTCB(t *testing.T) {
+	quote, err := abi.QuoteToProto(testdata.RawQuote)
+	if err != nil {
+		t.Fatalf("abi.QuoteToProto() failed: %v", err)
+	}
+	quoteV4, ok := quote.(*tdxpb.QuoteV4)
+	if !ok {
+		t.Fatalf("got quote type %T, want *tdxpb.QuoteV4", quote)
+	}
+
+	fmspc, got, err := QuoteTCB(quoteV4)
+	if err != nil {
+		t.Fatalf("QuoteTCB() failed: %v", err)
+	}
+	want := TCBSVNs{
+		CPUSVNComponents: []byte{3, 3, 2, 2, 2, 1, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0},
+		PCESVN:           11,
+		TEETCBSVN:        []byte{3, 0, 4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	}
+	if fmspc != testSampleFMSPC {
+		t.Errorf("QuoteTCB() FMSPC = %q, want %q", fmspc, testSampleFMSPC)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("QuoteTCB() mismatch (-want +got):\n%s", diff)
+	}
+
+	// The sample platform is below every TCB level of the sample TCB info.
+	gm, opts := newTestRim(t, map[string][]byte{testSampleFMSPC: testdata.TcbInfoBody})
+	rim, err := Verify(gm, opts)
+	if err != nil {
+		t.Fatalf("Verify() failed: %v", err)
+	}
+	if _, err := rim.TCBStatus(fmspc, got); err == nil || !strings.Contains(err.Error(), "no TCB level") {
+		t.Errorf("TCBStatus() = %v, want no matching TCB level error", err)
+	}
+	got.CPUSVNComponents = []byte{5, 5, 2, 2, 3, 1, 0, 3, 0, 0, 0, 0, 0, 0, 0, 0}
+	got.TEETCBSVN[2] = 5
+	result, err := rim.TCBStatus(fmspc, got)
+	if err != nil {
+		t.Fatalf("TCBStatus() failed: %v", err)
+	}
+	if result.Status != pcs.TcbComponentStatusUpToDate {
+		t.Errorf("TCBStatus() = %v, want %v", result.Status, pcs.TcbComponentStatusUpToDate)
+	}
+}
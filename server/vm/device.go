@@ -0,0 +1,111 @@
+package vm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"slices"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/gpu"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+	tpmattestpb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+// GPUNonce returns the nonce the workload must attest its GPUs with for the
+// VmAttestation device_reports: SHA256 of the report data, so the GPU reports
+// are bound to the label, challenge and extra data.
+func GPUNonce(att *attestpb.VmAttestation) []byte {
+	nonce := sha256.Sum256(reportData(att))
+	return nonce[:]
+}
+
+// verifyDeviceReports verifies the runtime GPU attestation report of the
+// device_reports and checks it against the GPU binding measured in the COS
+// event log: CC mode must be ON, the report must attest the same GPUs, with the
+// same UUIDs and attestation certificate keys, and its nonce must be derived
+// from the report data.
+func verifyDeviceReports(reports []*attestpb.DeviceAttestationReport, reportData []byte, cosState *tpmattestpb.AttestedCosState, opts gpu.Options) ([]*gpu.VerifiedGPU, error) {
+	measured := cosState.GetGpuDeviceState()
+	if measured.GetCcMode() != tpmattestpb.GPUDeviceCCMode_ON {
+		return nil, fmt.Errorf("measured GPU CC mode is %v, want ON", measured.GetCcMode())
+	}
+	binding := measured.GetNvidiaAttestationReport()
+	if binding == nil {
+		return nil, fmt.Errorf("COS event log has no GPU attestation binding")
+	}
+
+	var runtime *attestpb.NvidiaAttestationReport
+	for _, report := range reports {
+		nvidiaReport := report.GetNvidiaReport()
+		if nvidiaReport == nil {
+			return nil, fmt.Errorf("unsupported device attestation report %T", report.GetReport())
+		}
+		if runtime != nil {
+			return nil, fmt.Errorf("found more than one NVIDIA device attestation report")
+		}
+		runtime = nvidiaReport
+	}
+	if runtime == nil {
+		return nil, fmt.Errorf("no device attestation reports for the measured GPU binding")
+	}
+
+	wantNonce := sha256.Sum256(reportData)
+	if !bytes.Equal(runtime.GetNonce(), wantNonce[:]) {
+		return nil, fmt.Errorf("device attestation report nonce %x is not derived from the attestation challenge, want %x", runtime.GetNonce(), wantNonce)
+	}
+
+	if (binding.GetMpt() != nil) != (runtime.GetMpt() != nil) {
+		return nil, fmt.Errorf("device attestation report CC feature %T does not match the measured CC feature %T", runtime.GetCcFeature(), binding.GetCcFeature())
+	}
+	measuredUUIDs := gpuUUIDs(binding)
+	runtimeUUIDs := gpuUUIDs(runtime)
+	if !slices.Equal(measuredUUIDs, runtimeUUIDs) {
+		return nil, fmt.Errorf("device attestation report GPUs %v do not match the measured GPUs %v", runtimeUUIDs, measuredUUIDs)
+	}
+
+	result, err := gpu.VerifyReport(runtime, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify device attestation report: %v", err)
+	}
+
+	// The UUIDs are not signed, so each runtime GPU must also be the same
+	// device as the measured GPU with its UUID. This includes the GPUs that
+	// failed verification when opts.MinVerifiedGPUs allows it, so no unmeasured
+	// GPU is attached.
+	measuredDeviceIDs := make(map[string]string)
+	for _, quote := range gpuQuotes(binding) {
+		if measuredDeviceIDs[quote.GetUuid()], err = gpu.DeviceID(quote); err != nil {
+			return nil, fmt.Errorf("invalid measured GPU %q: %v", quote.GetUuid(), err)
+		}
+	}
+	for _, quote := range gpuQuotes(runtime) {
+		deviceID, err := gpu.DeviceID(quote)
+		if err != nil {
+			return nil, fmt.Errorf("invalid device attestation report GPU %q: %v", quote.GetUuid(), err)
+		}
+		if measuredDeviceIDs[quote.GetUuid()] != deviceID {
+			return nil, fmt.Errorf("device attestation report GPU %q is device %s, want the measured device %s",
+				quote.GetUuid(), deviceID, measuredDeviceIDs[quote.GetUuid()])
+		}
+	}
+	return result.VerifiedGPUs(), nil
+}
+
+// gpuQuotes returns the GPU quotes of the report.
+func gpuQuotes(report *attestpb.NvidiaAttestationReport) []*attestpb.GpuInfo {
+	if spt := report.GetSpt(); spt != nil {
+		return []*attestpb.GpuInfo{spt.GetGpuQuote()}
+	}
+	return report.GetMpt().GetGpuQuotes()
+}
+
+// gpuUUIDs returns the sorted GPU UUIDs of the report.
+func gpuUUIDs(report *attestpb.NvidiaAttestationReport) []string {
+	var uuids []string
+	for _, quote := range gpuQuotes(report) {
+		uuids = append(uuids, quote.GetUuid())
+	}
+	slices.Sort(uuids)
+	return uuids
+}
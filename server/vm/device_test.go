@@ -0,0 +1,260 @@
+package vm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/gpu"
+	"github.com/GoogleCloudPlatform/confidential-space/server/gpu/gputest"
+	"github.com/GoogleCloudPlatform/confidential-space/server/labels"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+	tpmattestpb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+type testGPUs struct {
+	devices []*gputest.Device
+	roots   *x509.CertPool
+}
+
+func newTestGPUs(t *testing.T, uuids ...string) *testGPUs {
+	t.Helper()
+	gpus := &testGPUs{roots: x509.NewCertPool()}
+	for _, uuid := range uuids {
+		device, err := gputest.NewDevice(uuid, attestpb.GpuArchitectureType_GPU_ARCHITECTURE_TYPE_HOPPER)
+		if err != nil {
+			t.Fatalf("gputest.NewDevice() failed: %v", err)
+		}
+		gpus.devices = append(gpus.devices, device)
+		gpus.roots.AddCert(device.Root)
+	}
+	return gpus
+}
+
+// report returns an MPT report of the GPUs for the nonce.
+func (g *testGPUs) report(t *testing.T, nonce []byte) *attestpb.NvidiaAttestationReport {
+	t.Helper()
+	mpt := &attestpb.NvidiaAttestationReport_MultiGpuSecurePassthroughAttestation{}
+	for _, device := range g.devices {
+		info, err := device.GpuInfo(nonce)
+		if err != nil {
+			t.Fatalf("GpuInfo() failed: %v", err)
+		}
+		mpt.GpuQuotes = append(mpt.GpuQuotes, info)
+	}
+	return &attestpb.NvidiaAttestationReport{
+		CcFeature: &attestpb.NvidiaAttestationReport_Mpt{Mpt: mpt},
+		Nonce:     nonce,
+	}
+}
+
+func deviceReports(reports ...*attestpb.NvidiaAttestationReport) []*attestpb.DeviceAttestationReport {
+	var deviceReports []*attestpb.DeviceAttestationReport
+	for _, report := range reports {
+		deviceReports = append(deviceReports, &attestpb.DeviceAttestationReport{
+			Report: &attestpb.DeviceAttestationReport_NvidiaReport{NvidiaReport: report},
+		})
+	}
+	return deviceReports
+}
+
+func measuredCosState(ccMode tpmattestpb.GPUDeviceCCMode, binding *attestpb.NvidiaAttestationReport) *tpmattestpb.AttestedCosState {
+	return &tpmattestpb.AttestedCosState{
+		GpuDeviceState: &tpmattestpb.GpuDeviceState{CcMode: ccMode, NvidiaAttestationReport: binding},
+	}
+}
+
+func TestGPUNonce(t *testing.T) {
+	att := &attestpb.VmAttestation{Label: []byte(labels.WorkloadAttestation), Challenge: []byte("challenge")}
+	want := sha256.Sum256(reportData(att))
+	if got := GPUNonce(att); !bytes.Equal(got, want[:]) {
+		t.Errorf("GPUNonce() = %x, want %x", got, want)
+	}
+
+	att.Challenge = []byte("other challenge")
+	if got := GPUNonce(att); bytes.Equal(got, want[:]) {
+		t.Errorf("GPUNonce() did not change with the challenge")
+	}
+}
+
+func TestVerifyDeviceReports(t *testing.T) {
+	att := &attestpb.VmAttestation{Label: []byte(labels.WorkloadAttestation), Challenge: []byte("challenge")}
+	nonce := GPUNonce(att)
+	launchNonce := bytes.Repeat([]byte{0x01}, gpu.NonceSize)
+
+	gpus := newTestGPUs(t, "GPU-0", "GPU-1")
+	binding := gpus.report(t, launchNonce)
+	opts := gpu.Options{Roots: gpus.roots}
+
+	verified, err := verifyDeviceReports(deviceReports(gpus.report(t, nonce)), reportData(att), measuredCosState(tpmattestpb.GPUDeviceCCMode_ON, binding), opts)
+	if err != nil {
+		t.Fatalf("verifyDeviceReports() failed: %v", err)
+	}
+	if len(verified) != 2 || verified[0].UUID != "GPU-0" || verified[1].UUID != "GPU-1" {
+		t.Errorf("verifyDeviceReports() = %+v, want GPU-0 and GPU-1", verified)
+	}
+
+	swappedGPUs := newTestGPUs(t, "GPU-0", "GPU-2")
+	// Other real GPUs, labelled with the measured UUIDs.
+	relabeledGPUs := newTestGPUs(t, "GPU-0", "GPU-1")
+	sptReport := &attestpb.NvidiaAttestationReport{
+		CcFeature: &attestpb.NvidiaAttestationReport_Spt{
+			Spt: &attestpb.NvidiaAttestationReport_SinglePassthroughAttestation{GpuQuote: gpus.report(t, nonce).GetMpt().GetGpuQuotes()[0]},
+		},
+		Nonce: nonce,
+	}
+
+	testCases := []struct {
+		name     string
+		reports  []*attestpb.DeviceAttestationReport
+		cosState *tpmattestpb.AttestedCosState
+		opts     gpu.Options
+		wantErr  string
+	}{
+		{
+			name:     "CC mode off",
+			reports:  deviceReports(gpus.report(t, nonce)),
+			cosState: measuredCosState(tpmattestpb.GPUDeviceCCMode_OFF, binding),
+			opts:     opts,
+			wantErr:  "CC mode",
+		},
+		{
+			name:     "CC mode devtools",
+			reports:  deviceReports(gpus.report(t, nonce)),
+			cosState: measuredCosState(tpmattestpb.GPUDeviceCCMode_DEVTOOLS, binding),
+			opts:     opts,
+			wantErr:  "CC mode",
+		},
+		{
+			name:     "no measured binding",
+			reports:  deviceReports(gpus.report(t, nonce)),
+			cosState: measuredCosState(tpmattestpb.GPUDeviceCCMode_ON, nil),
+			opts:     opts,
+			wantErr:  "no GPU attestation binding",
+		},
+		{
+			name:     "no device reports",
+			cosState: measuredCosState(tpmattestpb.GPUDeviceCCMode_ON, binding),
+			opts:     opts,
+			wantErr:  "no device attestation reports",
+		},
+		{
+			name:     "unsupported device report",
+			reports:  []*attestpb.DeviceAttestationReport{{}},
+			cosState: measuredCosState(tpmattestpb.GPUDeviceCCMode_ON, binding),
+			opts:     opts,
+			wantErr:  "unsupported",
+		},
+		{
+			name:     "two NVIDIA reports",
+			reports:  deviceReports(gpus.report(t, nonce), gpus.report(t, nonce)),
+			cosState: measuredCosState(tpmattestpb.GPUDeviceCCMode_ON, binding),
+			opts:     opts,
+			wantErr:  "more than one",
+		},
+		{
+			name:     "replayed launch report",
+			reports:  deviceReports(binding),
+			cosState: measuredCosState(tpmattestpb.GPUDeviceCCMode_ON, binding),
+			opts:     opts,
+			wantErr:  "nonce",
+		},
+		{
+			name:     "swapped GPU",
+			reports:  deviceReports(swappedGPUs.report(t, nonce)),
+			cosState: measuredCosState(tpmattestpb.GPUDeviceCCMode_ON, binding),
+			opts:     gpu.Options{Roots: swappedGPUs.roots},
+			wantErr:  "do not match the measured GPUs",
+		},
+		{
+			name:     "swapped GPU with the measured UUID",
+			reports:  deviceReports(relabeledGPUs.report(t, nonce)),
+			cosState: measuredCosState(tpmattestpb.GPUDeviceCCMode_ON, binding),
+			opts:     gpu.Options{Roots: relabeledGPUs.roots},
+			wantErr:  "want the measured device",
+		},
+		{
+			name:     "CC feature mismatch",
+			reports:  deviceReports(sptReport),
+			cosState: measuredCosState(tpmattestpb.GPUDeviceCCMode_ON, binding),
+			opts:     opts,
+			wantErr:  "CC feature",
+		},
+		{
+			name:     "untrusted device report",
+			reports:  deviceReports(gpus.report(t, nonce)),
+			cosState: measuredCosState(tpmattestpb.GPUDeviceCCMode_ON, binding),
+			opts:     gpu.Options{Roots: x509.NewCertPool()},
+			wantErr:  "failed to verify device attestation report",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := verifyDeviceReports(tc.reports, reportData(att), tc.cosState, tc.opts)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("verifyDeviceReports() = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyDeviceReportsMinVerifiedGPUs(t *testing.T) {
+	att := &attestpb.VmAttestation{Label: []byte(labels.WorkloadAttestation), Challenge: []byte("challenge")}
+	nonce := GPUNonce(att)
+	gpus := newTestGPUs(t, "GPU-0", "GPU-1")
+	cosState := measuredCosState(tpmattestpb.GPUDeviceCCMode_ON, gpus.report(t, bytes.Repeat([]byte{0x01}, gpu.NonceSize)))
+	// Only GPU-0 chains to the roots, so GPU-1 fails verification.
+	opts := gpu.Options{Roots: x509.NewCertPool(), MinVerifiedGPUs: 1}
+	opts.Roots.AddCert(gpus.devices[0].Root)
+
+	verified, err := verifyDeviceReports(deviceReports(gpus.report(t, nonce)), reportData(att), cosState, opts)
+	if err != nil {
+		t.Fatalf("verifyDeviceReports() failed: %v", err)
+	}
+	if len(verified) != 1 || verified[0].UUID != "GPU-0" {
+		t.Errorf("verifyDeviceReports() = %+v, want GPU-0", verified)
+	}
+
+	// Another GPU labelled with the measured UUID GPU-1 is rejected even though
+	// it does not need to verify.
+	mixedGPUs := &testGPUs{devices: []*gputest.Device{gpus.devices[0], newTestGPUs(t, "GPU-1").devices[0]}}
+	if _, err := verifyDeviceReports(deviceReports(mixedGPUs.report(t, nonce)), reportData(att), cosState, opts); err == nil || !strings.Contains(err.Error(), "want the measured device") {
+		t.Errorf("verifyDeviceReports() with an unmeasured GPU-1 = %v, want measured device error", err)
+	}
+}
+
+func TestVerifyVmAttestationDeviceReports(t *testing.T) {
+	att, roots := testTpmVmAttestation(t)
+	gpus := newTestGPUs(t, "GPU-0")
+	opts := &VerifyOpts{
+		Label:               labels.WorkloadAttestation,
+		Challenge:           []byte("challenge"),
+		AKRoots:             roots,
+		DeviceReportOptions: &gpu.Options{Roots: gpus.roots},
+	}
+
+	// Without a measured GPU binding or device reports there is nothing to check.
+	state, err := VerifyVmAttestation(att, opts)
+	if err != nil {
+		t.Fatalf("VerifyVmAttestation() failed: %v", err)
+	}
+	if state.DeviceGPUs != nil {
+		t.Errorf("VerifyVmAttestation() DeviceGPUs = %+v, want nil", state.DeviceGPUs)
+	}
+
+	// Device reports without a measured GPU binding are rejected.
+	att.DeviceReports = deviceReports(gpus.report(t, GPUNonce(att)))
+	if _, err := VerifyVmAttestation(att, opts); err == nil || !strings.Contains(err.Error(), "device reports") {
+		t.Errorf("VerifyVmAttestation() = %v, want device report error", err)
+	}
+
+	// Device reports are ignored without DeviceReportOptions.
+	opts.DeviceReportOptions = nil
+	if _, err := VerifyVmAttestation(att, opts); err != nil {
+		t.Errorf("VerifyVmAttestation() without DeviceReportOptions failed: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/extract"
+	"github.com/google/go-eventlog/ccel"
+	"github.com/google/go-eventlog/register"
+	"github.com/google/go-tdx-guest/verify"
+	"github.com/google/go-tpm-tools/server"
+	"google.golang.org/protobuf/proto"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+	elextract "github.com/google/go-eventlog/extract"
+	tdxpb "github.com/google/go-tdx-guest/proto/tdx"
+	tpmattestpb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+// rtmrCount is the number of RTMRs reported in a TD quote.
+const rtmrCount = 4
+
+func verifyTdxCcelQuote(quote *attestpb.TdxCcelQuote, reportData []byte, opts *VerifyOpts) (*State, error) {
+	tdQuote, err := verifyTDQuote(quote.GetTdQuote(), reportData, opts.TdxOptions, opts.EarliestCertIssueTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify TD quote: %v", err)
+	}
+
+	rtmrBank, err := createRTMRBank(tdQuote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create RTMR bank: %v", err)
+	}
+
+	state, err := verifyTdxEventLogs(quote, rtmrBank, opts.COSOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify and extract state: %w", err)
+	}
+	state.MachineState.TeeAttestation = &tpmattestpb.MachineState_TdxAttestation{
+		TdxAttestation: tdQuote,
+	}
+
+	return state, nil
+}
+
+// verifyTDQuote parses the serialized QuoteV4, verifies its signature and
+// certificate chain, checks that its PCK certificate was not issued before the
+// earliest issue time, and checks that it binds the expected report data.
+func verifyTDQuote(rawQuote []byte, reportData []byte, tdxOpts *verify.Options, earliestIssueTime time.Time) (*tdxpb.QuoteV4, error) {
+	if len(rawQuote) == 0 {
+		return nil, fmt.Errorf("TD quote is empty")
+	}
+	tdQuote := &tdxpb.QuoteV4{}
+	if err := proto.Unmarshal(rawQuote, tdQuote); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal TD quote: %v", err)
+	}
+
+	if tdxOpts == nil {
+		tdxOpts = verify.DefaultOptions()
+	}
+	if err := verify.TdxQuote(tdQuote, tdxOpts); err != nil {
+		return nil, err
+	}
+	if !earliestIssueTime.IsZero() {
+		chain, err := verify.ExtractChainFromQuote(tdQuote)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract PCK certificate chain: %v", err)
+		}
+		if err := checkCertIssueTime(chain.PCKCertificate, earliestIssueTime); err != nil {
+			return nil, fmt.Errorf("PCK certificate is not accepted: %v", err)
+		}
+	}
+
+	if !bytes.Equal(tdQuote.GetTdQuoteBody().GetReportData(), reportData) {
+		return nil, fmt.Errorf("TD quote report data does not match the attestation")
+	}
+
+	return tdQuote, nil
+}
+
+func createRTMRBank(tdQuote *tdxpb.QuoteV4) (register.RTMRBank, error) {
+	rtmrs := tdQuote.GetTdQuoteBody().GetRtmrs()
+	if len(rtmrs) != rtmrCount {
+		return register.RTMRBank{}, fmt.Errorf("TD quote has %d RTMRs, expected %d", len(rtmrs), rtmrCount)
+	}
+
+	rtmrBank := register.RTMRBank{}
+	for i, digest := range rtmrs {
+		rtmrBank.RTMRs = append(rtmrBank.RTMRs, register.RTMR{Index: i, Digest: digest})
+	}
+	return rtmrBank, nil
+}
+
+func verifyTdxEventLogs(quote *attestpb.TdxCcelQuote, rtmrBank register.RTMRBank, cosOpts extract.Options) (*State, error) {
+	// The CCEL ACPI table is not part of the attestation, and the event log is
+	// authenticated by the replay against the quoted RTMRs instead.
+	fls, err := ccel.ReplayAndExtract(nil, quote.GetCcelBootEventLog(), rtmrBank, elextract.Opts{
+		Loader:             elextract.GRUB,
+		SkipACPITableCheck: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse and replay CCEL boot event log: %v", err)
+	}
+
+	machineState, err := server.ConvertToMachineState(fls)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert firmware log state: %v", err)
+	}
+
+	cosState, err := extract.ParseCOSEventLog(quote.GetCelLaunchEventLog(), rtmrBank, cosOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse COS launch event log: %w", err)
+	}
+	machineState.Cos = cosState.Cos
+
+	return &State{
+		MachineState:     machineState,
+		FirmwareLogState: fls,
+		Runtime:          cosState.Runtime,
+		Unrecognized:     cosState.Unrecognized,
+		GPUs:             cosState.GPUs,
+	}, nil
+}
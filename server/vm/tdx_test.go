@@ -0,0 +1,248 @@
+package vm
+
+import (
+	"bytes"
+	"crypto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/GoogleCloudPlatform/confidential-space/server/extract"
+	"github.com/google/go-eventlog/cel"
+	"github.com/google/go-tdx-guest/abi"
+	"github.com/google/go-tdx-guest/verify"
+	"google.golang.org/protobuf/proto"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+	tdxpb "github.com/google/go-tdx-guest/proto/tdx"
+	tpmattestpb "github.com/google/go-tpm-tools/proto/attest"
+
+	_ "embed"
+)
+
+// COS 113 TDX test data, from github.com/google/go-tdx-guest/testing/testdata/ccel.
+var (
+	//go:embed testdata/cos_113_tdx_quote.bin
+	cos113RawQuote []byte
+
+	//go:embed testdata/cos_113_ccel_eventlog.bin
+	cos113CCELEventLog []byte
+)
+
+// cos113ReportData is the report data bound by cos_113_tdx_quote.bin.
+var cos113ReportData = make([]byte, 64)
+
+func testTDQuote(t *testing.T) *tdxpb.QuoteV4 {
+	t.Helper()
+	quote, err := abi.QuoteToProto(cos113RawQuote)
+	if err != nil {
+		t.Fatalf("failed to parse TD quote: %v", err)
+	}
+	quoteV4, ok := quote.(*tdxpb.QuoteV4)
+	if !ok {
+		t.Fatalf("got quote type %T, want *tdxpb.QuoteV4", quote)
+	}
+	return quoteV4
+}
+
+func testSerializedTDQuote(t *testing.T) []byte {
+	t.Helper()
+	b, err := proto.Marshal(testTDQuote(t))
+	if err != nil {
+		t.Fatalf("failed to marshal TD quote: %v", err)
+	}
+	return b
+}
+
+func emptyCOSEventLog(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := cel.NewConfComputeMR().EncodeCEL(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerifyTDQuote(t *testing.T) {
+	tdQuote, err := verifyTDQuote(testSerializedTDQuote(t), cos113ReportData, nil, time.Time{})
+	if err != nil {
+		t.Fatalf("verifyTDQuote() failed: %v", err)
+	}
+	if len(tdQuote.GetTdQuoteBody().GetRtmrs()) != rtmrCount {
+		t.Errorf("verifyTDQuote() returned %d RTMRs, want %d", len(tdQuote.GetTdQuoteBody().GetRtmrs()), rtmrCount)
+	}
+}
+
+func TestVerifyTDQuoteErrors(t *testing.T) {
+	tamperedQuote := testTDQuote(t)
+	tamperedQuote.TdQuoteBody.Rtmrs[3] = bytes.Repeat([]byte{0x01}, 48)
+	tamperedQuoteBytes, err := proto.Marshal(tamperedQuote)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name       string
+		rawQuote   []byte
+		reportData []byte
+		wantErrStr string
+	}{
+		{
+			name:       "empty quote",
+			rawQuote:   nil,
+			reportData: cos113ReportData,
+			wantErrStr: "empty",
+		},
+		{
+			name:       "malformed quote",
+			rawQuote:   []byte("not a quote"),
+			reportData: cos113ReportData,
+			wantErrStr: "unmarshal",
+		},
+		{
+			name:       "tampered quote",
+			rawQuote:   tamperedQuoteBytes,
+			reportData: cos113ReportData,
+			wantErrStr: "signature",
+		},
+		{
+			name:       "report data mismatch",
+			rawQuote:   testSerializedTDQuote(t),
+			reportData: bytes.Repeat([]byte{0x01}, 64),
+			wantErrStr: "report data",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := verifyTDQuote(tc.rawQuote, tc.reportData, nil, time.Time{})
+			if err == nil {
+				t.Fatalf("verifyTDQuote() succeeded, want error")
+			}
+			if !strings.Contains(err.Error(), tc.wantErrStr) {
+				t.Errorf("verifyTDQuote() got error %v, want error containing %q", err, tc.wantErrStr)
+			}
+		})
+	}
+}
+
+func TestVerifyTDQuoteEarliestCertIssueTime(t *testing.T) {
+	chain, err := verify.ExtractChainFromQuote(testTDQuote(t))
+	if err != nil {
+		t.Fatalf("failed to extract PCK certificate chain: %v", err)
+	}
+	issued := chain.PCKCertificate.NotBefore
+
+	if _, err := verifyTDQuote(testSerializedTDQuote(t), cos113ReportData, nil, issued); err != nil {
+		t.Errorf("verifyTDQuote() with the PCK certificate issue time failed: %v", err)
+	}
+	_, err = verifyTDQuote(testSerializedTDQuote(t), cos113ReportData, nil, issued.Add(time.Second))
+	if err == nil || !strings.Contains(err.Error(), "PCK certificate is not accepted") {
+		t.Errorf("verifyTDQuote() got error %v, want PCK certificate issue time error", err)
+	}
+}
+
+func TestCreateRTMRBank(t *testing.T) {
+	tdQuote := testTDQuote(t)
+	rtmrBank, err := createRTMRBank(tdQuote)
+	if err != nil {
+		t.Fatalf("createRTMRBank() failed: %v", err)
+	}
+	for i, rtmr := range rtmrBank.RTMRs {
+		if rtmr.Index != i {
+			t.Errorf("RTMR %d has index %d", i, rtmr.Index)
+		}
+		if !bytes.Equal(rtmr.Digest, tdQuote.GetTdQuoteBody().GetRtmrs()[i]) {
+			t.Errorf("RTMR %d digest does not match the quote", i)
+		}
+	}
+
+	tdQuote.TdQuoteBody.Rtmrs = tdQuote.TdQuoteBody.Rtmrs[:3]
+	if _, err := createRTMRBank(tdQuote); err == nil {
+		t.Errorf("createRTMRBank() with 3 RTMRs succeeded, want error")
+	}
+}
+
+func TestVerifyTdxEventLogs(t *testing.T) {
+	rtmrBank, err := createRTMRBank(testTDQuote(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quote := &attestpb.TdxCcelQuote{
+		CcelBootEventLog:  cos113CCELEventLog,
+		CelLaunchEventLog: emptyCOSEventLog(t),
+	}
+	state, err := verifyTdxEventLogs(quote, rtmrBank, extract.Options{})
+	if err != nil {
+		t.Fatalf("verifyTdxEventLogs() failed: %v", err)
+	}
+
+	ms := state.MachineState
+	if got := ms.GetPlatform().GetTechnology(); got != tpmattestpb.GCEConfidentialTechnology_INTEL_TDX {
+		t.Errorf("got technology %v, want INTEL_TDX", got)
+	}
+	if !strings.Contains(ms.GetLinuxKernel().GetCommandLine(), "dm-mod.create") {
+		t.Errorf("got kernel command line %q, want a COS command line", ms.GetLinuxKernel().GetCommandLine())
+	}
+	if ms.GetCos().GetContainer() == nil {
+		t.Errorf("verifyTdxEventLogs() returned no COS container state")
+	}
+	if state.FirmwareLogState == nil {
+		t.Errorf("verifyTdxEventLogs() returned nil FirmwareLogState")
+	}
+}
+
+func TestVerifyTdxEventLogsErrors(t *testing.T) {
+	rtmrBank, err := createRTMRBank(testTDQuote(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A COS event that was never extended into RTMR3.
+	unmeasuredLog := cel.NewConfComputeMR()
+	event := coscel.COSTLV{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")}
+	if err := unmeasuredLog.AppendEvent(event, []crypto.Hash{crypto.SHA384}, coscel.COSCCELMRIndex, func(crypto.Hash, int, []byte) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	var unmeasuredBuf bytes.Buffer
+	if err := unmeasuredLog.EncodeCEL(&unmeasuredBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name       string
+		quote      *attestpb.TdxCcelQuote
+		wantErrStr string
+	}{
+		{
+			name: "truncated boot event log",
+			quote: &attestpb.TdxCcelQuote{
+				CcelBootEventLog:  cos113CCELEventLog[:len(cos113CCELEventLog)/64],
+				CelLaunchEventLog: emptyCOSEventLog(t),
+			},
+			wantErrStr: "CCEL boot event log",
+		},
+		{
+			name: "unmeasured launch event",
+			quote: &attestpb.TdxCcelQuote{
+				CcelBootEventLog:  cos113CCELEventLog,
+				CelLaunchEventLog: unmeasuredBuf.Bytes(),
+			},
+			wantErrStr: "COS launch event log",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := verifyTdxEventLogs(tc.quote, rtmrBank, extract.Options{})
+			if err == nil {
+				t.Fatalf("verifyTdxEventLogs() succeeded, want error")
+			}
+			if !strings.Contains(err.Error(), tc.wantErrStr) {
+				t.Errorf("verifyTdxEventLogs() got error %v, want error containing %q", err, tc.wantErrStr)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package vm
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/extract"
+	"github.com/GoogleCloudPlatform/confidential-space/server/internal/signedquote"
+	"github.com/google/go-eventlog/register"
+	"github.com/google/go-eventlog/tpmeventlog"
+	"github.com/google/go-tpm-tools/server"
+	"github.com/google/go-tpm/tpm2"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+	elextract "github.com/google/go-eventlog/extract"
+	tpmquote "github.com/google/go-tpm-tools/quote"
+)
+
+func verifyTpmQuote(quote *attestpb.TpmQuote, reportData []byte, opts *VerifyOpts) (*State, error) {
+	akPub, err := validateAKCertEndorsement(quote.GetEndorsement().GetAkCertEndorsement(), opts.AKRoots, opts.EarliestCertIssueTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate AK certificate endorsement: %v", err)
+	}
+
+	hashAlgo := opts.HashAlgo
+	if hashAlgo == 0 {
+		hashAlgo = tpm2.TPMAlgSHA256
+	}
+
+	if len(quote.GetQuotes()) == 0 {
+		return nil, fmt.Errorf("no quotes found")
+	}
+	var replayQuote *attestpb.TpmQuote_SignedQuote
+	for _, q := range quote.GetQuotes() {
+		if err := tpmquote.Verify(signedquote.ToProto(q), akPub, reportData); err != nil {
+			return nil, fmt.Errorf("failed to verify quote with hash algorithm %v: %v", q.GetHashAlgorithm(), err)
+		}
+		if q.GetHashAlgorithm() == uint32(hashAlgo) {
+			replayQuote = q
+		}
+	}
+	if replayQuote == nil {
+		return nil, fmt.Errorf("no quote found with matching hash algorithm: %v", hashAlgo)
+	}
+
+	pcrBank, err := signedquote.PCRBank(replayQuote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PCR bank: %v", err)
+	}
+
+	return verifyTpmEventLogs(quote, pcrBank, opts.COSOptions)
+}
+
+// validateAKCertEndorsement verifies that the AK certificate chains to one of
+// the roots through the endorsement's intermediates and was not issued before
+// the earliest issue time, and returns the AK public key.
+func validateAKCertEndorsement(endorsement *attestpb.TpmAttestationEndorsement_AkCertEndorsement, roots []*x509.Certificate, earliestIssueTime time.Time) (crypto.PublicKey, error) {
+	if endorsement == nil {
+		return nil, fmt.Errorf("AK certificate endorsement is nil")
+	}
+
+	akCert, err := x509.ParseCertificate(endorsement.GetAkCert())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse AK certificate: %v", err)
+	}
+
+	var intermediates []*x509.Certificate
+	for i, der := range endorsement.GetAkCertChain() {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse AK certificate chain entry %d: %v", i, err)
+		}
+		intermediates = append(intermediates, cert)
+	}
+
+	if err := server.VerifyAKCert(akCert, roots, intermediates); err != nil {
+		return nil, err
+	}
+	if err := checkCertIssueTime(akCert, earliestIssueTime); err != nil {
+		return nil, fmt.Errorf("AK certificate is not accepted: %v", err)
+	}
+
+	return akCert.PublicKey, nil
+}
+
+func verifyTpmEventLogs(quote *attestpb.TpmQuote, pcrBank register.PCRBank, cosOpts extract.Options) (*State, error) {
+	fls, err := tpmeventlog.ReplayAndExtract(quote.GetPcclientBootEventLog(), pcrBank, elextract.Opts{
+		Loader: elextract.GRUB,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse and replay boot event log: %v", err)
+	}
+
+	machineState, err := server.ConvertToMachineState(fls)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert firmware log state: %v", err)
+	}
+
+	cosState, err := extract.ParseCOSEventLog(quote.GetCelLaunchEventLog(), pcrBank, cosOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse COS launch event log: %w", err)
+	}
+	machineState.Cos = cosState.Cos
+
+	return &State{
+		MachineState:     machineState,
+		FirmwareLogState: fls,
+		Runtime:          cosState.Runtime,
+		Unrecognized:     cosState.Unrecognized,
+		GPUs:             cosState.GPUs,
+	}, nil
+}
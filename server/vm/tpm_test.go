@@ -0,0 +1,300 @@
+package vm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/GoogleCloudPlatform/confidential-space/server/extract"
+	"github.com/GoogleCloudPlatform/confidential-space/server/internal/certtest"
+	"github.com/GoogleCloudPlatform/confidential-space/server/labels"
+	"github.com/google/go-eventlog/cel"
+	"github.com/google/go-eventlog/register"
+	"github.com/google/go-eventlog/tcg"
+	"github.com/google/go-tpm-tools/client"
+	"github.com/google/go-tpm-tools/simulator"
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	_ "embed"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+	tpmattestpb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+// COS 101 AMD SEV boot event log, from github.com/google/go-tpm-tools/internal/test/eventlogs.
+//
+//go:embed testdata/cos_101_amd_sev_eventlog.bin
+var cos101BootEventLog []byte
+
+const testImageRef = "docker.io/library/hello-world:latest"
+
+// testPCRSel is the SHA-256 PCR selection quoted in the tests. It covers the
+// boot PCRs and the COS event PCR.
+var testPCRSel = tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, coscel.EventPCRIndex}}
+
+func newTestCA(t *testing.T, name string, parent *certtest.CA) *certtest.CA {
+	t.Helper()
+	ca, err := certtest.NewCA(&x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, elliptic.P256(), parent)
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	return ca
+}
+
+func newTestAKCert(t *testing.T, akPub crypto.PublicKey, issuer *certtest.CA) *x509.Certificate {
+	t.Helper()
+	cert, err := issuer.Issue(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "test AK"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, akPub)
+	if err != nil {
+		t.Fatalf("failed to create AK certificate: %v", err)
+	}
+	return cert
+}
+
+// extendBootEventLog extends the SHA-256 digests of the boot event log into
+// the TPM, so that the log replays against its PCRs.
+func extendBootEventLog(t *testing.T, tpm io.ReadWriter, rawEventLog []byte) {
+	t.Helper()
+	eventLog, err := tcg.ParseEventLog(rawEventLog, tcg.ParseOpts{})
+	if err != nil {
+		t.Fatalf("failed to parse boot event log: %v", err)
+	}
+	for _, event := range eventLog.Events(register.HashSHA256) {
+		if event.Type == tcg.NoAction {
+			continue
+		}
+		if err := tpm2.PCRExtend(tpm, tpmutil.Handle(event.Index), tpm2.AlgSHA256, event.Digest, ""); err != nil {
+			t.Fatalf("failed to extend PCR %d: %v", event.Index, err)
+		}
+	}
+}
+
+func pcrExtender(tpm io.ReadWriter) cel.MRExtender {
+	return func(_ crypto.Hash, mrIndex int, digest []byte) error {
+		return tpm2.PCRExtend(tpm, tpmutil.Handle(mrIndex), tpm2.AlgSHA256, digest, "")
+	}
+}
+
+// testTpmVmAttestation measures a COS launch into a simulated TPM and returns a
+// VmAttestation quoting it, along with the trusted AK root pool.
+func testTpmVmAttestation(t *testing.T) (*attestpb.VmAttestation, []*x509.Certificate) {
+	t.Helper()
+	tpm, err := simulator.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.CheckedClose(t, tpm)
+
+	extendBootEventLog(t, tpm, cos101BootEventLog)
+
+	cosEventLog := cel.NewPCR()
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte(testImageRef)},
+		{EventType: coscel.LaunchSeparatorType},
+	}
+	for _, event := range events {
+		if err := cosEventLog.AppendEvent(event, []crypto.Hash{crypto.SHA256}, coscel.EventPCRIndex, pcrExtender(tpm)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var cosEventLogBuf bytes.Buffer
+	if err := cosEventLog.EncodeCEL(&cosEventLogBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	ak, err := client.AttestationKeyECC(tpm)
+	if err != nil {
+		t.Fatalf("failed to create AK: %v", err)
+	}
+	defer ak.Close()
+
+	root := newTestCA(t, "test root", nil)
+	intermediate := newTestCA(t, "test intermediate", root)
+	akCert := newTestAKCert(t, ak.PublicKey(), intermediate)
+
+	att := &attestpb.VmAttestation{
+		Label:     []byte(labels.WorkloadAttestation),
+		Challenge: []byte("challenge"),
+	}
+	quote, err := ak.Quote(testPCRSel, reportData(att))
+	if err != nil {
+		t.Fatalf("failed to quote: %v", err)
+	}
+	att.Quote = &attestpb.VmAttestationQuote{
+		Quote: &attestpb.VmAttestationQuote_TpmQuote{
+			TpmQuote: &attestpb.TpmQuote{
+				Quotes: []*attestpb.TpmQuote_SignedQuote{{
+					HashAlgorithm: uint32(quote.GetPcrs().GetHash()),
+					PcrValues:     quote.GetPcrs().GetPcrs(),
+					TpmsAttest:    quote.GetQuote(),
+					TpmtSignature: quote.GetRawSig(),
+				}},
+				PcclientBootEventLog: cos101BootEventLog,
+				CelLaunchEventLog:    cosEventLogBuf.Bytes(),
+				Endorsement: &attestpb.TpmAttestationEndorsement{
+					Endorsement: &attestpb.TpmAttestationEndorsement_AkCertEndorsement_{
+						AkCertEndorsement: &attestpb.TpmAttestationEndorsement_AkCertEndorsement{
+							AkCert:      akCert.Raw,
+							AkCertChain: [][]byte{intermediate.Cert.Raw},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return att, []*x509.Certificate{root.Cert}
+}
+
+func TestVerifyVmAttestationTpmQuote(t *testing.T) {
+	att, roots := testTpmVmAttestation(t)
+
+	state, err := VerifyVmAttestation(att, &VerifyOpts{
+		Label:                 labels.WorkloadAttestation,
+		Challenge:             []byte("challenge"),
+		AKRoots:               roots,
+		EarliestCertIssueTime: time.Now().Add(-2 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("VerifyVmAttestation() failed: %v", err)
+	}
+
+	ms := state.MachineState
+	if got := ms.GetPlatform().GetTechnology(); got != tpmattestpb.GCEConfidentialTechnology_AMD_SEV {
+		t.Errorf("got technology %v, want AMD_SEV", got)
+	}
+	if ms.GetLinuxKernel().GetCommandLine() == "" {
+		t.Errorf("VerifyVmAttestation() returned empty kernel command line")
+	}
+	if got := ms.GetCos().GetContainer().GetImageReference(); got != testImageRef {
+		t.Errorf("got image reference %q, want %q", got, testImageRef)
+	}
+}
+
+func TestVerifyVmAttestationTpmQuoteErrors(t *testing.T) {
+	testcases := []struct {
+		name       string
+		mutate     func(att *attestpb.VmAttestation, opts *VerifyOpts)
+		wantErrStr string
+	}{
+		{
+			name:       "no AK roots",
+			mutate:     func(_ *attestpb.VmAttestation, opts *VerifyOpts) { opts.AKRoots = nil },
+			wantErrStr: "no trusted root certs",
+		},
+		{
+			name: "untrusted AK root",
+			mutate: func(_ *attestpb.VmAttestation, opts *VerifyOpts) {
+				opts.AKRoots = []*x509.Certificate{newTestCA(t, "other root", nil).Cert}
+			},
+			wantErrStr: "did not chain to a trusted root",
+		},
+		{
+			name: "missing AK cert chain",
+			mutate: func(att *attestpb.VmAttestation, _ *VerifyOpts) {
+				att.GetQuote().GetTpmQuote().GetEndorsement().GetAkCertEndorsement().AkCertChain = nil
+			},
+			wantErrStr: "did not chain to a trusted root",
+		},
+		{
+			name: "AK certificate issued before the earliest issue time",
+			mutate: func(_ *attestpb.VmAttestation, opts *VerifyOpts) {
+				opts.EarliestCertIssueTime = time.Now()
+			},
+			wantErrStr: "before the earliest allowed issue time",
+		},
+		{
+			name: "missing endorsement",
+			mutate: func(att *attestpb.VmAttestation, _ *VerifyOpts) {
+				att.GetQuote().GetTpmQuote().Endorsement = nil
+			},
+			wantErrStr: "endorsement is nil",
+		},
+		{
+			name: "different extra data",
+			mutate: func(att *attestpb.VmAttestation, _ *VerifyOpts) {
+				att.ExtraData = []byte("extra data")
+			},
+			wantErrStr: "extraData",
+		},
+		{
+			name: "tampered PCR value",
+			mutate: func(att *attestpb.VmAttestation, _ *VerifyOpts) {
+				att.GetQuote().GetTpmQuote().GetQuotes()[0].GetPcrValues()[coscel.EventPCRIndex] = make([]byte, 32)
+			},
+			wantErrStr: "failed to verify quote",
+		},
+		{
+			name: "no quote for hash algorithm",
+			mutate: func(_ *attestpb.VmAttestation, opts *VerifyOpts) {
+				opts.HashAlgo = 0x000C // TPM_ALG_SHA384
+			},
+			wantErrStr: "no quote found with matching hash algorithm",
+		},
+		{
+			name: "no quotes",
+			mutate: func(att *attestpb.VmAttestation, _ *VerifyOpts) {
+				att.GetQuote().GetTpmQuote().Quotes = nil
+			},
+			wantErrStr: "no quotes found",
+		},
+		{
+			name: "truncated boot event log",
+			mutate: func(att *attestpb.VmAttestation, _ *VerifyOpts) {
+				att.GetQuote().GetTpmQuote().PcclientBootEventLog = cos101BootEventLog[:len(cos101BootEventLog)/2]
+			},
+			wantErrStr: "boot event log",
+		},
+		{
+			name: "unmeasured launch event log",
+			mutate: func(att *attestpb.VmAttestation, _ *VerifyOpts) {
+				cosEventLog := cel.NewPCR()
+				event := coscel.COSTLV{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/other:latest")}
+				if err := cosEventLog.AppendEvent(event, []crypto.Hash{crypto.SHA256}, coscel.EventPCRIndex, func(crypto.Hash, int, []byte) error { return nil }); err != nil {
+					t.Fatal(err)
+				}
+				var buf bytes.Buffer
+				if err := cosEventLog.EncodeCEL(&buf); err != nil {
+					t.Fatal(err)
+				}
+				att.GetQuote().GetTpmQuote().CelLaunchEventLog = buf.Bytes()
+			},
+			wantErrStr: "COS launch event log",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			att, roots := testTpmVmAttestation(t)
+			opts := &VerifyOpts{Label: labels.WorkloadAttestation, Challenge: []byte("challenge"), AKRoots: roots, COSOptions: extract.Options{}}
+			tc.mutate(att, opts)
+
+			_, err := VerifyVmAttestation(att, opts)
+			if err == nil {
+				t.Fatalf("VerifyVmAttestation() succeeded, want error")
+			}
+			if !strings.Contains(err.Error(), tc.wantErrStr) {
+				t.Errorf("VerifyVmAttestation() got error %v, want error containing %q", err, tc.wantErrStr)
+			}
+		})
+	}
+}
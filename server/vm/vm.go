@@ -0,0 +1,197 @@
+// Package vm provides functions for verifying Confidential VM attestations.
+package vm
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/extract"
+	"github.com/GoogleCloudPlatform/confidential-space/server/gpu"
+	"github.com/google/go-tdx-guest/verify"
+	"github.com/google/go-tpm/tpm2"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+	elpb "github.com/google/go-eventlog/proto/state"
+	tpmattestpb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+// VerifyOpts contains the options for verifying a VmAttestation.
+type VerifyOpts struct {
+	// Label is the expected VmAttestation label, e.g. labels.WorkloadAttestation.
+	// Required: the label domain-separates the report data bound by the quote.
+	Label string
+
+	// Challenge is the challenge the verifier expects the workload to have
+	// provided. Required: an attestation can only be trusted to be fresh if its
+	// challenge is checked.
+	Challenge []byte
+
+	// TdxOptions are used to verify the TD quote signature and PCK certificate
+	// chain. If nil, verify.DefaultOptions() is used.
+	TdxOptions *verify.Options
+
+	// AKRoots are the trusted roots for vTPM attestation key (AK) certificates.
+	// Required to verify a TpmQuote.
+	AKRoots []*x509.Certificate
+
+	// EarliestCertIssueTime rejects endorsement certificates issued before it:
+	// the AK certificate of a TpmQuote and the PCK certificate of a TD quote.
+	// Typically rims.EarliestCertIssueTime of the image database. If zero, the
+	// issue time is not checked.
+	EarliestCertIssueTime time.Time
+
+	// HashAlgo selects the TpmQuote PCR bank that the event logs are replayed
+	// against. If zero, the SHA-256 bank is used.
+	HashAlgo tpm2.TPMAlgID
+
+	// COSOptions are used to parse the COS launch event log.
+	COSOptions extract.Options
+
+	// DeviceReportOptions are used to verify the runtime GPU attestation report
+	// of the VmAttestation device_reports. If set, a VM whose COS event log
+	// measured a GPU binding must carry device reports for the same GPUs, with
+	// a nonce from GPUNonce and CC mode ON, and MachineState.Cos holds the
+	// measured GPU attestation report. If nil, device_reports are ignored.
+	DeviceReportOptions *gpu.Options
+}
+
+// State is the verified state of a Confidential VM.
+type State struct {
+	// MachineState contains the verified firmware, Secure Boot, kernel and COS
+	// launch state. It can be passed directly to image.Validate.
+	MachineState *tpmattestpb.MachineState
+
+	// FirmwareLogState is the verified boot event log state that MachineState
+	// was derived from.
+	FirmwareLogState *elpb.FirmwareLogState
+
+	// Runtime is the container runtime history measured after launch. It is
+	// kept apart from MachineState.Cos, which only holds launch configuration.
+	Runtime *extract.RuntimeState
+
+	// Unrecognized are the authenticated COS events that were not understood.
+	// Only populated when COSOptions.AllowUnrecognizedEvents is set.
+	Unrecognized []extract.UnrecognizedEvent
+
+	// GPUs are the GPUs of the verified NVIDIA attestation report bound in the
+	// COS event log. Only populated when COSOptions.GpuVerifyOptions is set.
+	GPUs []*gpu.VerifiedGPU
+
+	// ACPI are the verified ACPI tables of the VM. Only populated when the
+	// VmAttestation carries ACPI data, which is required if the firmware event
+	// log measured any.
+	ACPI *extract.ACPIState
+
+	// DeviceGPUs are the GPUs of the verified runtime device_reports. Only
+	// populated when DeviceReportOptions is set.
+	DeviceGPUs []*gpu.VerifiedGPU
+}
+
+// VerifyVmAttestation verifies the attestation and returns the verified VM state.
+//
+// The quote must be signed by a key chaining to a trusted root and bind the
+// report data SHA512(label || SHA512(challenge || SHA512(extra_data))). For a
+// TpmQuote, the report data is the quote's extra data. The boot and launch
+// event logs are replayed against the quoted measurement registers before any
+// state is extracted from them.
+func VerifyVmAttestation(att *attestpb.VmAttestation, opts *VerifyOpts) (*State, error) {
+	if att == nil {
+		return nil, fmt.Errorf("VmAttestation is nil")
+	}
+	if opts == nil {
+		return nil, fmt.Errorf("verify opts is nil")
+	}
+
+	if opts.Label == "" {
+		return nil, fmt.Errorf("verify opts has no expected label")
+	}
+	if string(att.GetLabel()) != opts.Label {
+		return nil, fmt.Errorf("unexpected attestation label %q, want %q", att.GetLabel(), opts.Label)
+	}
+	if len(opts.Challenge) == 0 {
+		return nil, fmt.Errorf("verify opts has no expected challenge")
+	}
+	if !bytes.Equal(att.GetChallenge(), opts.Challenge) {
+		return nil, fmt.Errorf("attestation challenge does not match the expected challenge")
+	}
+
+	quoteOpts := opts
+	if opts.DeviceReportOptions != nil {
+		// The measured GPU binding is needed to check the device reports.
+		quoteOpts = &VerifyOpts{}
+		*quoteOpts = *opts
+		quoteOpts.COSOptions.PopulateGpuDeviceState = true
+	}
+
+	var state *State
+	var err error
+	switch quote := att.GetQuote().GetQuote().(type) {
+	case *attestpb.VmAttestationQuote_TdxCcelQuote:
+		state, err = verifyTdxCcelQuote(quote.TdxCcelQuote, reportData(att), quoteOpts)
+	case *attestpb.VmAttestationQuote_TpmQuote:
+		state, err = verifyTpmQuote(quote.TpmQuote, reportData(att), quoteOpts)
+	case nil:
+		return nil, fmt.Errorf("VmAttestation has no quote")
+	default:
+		return nil, fmt.Errorf("unsupported VmAttestation quote type %T", quote)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if state.ACPI, err = verifyACPIData(att.GetAcpiData(), state.FirmwareLogState); err != nil {
+		return nil, fmt.Errorf("failed to verify ACPI data: %v", err)
+	}
+
+	if opts.DeviceReportOptions != nil {
+		cosState := state.MachineState.GetCos()
+		measuredBinding := cosState.GetGpuDeviceState().GetNvidiaAttestationReport() != nil
+		if measuredBinding || len(att.GetDeviceReports()) != 0 {
+			if state.DeviceGPUs, err = verifyDeviceReports(att.GetDeviceReports(), reportData(att), cosState, *opts.DeviceReportOptions); err != nil {
+				return nil, fmt.Errorf("failed to verify device reports: %v", err)
+			}
+		}
+	}
+
+	return state, nil
+}
+
+// verifyACPIData verifies the ACPI data against the verified firmware event
+// log. The ACPI data is required if the log measured any, so that leaving it
+// out cannot hide the measured tables. Returns nil if the log measured no ACPI
+// data and the attestation carries none.
+func verifyACPIData(acpiData *attestpb.AcpiData, fls *elpb.FirmwareLogState) (*extract.ACPIState, error) {
+	if acpiData == nil {
+		if extract.HasACPIEvents(fls) {
+			return nil, fmt.Errorf("the firmware event log measured ACPI data, but the VmAttestation has no acpi_data")
+		}
+		return nil, nil
+	}
+	return extract.VerifyACPIData(acpiData, fls)
+}
+
+// checkCertIssueTime rejects an endorsement certificate issued before the
+// earliest issue time, unless the earliest issue time is zero.
+func checkCertIssueTime(cert *x509.Certificate, earliest time.Time) error {
+	if !earliest.IsZero() && cert.NotBefore.Before(earliest) {
+		return fmt.Errorf("certificate %q was issued at %v, before the earliest allowed issue time %v", cert.Subject, cert.NotBefore, earliest)
+	}
+	return nil
+}
+
+// reportData computes SHA512(label || SHA512(challenge || SHA512(extra_data))).
+func reportData(att *attestpb.VmAttestation) []byte {
+	extraDataDigest := sha512.Sum512(att.GetExtraData())
+
+	challengeHasher := sha512.New()
+	challengeHasher.Write(att.GetChallenge())
+	challengeHasher.Write(extraDataDigest[:])
+
+	hasher := sha512.New()
+	hasher.Write(att.GetLabel())
+	hasher.Write(challengeHasher.Sum(nil))
+	return hasher.Sum(nil)
+}
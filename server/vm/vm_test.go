@@ -0,0 +1,153 @@
+package vm
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/extract"
+	"github.com/GoogleCloudPlatform/confidential-space/server/labels"
+
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+	elpb "github.com/google/go-eventlog/proto/state"
+)
+
+func TestReportData(t *testing.T) {
+	att := &attestpb.VmAttestation{
+		Label:     []byte(labels.WorkloadAttestation),
+		Challenge: []byte("challenge"),
+		ExtraData: []byte("extra data"),
+	}
+
+	extraDataDigest := sha512.Sum512([]byte("extra data"))
+	challengeDigest := sha512.Sum512(append([]byte("challenge"), extraDataDigest[:]...))
+	want := sha512.Sum512(append([]byte(labels.WorkloadAttestation), challengeDigest[:]...))
+
+	if got := reportData(att); !bytes.Equal(got, want[:]) {
+		t.Errorf("reportData() = %x, want %x", got, want)
+	}
+}
+
+func testVmAttestation(t *testing.T) *attestpb.VmAttestation {
+	t.Helper()
+	return &attestpb.VmAttestation{
+		Label:     []byte(labels.WorkloadAttestation),
+		Challenge: []byte("challenge"),
+		Quote: &attestpb.VmAttestationQuote{
+			Quote: &attestpb.VmAttestationQuote_TdxCcelQuote{
+				TdxCcelQuote: &attestpb.TdxCcelQuote{
+					CcelBootEventLog:  cos113CCELEventLog,
+					CelLaunchEventLog: emptyCOSEventLog(t),
+					TdQuote:           testSerializedTDQuote(t),
+				},
+			},
+		},
+	}
+}
+
+func TestVerifyVmAttestationErrors(t *testing.T) {
+	testcases := []struct {
+		name       string
+		att        *attestpb.VmAttestation
+		opts       *VerifyOpts
+		wantErrStr string
+	}{
+		{
+			name:       "nil attestation",
+			att:        nil,
+			opts:       &VerifyOpts{},
+			wantErrStr: "VmAttestation is nil",
+		},
+		{
+			name:       "nil opts",
+			att:        testVmAttestation(t),
+			opts:       nil,
+			wantErrStr: "opts is nil",
+		},
+		{
+			name:       "no expected label",
+			att:        testVmAttestation(t),
+			opts:       &VerifyOpts{Challenge: []byte("challenge")},
+			wantErrStr: "no expected label",
+		},
+		{
+			name:       "unexpected label",
+			att:        testVmAttestation(t),
+			opts:       &VerifyOpts{Label: labels.KeyAttestation},
+			wantErrStr: "label",
+		},
+		{
+			name:       "no expected challenge",
+			att:        testVmAttestation(t),
+			opts:       &VerifyOpts{Label: labels.WorkloadAttestation},
+			wantErrStr: "no expected challenge",
+		},
+		{
+			name:       "empty expected challenge",
+			att:        testVmAttestation(t),
+			opts:       &VerifyOpts{Label: labels.WorkloadAttestation, Challenge: []byte{}},
+			wantErrStr: "no expected challenge",
+		},
+		{
+			name:       "unexpected challenge",
+			att:        testVmAttestation(t),
+			opts:       &VerifyOpts{Label: labels.WorkloadAttestation, Challenge: []byte("other challenge")},
+			wantErrStr: "challenge",
+		},
+		{
+			name:       "no quote",
+			att:        &attestpb.VmAttestation{Label: []byte(labels.WorkloadAttestation), Challenge: []byte("challenge")},
+			opts:       &VerifyOpts{Label: labels.WorkloadAttestation, Challenge: []byte("challenge")},
+			wantErrStr: "no quote",
+		},
+		{
+			// The test quote binds all-zero report data, which no
+			// label/challenge/extra_data combination can produce.
+			name:       "report data mismatch",
+			att:        testVmAttestation(t),
+			opts:       &VerifyOpts{Label: labels.WorkloadAttestation, Challenge: []byte("challenge")},
+			wantErrStr: "report data",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := VerifyVmAttestation(tc.att, tc.opts)
+			if err == nil {
+				t.Fatalf("VerifyVmAttestation() succeeded, want error")
+			}
+			if !strings.Contains(err.Error(), tc.wantErrStr) {
+				t.Errorf("VerifyVmAttestation() got error %v, want error containing %q", err, tc.wantErrStr)
+			}
+		})
+	}
+}
+
+func TestVerifyACPIDataRequired(t *testing.T) {
+	rtmrBank, err := createRTMRBank(testTDQuote(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := verifyTdxEventLogs(&attestpb.TdxCcelQuote{
+		CcelBootEventLog:  cos113CCELEventLog,
+		CelLaunchEventLog: emptyCOSEventLog(t),
+	}, rtmrBank, extract.Options{})
+	if err != nil {
+		t.Fatalf("verifyTdxEventLogs() failed: %v", err)
+	}
+
+	// The COS 113 boot event log measures ACPI data, so stripping acpi_data
+	// must not skip its verification.
+	if _, err := verifyACPIData(nil, state.FirmwareLogState); err == nil || !strings.Contains(err.Error(), "no acpi_data") {
+		t.Errorf("verifyACPIData() without acpi_data got error %v, want missing acpi_data error", err)
+	}
+
+	acpi, err := verifyACPIData(nil, &elpb.FirmwareLogState{})
+	if err != nil {
+		t.Errorf("verifyACPIData() without ACPI events failed: %v", err)
+	}
+	if acpi != nil {
+		t.Errorf("verifyACPIData() without ACPI events got %v, want nil", acpi)
+	}
+}